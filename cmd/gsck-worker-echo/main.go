@@ -0,0 +1,53 @@
+// gsck-worker-echo is the reference plugin of gsck workers.
+// It runs nothing, but echoes what it's asked to run on each host:
+//
+//   $ go install github.com/lidongpeng36/gsck/cmd/gsck-worker-echo
+//   $ gsck -m echo -f 'web01 web02' uptime
+//
+// Options (`-o key=value`):
+//   delay: how long each host takes, e.g. `1s`
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lidongpeng36/gsck/plugin"
+)
+
+type echoHandler struct {
+	delay    time.Duration
+	transfer *plugin.Transfer
+}
+
+func (eh *echoHandler) Init(params *plugin.Init) (err error) {
+	if delay := params.Options["delay"]; delay != "" {
+		if eh.delay, err = time.ParseDuration(delay); err != nil {
+			return
+		}
+	}
+	eh.transfer = params.Transfer
+	return
+}
+
+func (eh *echoHandler) Execute(ctx context.Context, host *plugin.Host) *plugin.Output {
+	select {
+	case <-time.After(eh.delay):
+	case <-ctx.Done():
+		return &plugin.Output{ExitCode: -1, Error: "Cancelled."}
+	}
+	stdout := fmt.Sprintf("%s@%s:%s", host.User, host.Host, host.Port)
+	if eh.transfer != nil {
+		stdout += fmt.Sprintf("\ntransfer: %d bytes -> %s", len(eh.transfer.Data), eh.transfer.Dst)
+	}
+	return &plugin.Output{Stdout: stdout + "\n$ " + host.Cmd}
+}
+
+func main() {
+	if err := plugin.Serve(new(echoHandler)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/lidongpeng36/gsck/plugin"
+)
+
+// session drives echoHandler through the protocol
+type session struct {
+	t       *testing.T
+	encoder *json.Encoder
+	scanner *bufio.Scanner
+	done    chan error
+	stdin   io.WriteCloser
+}
+
+func newSession(t *testing.T) *session {
+	reqr, reqw := io.Pipe()
+	evr, evw := io.Pipe()
+	s := &session{
+		t:       t,
+		encoder: json.NewEncoder(reqw),
+		scanner: bufio.NewScanner(evr),
+		done:    make(chan error, 1),
+		stdin:   reqw,
+	}
+	go func() {
+		s.done <- plugin.ServeIO(new(echoHandler), reqr, evw)
+		_ = evw.Close()
+	}()
+	return s
+}
+
+func (s *session) send(msg *plugin.Message) {
+	if err := s.encoder.Encode(msg); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+func (s *session) receive() (msg plugin.Message) {
+	if !s.scanner.Scan() {
+		s.t.Fatal("Plugin exited")
+	}
+	if err := json.Unmarshal(s.scanner.Bytes(), &msg); err != nil {
+		s.t.Fatal(err)
+	}
+	return
+}
+
+func TestEcho(t *testing.T) {
+	s := newSession(t)
+	s.send(&plugin.Message{Type: plugin.TypeInit, Init: &plugin.Init{Version: plugin.Version}})
+	if msg := s.receive(); msg.Type != plugin.TypeReady {
+		t.Fatalf("Expected ready. Actual: %+v", msg)
+	}
+	s.send(&plugin.Message{Type: plugin.TypeExecute, ID: 7, Host: &plugin.Host{Host: "web01", Port: "22", User: "root", Cmd: "uptime"}})
+	msg := s.receive()
+	if msg.Type != plugin.TypeOutput || msg.ID != 7 || msg.Output.Stdout != "root@web01:22\n$ uptime" {
+		t.Fatalf("Unexpected output: %+v", msg)
+	}
+	s.send(&plugin.Message{Type: plugin.TypeShutdown})
+	if err := <-s.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEchoCancel(t *testing.T) {
+	s := newSession(t)
+	s.send(&plugin.Message{Type: plugin.TypeInit, Init: &plugin.Init{Options: map[string]string{"delay": "1h"}}})
+	s.receive()
+	s.send(&plugin.Message{Type: plugin.TypeExecute, ID: 1, Host: &plugin.Host{Cmd: "sleep"}})
+	s.send(&plugin.Message{Type: plugin.TypeCancel, ID: 1})
+	if msg := s.receive(); msg.ID != 1 || msg.Output.Error != "Cancelled." {
+		t.Fatalf("Unexpected output: %+v", msg)
+	}
+	_ = s.stdin.Close()
+	if err := <-s.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEchoInitError(t *testing.T) {
+	s := newSession(t)
+	s.send(&plugin.Message{Type: plugin.TypeInit, Init: &plugin.Init{Options: map[string]string{"delay": "soon"}}})
+	if msg := s.receive(); msg.Type != plugin.TypeError {
+		t.Fatalf("Expected error. Actual: %+v", msg)
+	}
+}
@@ -1,6 +1,7 @@
 package command
 
 import (
+	"io"
 	"io/ioutil"
 	"os"
 	"reflect"
@@ -15,6 +16,8 @@ type App struct {
 	Fifo     string
 	FifoFile string
 	Args     []string
+	// pipe is stdin (Pipe/HereDoc) which has not been read yet
+	pipe io.Reader
 	*cli.App
 }
 
@@ -35,11 +38,10 @@ func init() {
 	commands = make(map[string]cli.Command)
 	commandInUse = make([]cli.Command, 0, 10)
 
-	// Read Data From Pipe/HereDoc
+	// Data From Pipe/HereDoc is read on demand
 	fi, _ := os.Stdin.Stat()
 	if (fi.Mode() & (os.ModeCharDevice | os.ModeDir)) == 0 {
-		bytes, _ := ioutil.ReadAll(os.Stdin)
-		app.Pipe = string(bytes)
+		app.pipe = os.Stdin
 	}
 	// Read Data From FIFO
 	for i, arg := range os.Args {
@@ -55,6 +57,25 @@ func init() {
 	}
 }
 
+// ReadPipe reads all data from Pipe/HereDoc into app.Pipe, and returns it.
+// Pipe/HereDoc is read only once.
+func (app *App) ReadPipe() string {
+	if app.pipe != nil {
+		bytes, _ := ioutil.ReadAll(app.pipe)
+		app.Pipe = string(bytes)
+		app.pipe = nil
+	}
+	return app.Pipe
+}
+
+// PipeReader gives Pipe/HereDoc as a stream, for data that should not be held in memory.
+// It returns nil if there's no Pipe/HereDoc, or it has been read by ReadPipe.
+func (app *App) PipeReader() io.Reader {
+	reader := app.pipe
+	app.pipe = nil
+	return reader
+}
+
 // RegisterCommand add new Available command
 func RegisterCommand(cmd cli.Command) {
 	commands[cmd.Name] = cmd
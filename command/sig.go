@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sync/atomic"
 )
 
 // Global switcher
@@ -51,15 +52,41 @@ func RunSignal() {
 	}()
 }
 
-// CleanUpSignals runs all enabled handlers in priority order
+// StopSignal stops the default handling of SIGINT and SIGKILL,
+// for commands that handle them by themselves, e.g. an interactive shell.
+func StopSignal() {
+	signal.Stop(signalc)
+}
+
+// handover is set by Handover
+var handover int32
+
+// Handover makes CleanUpSignals leave exiting to the running command, once handlers succeed.
+// It's for handlers that stop the command gracefully, which then exits with its own code.
+// A second signal still quits at once, see CleanUpSignals.
+func Handover() {
+	atomic.StoreInt32(&handover, 1)
+}
+
+// CleanUpSignals runs all enabled handlers in priority order, and exits unless handed over
 func CleanUpSignals() {
 	if !enable {
 		return
 	}
 	signal.Stop(signalc)
+	// Handlers may wait for the command to stop, which goes on after handover.
+	// A second signal quits at once meanwhile.
+	quitc := make(chan os.Signal, 1)
+	signal.Notify(quitc, os.Interrupt, os.Kill)
+	go func() {
+		<-quitc
+		os.Exit(2)
+	}()
 	rc := 0
 	if err := shpq.Run(); nil != err {
 		rc = 2
+	} else if atomic.LoadInt32(&handover) == 1 {
+		return
 	}
 	os.Exit(rc)
 }
@@ -18,7 +18,7 @@ func init() {
 
 func action(c *cli.Context) {
 	app := command.Instance()
-	fmt.Println("PIPE: ", app.Pipe)
+	fmt.Println("PIPE: ", app.ReadPipe())
 	fmt.Println("FIFO: ", app.Fifo)
 	fmt.Println("FIFOFile: ", app.FifoFile)
 }
@@ -0,0 +1,53 @@
+package commander
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/lidongpeng36/gsck/command"
+	"github.com/lidongpeng36/gsck/formatter"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command.RegisterCommand(cli.Command{
+		Name:  "check",
+		Usage: "Diagnose reachability and authentication of hosts",
+		Description: "Each host is checked phase by phase: DNS, TCP connect, SSH version, host key,\n" +
+			"   auth methods and a no-op command. The first failed phase classifies the host:\n" +
+			"   ok, dns, network, ssh, hostkey, auth or exec.\n" +
+			"   Host keys are compared with config `ssh.known_hosts` (default: ~/.ssh/known_hosts).",
+		Flags: []cli.Flag{
+			JSONFlag,
+			UserFlag,
+			HostsFlag,
+			MethodFlag,
+			WorkerOptFlag,
+			PreferFlag,
+			PasswdFlag,
+			PasswordFlag,
+			AccountFlag,
+			TimeoutFlag,
+			ConnectTimeoutFlag,
+			ConcurrencyFlag,
+		},
+		Action: checkAction,
+	})
+}
+
+// CHECK Action (gsck check ...)
+func checkAction(c *cli.Context) {
+	exec := PrepareExecutor(c)
+	if !c.IsSet("concurrency") {
+		// Check is light, so use recommended concurrency of worker
+		exec.Parameter.Concurrency = 0
+	}
+	registerCancelHandler(exec)
+	failed, err := exec.Check(context.Background(), formatter.NewCheckFormatter(c.Bool("json")))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	os.Exit(failed)
+}
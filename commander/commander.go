@@ -1,10 +1,14 @@
 package commander
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/lidongpeng36/gsck/command"
 	"github.com/lidongpeng36/gsck/executor"
@@ -19,6 +23,7 @@ const (
 	PIPEEMTPY          = ""
 	PIPEUSEDBYHOSTLIST = "_PIPE_USED_BY_HOSTLIST"
 	PIPEUSEDBYCMD      = "_PIPE_USED_BY_CMD"
+	PIPEUSEDBYSTDIN    = "_PIPE_USED_BY_STDIN"
 )
 
 // var exec *executor.Executor
@@ -88,15 +93,104 @@ var AccountFlag = cli.StringFlag{
 // TimeoutFlag `-t`
 var TimeoutFlag = cli.IntFlag{
 	Name:  "timeout, t",
-	Usage: "Timeout. Unit: s",
+	Usage: "Command Timeout for each host. Unit: s",
 	Value: 0,
 }
 
+// ConnectTimeoutFlag `--connect-timeout`
+var ConnectTimeoutFlag = cli.IntFlag{
+	Name:   "connect-timeout",
+	Usage:  "Connect Timeout for each host. Unit: s",
+	EnvVar: "CONNECT_TIMEOUT",
+	Value:  0,
+}
+
+// DeadlineFlag `--deadline`
+var DeadlineFlag = cli.IntFlag{
+	Name:  "deadline",
+	Usage: "Deadline for the whole run. Hosts left are marked as timed out. Unit: s",
+	Value: 0,
+}
+
+// KeepAliveFlag `--keepalive`
+var KeepAliveFlag = cli.IntFlag{
+	Name:   "keepalive",
+	Usage:  "Interval of SSH keepalive messages. Unit: s",
+	EnvVar: "KEEPALIVE",
+	Value:  0,
+}
+
 // RetryFlag `--retry`
 var RetryFlag = cli.IntFlag{
-	Name:  "retry",
-	Usage: "Retry",
-	Value: 0,
+	Name:   "retry",
+	Usage:  "How many times to retry a failed host",
+	EnvVar: "RETRY",
+	Value:  0,
+}
+
+// RetryBackoffFlag `--retry-backoff`
+var RetryBackoffFlag = cli.DurationFlag{
+	Name:   "retry-backoff",
+	Usage:  "Delay before first retry. It doubles for each retry, with jitter",
+	EnvVar: "RETRY_BACKOFF",
+	Value:  time.Second,
+}
+
+// RetryOnFlag `--retry-on`
+var RetryOnFlag = cli.StringFlag{
+	Name:   "retry-on",
+	Usage:  "Phase to retry: connect or exec (exec implies connect)",
+	EnvVar: "RETRY_ON",
+	Value:  executor.RetryConnect,
+}
+
+// RetryCodesFlag `--retry-codes`
+var RetryCodesFlag = cli.StringFlag{
+	Name:  "retry-codes",
+	Usage: "Exit codes that make exec retried, e.g. 1,255 (Default: any non-zero code). Implies --retry-on exec",
+}
+
+// PTYFlag `--pty`
+var PTYFlag = cli.BoolFlag{
+	Name:  "pty",
+	Usage: "Request a pseudo-terminal for the command",
+}
+
+// SudoFlag `--sudo`
+var SudoFlag = cli.BoolFlag{
+	Name:  "sudo",
+	Usage: "Run command with sudo (implies --pty). Password prompt is answered with -p/--password",
+}
+
+// SudoUserFlag `--sudo-user`
+var SudoUserFlag = cli.StringFlag{
+	Name:  "sudo-user",
+	Usage: "Run command as this user with sudo (implies --sudo)",
+	Value: "root",
+}
+
+// StdinFileFlag `-i`
+var StdinFileFlag = cli.StringFlag{
+	Name:  "stdin-file, i",
+	Usage: "Stream this file (`-` for Pipe/HereDoc) into stdin of every host's command. Runs all hosts at once",
+}
+
+// WorkerOptFlag `-o`
+var WorkerOptFlag = cli.StringSliceFlag{
+	Name:  "worker-opt, o",
+	Usage: "Worker specific option in format of `key=value`, e.g. fixture=hosts.json for mock worker",
+}
+
+// DryRunFlag `--dry-run`
+var DryRunFlag = cli.BoolFlag{
+	Name:  "dry-run",
+	Usage: "Show what would be run on each host, without touching any host",
+}
+
+// TemplateFlag `--template`
+var TemplateFlag = cli.BoolFlag{
+	Name:  "template",
+	Usage: "Render command as Go template for each host. Fields: {{.Host}} {{.Port}} {{.Alias}} {{.User}} {{.Index}}",
 }
 
 // WindowFlag `-w`
@@ -116,10 +210,10 @@ func Init() {
 
 func getPipe(used string) (data string) {
 	app := command.Instance()
-	switch app.Pipe {
+	switch app.ReadPipe() {
 	case "":
 		fmt.Printf("Cannot Get %s: Pipe/HereDoc Empty.\n", strings.Split(used, "USED_BY_")[1])
-	case PIPEUSEDBYHOSTLIST, PIPEUSEDBYCMD:
+	case PIPEUSEDBYHOSTLIST, PIPEUSEDBYCMD, PIPEUSEDBYSTDIN:
 		fmt.Printf("Cannot Get %s From Pipe/HereDoc since it's used by *%s*.\n", strings.Split(used, "USED_BY_")[1], strings.Split(app.Pipe, "USED_BY_")[1])
 	default:
 		data = app.Pipe
@@ -130,6 +224,29 @@ func getPipe(used string) (data string) {
 	return
 }
 
+// GetStdin opens the stream for StdinFileFlag. `-` stands for Pipe/HereDoc.
+func GetStdin(file string) (reader io.Reader, err error) {
+	if file != "-" {
+		return os.Open(file)
+	}
+	app := command.Instance()
+	switch app.Pipe {
+	case PIPEUSEDBYHOSTLIST, PIPEUSEDBYCMD:
+		err = fmt.Errorf("Cannot Get STDIN From Pipe/HereDoc since it's used by *%s*.", strings.Split(app.Pipe, "USED_BY_")[1])
+		return
+	}
+	reader = app.PipeReader()
+	if reader == nil && app.Pipe != "" {
+		reader = strings.NewReader(app.Pipe)
+	}
+	if reader == nil {
+		err = fmt.Errorf("Cannot Get STDIN: Pipe/HereDoc Empty.")
+		return
+	}
+	app.Pipe = PIPEUSEDBYSTDIN
+	return
+}
+
 // GetHostList gets hostlist from flag/pipe
 //   @hostsArg: argument for hostlist to generate HostInfoList
 //   @prefer: preferred method to get hostlist(PreferFlag)
@@ -184,19 +301,61 @@ func SetupFormatter(c *cli.Context, exe *executor.Executor) (err error) {
 	if nil == exe.Parameter.HostInfoList {
 		return errors.New("Cannot SetupFormatter Before Hostlist is set")
 	}
-	user := exe.Parameter.User
-	formatter.SetInfo(user, int64(c.Int("concurrency")))
+	info := formatter.Info{
+		User:        exe.Parameter.User,
+		Concurrency: int64(c.Int("concurrency")),
+		Hosts:       exe.Parameter.HostInfoList,
+	}
 	if c.Bool("json") {
 		exe.AddFormatter("merge", formatter.NewJSONFormatter())
 	} else if c.Bool("window") {
-		wf := formatter.NewWindowFormatter()
+		wf := formatter.NewWindowFormatter(info)
 		exe.AddFormatter("rt", wf)
 	} else {
-		exe.AddFormatter("rt", formatter.NewAnsiFormatter())
+		exe.AddFormatter("rt", formatter.NewAnsiFormatter(info))
 	}
 	return
 }
 
+// GetRetryPolicy translates retry flags into RetryPolicy
+func GetRetryPolicy(c *cli.Context) (policy executor.RetryPolicy, err error) {
+	policy = executor.NewRetryPolicy(c.Int("retry"))
+	policy.Backoff = c.Duration("retry-backoff")
+	switch c.String("retry-on") {
+	case executor.RetryConnect, "":
+	case executor.RetryExec:
+		policy.Exec = true
+	default:
+		err = fmt.Errorf("Unknown Retry Phase: %s", c.String("retry-on"))
+		return
+	}
+	if codes := c.String("retry-codes"); codes != "" {
+		policy.Exec = true
+		for _, field := range strings.Split(codes, ",") {
+			code, e := strconv.Atoi(strings.TrimSpace(field))
+			if e != nil {
+				err = fmt.Errorf("Invalid Exit Code: %s", field)
+				return
+			}
+			policy.ExitCodes = append(policy.ExitCodes, code)
+		}
+	}
+	return
+}
+
+// GetWorkerOptions parses WorkerOptFlag
+func GetWorkerOptions(opts []string) (map[string]string, error) {
+	options := make(map[string]string, len(opts))
+	for _, opt := range opts {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("Invalid Worker Option: %s. Should be key=value", opt)
+		}
+		options[kv[0]] = kv[1]
+	}
+	return options, nil
+}
+
 // SetupParameter translates cli flags into Parameter
 func SetupParameter(c *cli.Context) executor.Parameter {
 	var passwd string
@@ -205,6 +364,20 @@ func SetupParameter(c *cli.Context) executor.Parameter {
 		fmt.Printf("Password: ")
 		passwd = string(util.GetPasswd())
 	}
+	retry, err := GetRetryPolicy(c)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	options, err := GetWorkerOptions(c.StringSlice("worker-opt"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	var sudoUser string
+	if c.Bool("sudo") || c.IsSet("sudo-user") {
+		sudoUser = c.String("sudo-user")
+	}
 	return executor.Parameter{
 		User:        c.String("user"),
 		Passwd:      passwd,
@@ -212,7 +385,16 @@ func SetupParameter(c *cli.Context) executor.Parameter {
 		Concurrency: int64(c.Int("concurrency")),
 		Timeout:     int64(c.Int("timeout")),
 		Method:      c.String("method"),
-		Retry:       1,
+		Retry:       retry,
+
+		ConnectTimeout: int64(c.Int("connect-timeout")),
+		Deadline:       int64(c.Int("deadline")),
+		KeepAlive:      int64(c.Int("keepalive")),
+		PTY:            c.Bool("pty"),
+		SudoUser:       sudoUser,
+		Options:        options,
+		DryRun:         c.Bool("dry-run"),
+		Template:       c.Bool("template"),
 	}
 }
 
@@ -230,10 +412,43 @@ func PrepareExecutor(c *cli.Context) *executor.Executor {
 		os.Exit(1)
 	}
 	exec.SetHostInfoList(list)
+	if file := c.String("stdin-file"); file != "" {
+		stdin, err := GetStdin(file)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		exec.Parameter.Stdin = stdin
+		exec.Parameter.Concurrency = -1
+	}
 	SetupFormatter(c, exec)
+	registerCancelHandler(exec)
 	return exec
 }
 
+// registerCancelHandler cancels @exec on C-c. Cancelled run returns as usual,
+// so caller shows what's done and exits with its own code.
+func registerCancelHandler(exec *executor.Executor) {
+	command.RegisterSignalHandler("executor", func() error {
+		if exec.Cancel() {
+			command.Handover()
+		}
+		return nil
+	}, 0)
+}
+
+// collectOutputs runs @exec, and returns outputs of hosts by alias, instead of showing them
+func collectOutputs(exec *executor.Executor) map[string]formatter.Output {
+	collector := &shellCollector{outputs: make(map[string]formatter.Output)}
+	exec.AddFormatter("collect", collector)
+	registerCancelHandler(exec)
+	if _, err := exec.RunContext(context.Background()); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	return collector.outputs
+}
+
 // Run starts gsck
 func Run() error {
 	return command.Run()
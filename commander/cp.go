@@ -20,11 +20,20 @@ func init() {
 			UserFlag,
 			HostsFlag,
 			MethodFlag,
+			WorkerOptFlag,
+			DryRunFlag,
 			PreferFlag,
 			PasswdFlag,
 			WindowFlag,
 			AccountFlag,
+			RetryFlag,
 			TimeoutFlag,
+			DeadlineFlag,
+			KeepAliveFlag,
+			ConnectTimeoutFlag,
+			RetryOnFlag,
+			RetryCodesFlag,
+			RetryBackoffFlag,
 			ConcurrencyFlag,
 			cli.StringFlag{
 				Name:  "src, s",
@@ -55,8 +64,8 @@ func scpAction(c *cli.Context) {
 		exec.SetTransfer(src, c.String("dst"))
 		exec.SetTransferHook(c.String("before"), c.String("after"))
 	}
+	p2pMgr := p2p.FindMgr()
 	useP2P := func() {
-		p2pMgr := p2p.GetMgr()
 		p2pMgr.SetTransfer(src, c.String("dst"))
 		err := p2pMgr.Mkseed()
 		if err != nil {
@@ -71,7 +80,7 @@ func scpAction(c *cli.Context) {
 		exec.Parameter.Cmd = cmd
 		exec.Parameter.Concurrency = -1
 	}
-	if !p2p.Available() {
+	if p2pMgr == nil {
 		useScp()
 	} else if util.IsDir(src) {
 		useP2P()
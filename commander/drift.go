@@ -0,0 +1,266 @@
+package commander
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lidongpeng36/gsck/command"
+	"github.com/lidongpeng36/gsck/executor"
+	"github.com/lidongpeng36/gsck/util"
+	"github.com/mgutz/ansi"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command.RegisterCommand(cli.Command{
+		Name:  "drift",
+		Usage: "Compare a file (or command output) of hosts, against a baseline",
+		Description: "Hosts are grouped by content, and each variant is shown as a unified diff against\n" +
+			"   the baseline: a host, a local file, or the majority variant by default.\n" +
+			"   Exit code is the count of hosts that differ from baseline (or failed).",
+		Flags: []cli.Flag{
+			JSONFlag,
+			UserFlag,
+			HostsFlag,
+			MethodFlag,
+			WorkerOptFlag,
+			PreferFlag,
+			PasswdFlag,
+			PasswordFlag,
+			SudoFlag,
+			SudoUserFlag,
+			AccountFlag,
+			RetryFlag,
+			TimeoutFlag,
+			ConnectTimeoutFlag,
+			ConcurrencyFlag,
+			cli.StringFlag{
+				Name:  "file",
+				Usage: "`PATH` of file on hosts",
+			},
+			cli.StringFlag{
+				Name:  "cmd",
+				Usage: "Compare output of `CMD`, instead of a file",
+			},
+			cli.StringFlag{
+				Name:  "baseline, b",
+				Usage: "Alias of a host, or a local `FILE` (Default: the majority variant)",
+			},
+			cli.BoolFlag{
+				Name:  "hash",
+				Usage: "Fetch SHA256 of content only, and group hosts without diff",
+			},
+			cli.IntFlag{
+				Name:  "context, U",
+				Value: 3,
+				Usage: "`N` lines of context in diff",
+			},
+		},
+		Action: driftAction,
+	})
+}
+
+// driftVariant is content shared by a group of hosts
+type driftVariant struct {
+	Index    int      `json:"index"`
+	Hash     string   `json:"hash"`
+	Hosts    []string `json:"hosts"`
+	Baseline bool     `json:"baseline"`
+	Diff     string   `json:"diff,omitempty"`
+	content  string
+}
+
+// driftFailure is a host whose content could not be fetched
+type driftFailure struct {
+	Alias string `json:"alias"`
+	Error string `json:"error"`
+}
+
+type driftReport struct {
+	// Baseline describes where baseline comes from: majority, host ALIAS or file PATH
+	Baseline string          `json:"baseline"`
+	Variants []*driftVariant `json:"variants"`
+	Failed   []*driftFailure `json:"failed"`
+	// Drifted is count of hosts that differ from baseline
+	Drifted int `json:"drifted"`
+}
+
+// driftCmd returns command that prints content (or its hash) of @file, or output of @cmd
+func driftCmd(file, cmd string, hash bool) string {
+	if file != "" {
+		cmd = "cat -- " + util.ShellQuote(file)
+	}
+	if hash {
+		return "(" + cmd + ") | sha256sum | cut -d' ' -f1"
+	}
+	return cmd
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// printDrift shows variants in a table, followed by their diffs
+func printDrift(report *driftReport) {
+	fmt.Printf("Baseline: %s\n\n", report.Baseline)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VARIANT\tHOSTS\tSHA256\tMEMBERS")
+	for _, v := range report.Variants {
+		index := fmt.Sprint(v.Index)
+		if v.Baseline {
+			index += "*"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%.12s\t%s\n", index, len(v.Hosts), v.Hash, strings.Join(v.Hosts, ","))
+	}
+	for _, f := range report.Failed {
+		fmt.Fprintf(w, "failed\t1\t\t%s: %s\n", f.Alias, strings.Replace(f.Error, "\n", " ", -1))
+	}
+	_ = w.Flush()
+	for _, v := range report.Variants {
+		if v.Diff == "" {
+			continue
+		}
+		fmt.Println()
+		for _, line := range strings.Split(strings.TrimSuffix(v.Diff, "\n"), "\n") {
+			switch {
+			case strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"):
+				line = ansi.Color(line, "white+b")
+			case strings.HasPrefix(line, "@@"):
+				line = ansi.Color(line, "cyan")
+			case strings.HasPrefix(line, "-"):
+				line = ansi.Color(line, "red")
+			case strings.HasPrefix(line, "+"):
+				line = ansi.Color(line, "green")
+			}
+			fmt.Println(line)
+		}
+	}
+}
+
+// DRIFT Action (gsck drift ...)
+func driftAction(c *cli.Context) {
+	file, cmd, hash := c.String("file"), c.String("cmd"), c.Bool("hash")
+	if (file == "") == (cmd == "") {
+		fmt.Println("Either --file or --cmd is required")
+		os.Exit(1)
+	}
+	list, err := GetHostList(c.String("hosts"), c.String("prefer"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	exec, err := executor.NewExecutor(SetupParameter(c))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	exec.SetHostInfoList(list)
+	exec.Parameter.Cmd = driftCmd(file, cmd, hash)
+	if !c.IsSet("concurrency") {
+		exec.Parameter.Concurrency = 0
+	}
+	outputs := collectOutputs(exec)
+
+	// Group hosts by content, in order of hosts
+	report := &driftReport{Baseline: "majority", Variants: []*driftVariant{}, Failed: []*driftFailure{}}
+	byKey := make(map[string]*driftVariant)
+	variantOf := make(map[string]*driftVariant)
+	for _, info := range list {
+		output := outputs[info.Alias]
+		if output.ExitCode != 0 || output.Error != "" {
+			msg := strings.TrimSpace(output.Error + "\n" + output.Stderr)
+			if msg == "" {
+				msg = fmt.Sprintf("Exit Code %d", output.ExitCode)
+			}
+			report.Failed = append(report.Failed, &driftFailure{Alias: info.Alias, Error: msg})
+			continue
+		}
+		key := output.Stdout
+		v, ok := byKey[key]
+		if !ok {
+			v = &driftVariant{content: key, Hash: key}
+			if !hash {
+				v.Hash = sha256Hex(key)
+			}
+			byKey[key] = v
+			report.Variants = append(report.Variants, v)
+		}
+		v.Hosts = append(v.Hosts, info.Alias)
+		variantOf[info.Alias] = v
+	}
+	// Most hosts first. Stable, so ties keep order of hosts.
+	sort.SliceStable(report.Variants, func(i, j int) bool {
+		return len(report.Variants[i].Hosts) > len(report.Variants[j].Hosts)
+	})
+
+	var baseline *driftVariant
+	if name := c.String("baseline"); name != "" {
+		if v, ok := variantOf[name]; ok {
+			baseline = v
+			report.Baseline = "host " + name
+		} else if data, err := ioutil.ReadFile(name); err == nil {
+			content := strings.TrimSpace(string(data))
+			key := content
+			if hash {
+				// Hosts hash raw content
+				key = sha256Hex(string(data))
+			}
+			report.Baseline = "file " + name
+			if baseline = byKey[key]; baseline == nil {
+				baseline = &driftVariant{content: content, Hash: key, Hosts: []string{}}
+				if !hash {
+					baseline.Hash = sha256Hex(content)
+				}
+				report.Variants = append([]*driftVariant{baseline}, report.Variants...)
+			}
+		} else {
+			fmt.Printf("Baseline %s is neither a host fetched, nor a local file\n", name)
+			os.Exit(1)
+		}
+	} else if len(report.Variants) > 0 {
+		baseline = report.Variants[0]
+	}
+
+	variantName := func(v *driftVariant) string {
+		return fmt.Sprintf("variant %d: %s", v.Index, strings.Join(v.Hosts, ","))
+	}
+	for i, v := range report.Variants {
+		v.Index = i + 1
+		if v == baseline {
+			v.Baseline = true
+		} else {
+			report.Drifted += len(v.Hosts)
+		}
+	}
+	if !hash && baseline != nil {
+		baseName := strings.TrimPrefix(strings.TrimPrefix(report.Baseline, "host "), "file ")
+		if report.Baseline == "majority" {
+			baseName = variantName(baseline)
+		}
+		for _, v := range report.Variants {
+			if v != baseline {
+				v.Diff = util.UnifiedDiff(baseline.content, v.content, baseName, variantName(v), c.Int("context"))
+			}
+		}
+	}
+
+	if c.Bool("json") {
+		enc, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		fmt.Println(string(enc))
+	} else {
+		printDrift(report)
+	}
+	os.Exit(report.Drifted + len(report.Failed))
+}
@@ -0,0 +1,292 @@
+package commander
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lidongpeng36/gsck/command"
+	"github.com/lidongpeng36/gsck/config"
+	"github.com/lidongpeng36/gsck/ensure"
+	"github.com/lidongpeng36/gsck/executor"
+	"github.com/lidongpeng36/gsck/hostlist"
+	"github.com/lidongpeng36/gsck/util"
+	"github.com/urfave/cli"
+)
+
+// ensureFlags returns flags shared by subcommands of ensure, followed by @flags
+func ensureFlags(flags ...cli.Flag) []cli.Flag {
+	return append([]cli.Flag{
+		JSONFlag,
+		UserFlag,
+		HostsFlag,
+		MethodFlag,
+		WorkerOptFlag,
+		PreferFlag,
+		PasswdFlag,
+		PasswordFlag,
+		SudoFlag,
+		SudoUserFlag,
+		TemplateFlag,
+		AccountFlag,
+		RetryFlag,
+		TimeoutFlag,
+		ConnectTimeoutFlag,
+		KeepAliveFlag,
+		ConcurrencyFlag,
+		cli.StringFlag{
+			Name:  "path",
+			Usage: "`PATH` on hosts",
+		},
+		cli.BoolFlag{
+			Name:  "check",
+			Usage: "Report pending changes, without applying them",
+		},
+		cli.StringFlag{
+			Name:  "after, a",
+			Usage: "`CMD` run on hosts where changes are applied, e.g. to reload a service",
+		},
+	}, flags...)
+}
+
+func init() {
+	command.RegisterCommand(cli.Command{
+		Name:  "ensure",
+		Usage: "Bring files on hosts into a state, and report which hosts are changed",
+		Description: "Hosts already in the state are left untouched. With --template, --path and --line\n" +
+			"   (or content of --src for `ensure file`) are rendered for each host.",
+		Subcommands: []cli.Command{
+			{
+				Name:  "line",
+				Usage: "Ensure a line is in a file (or not, with --absent)",
+				Flags: ensureFlags(
+					cli.StringFlag{
+						Name:  "line, l",
+						Usage: "The whole `LINE`",
+					},
+					cli.StringFlag{
+						Name:  "match, r",
+						Usage: "Lines matching extended regular expression `RE` are replaced by --line (or removed, with --absent)",
+					},
+					cli.BoolFlag{
+						Name:  "absent",
+						Usage: "Ensure the line is not in file",
+					},
+				),
+				Action: ensureLineAction,
+			},
+			{
+				Name:  "file",
+				Usage: "Ensure a file has content of a local file, and mode",
+				Flags: ensureFlags(
+					cli.StringFlag{
+						Name:  "src, s",
+						Usage: "Local `FILE` with the content",
+					},
+					cli.StringFlag{
+						Name:  "mode",
+						Usage: "Octal `MODE`, e.g. 0644 (Default: kept, or mode of --src for new file)",
+					},
+				),
+				Action: ensureFileAction,
+			},
+			{
+				Name:  "dir",
+				Usage: "Ensure a directory exists, with mode",
+				Flags: ensureFlags(
+					cli.StringFlag{
+						Name:  "mode",
+						Usage: "Octal `MODE`, e.g. 0755 (Default: kept, or by umask for new directory)",
+					},
+				),
+				Action: ensureDirAction,
+			},
+		},
+	})
+}
+
+// ensureReport is status of a host
+type ensureReport struct {
+	Alias  string `json:"alias"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ensureOptions checks common flags
+func ensureOptions(c *cli.Context) (string, ensure.Options) {
+	if c.String("path") == "" {
+		fmt.Println("--path is required")
+		os.Exit(1)
+	}
+	return c.String("path"), ensure.Options{Check: c.Bool("check"), After: c.String("after")}
+}
+
+// ensureMode checks --mode
+func ensureMode(c *cli.Context) string {
+	mode, err := ensure.NormalizeMode(c.String("mode"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return mode
+}
+
+// runEnsure runs @cmd on hosts (Cmd of host wins if it's set), after @setup is applied on executor.
+// It prints status of each host, and exits with count of failed hosts.
+func runEnsure(c *cli.Context, list hostlist.HostInfoList, cmd string, setup func(*executor.Executor)) {
+	exec, err := executor.NewExecutor(SetupParameter(c))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	exec.SetHostInfoList(list)
+	exec.Parameter.Cmd = cmd
+	if setup != nil {
+		setup(exec)
+	}
+	outputs := collectOutputs(exec)
+
+	reports := make([]*ensureReport, len(list))
+	counts := make(map[string]int)
+	failed := 0
+	for i, info := range list {
+		report := &ensureReport{Alias: info.Alias}
+		output := outputs[info.Alias]
+		result := ensure.Parse(output.Stdout)
+		if output.ExitCode != 0 || output.Error != "" || result == nil {
+			report.Status = "failed"
+			report.Error = strings.TrimSpace(output.Error + "\n" + output.Stderr)
+			if report.Error == "" {
+				report.Error = fmt.Sprintf("exit code %d", output.ExitCode)
+			}
+			failed++
+		} else {
+			report.Status, report.Detail = result.Status, result.Detail
+		}
+		counts[report.Status]++
+		reports[i] = report
+	}
+	if c.Bool("json") {
+		enc, err := json.MarshalIndent(reports, "", "    ")
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		fmt.Println(string(enc))
+		os.Exit(failed)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tSTATUS\tDETAIL")
+	for _, report := range reports {
+		detail := report.Detail
+		if report.Error != "" {
+			// Last line tells the most
+			lines := strings.Split(report.Error, "\n")
+			detail = lines[len(lines)-1]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", report.Alias, report.Status, detail)
+	}
+	_ = w.Flush()
+	var summary []string
+	for _, status := range []string{ensure.Changed, ensure.Pending, ensure.Unchanged, "failed"} {
+		if counts[status] > 0 {
+			summary = append(summary, fmt.Sprintf("%s: %d", status, counts[status]))
+		}
+	}
+	fmt.Printf("Total: %d, %s\n", len(reports), strings.Join(summary, ", "))
+	os.Exit(failed)
+}
+
+// ensureHosts returns hosts from flags
+func ensureHosts(c *cli.Context) hostlist.HostInfoList {
+	list, err := GetHostList(c.String("hosts"), c.String("prefer"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return list
+}
+
+// ENSURE LINE Action (gsck ensure line ...)
+func ensureLineAction(c *cli.Context) {
+	file, opt := ensureOptions(c)
+	if !c.IsSet("line") && !(c.Bool("absent") && c.IsSet("match")) {
+		fmt.Println("--line is required")
+		os.Exit(1)
+	}
+	cmd := ensure.Line(file, c.String("line"), c.String("match"), c.Bool("absent"), opt)
+	runEnsure(c, ensureHosts(c), cmd, nil)
+}
+
+// ENSURE DIR Action (gsck ensure dir ...)
+func ensureDirAction(c *cli.Context) {
+	dir, opt := ensureOptions(c)
+	runEnsure(c, ensureHosts(c), ensure.Dir(dir, ensureMode(c), opt), nil)
+}
+
+// ENSURE FILE Action (gsck ensure file ...)
+func ensureFileAction(c *cli.Context) {
+	file, opt := ensureOptions(c)
+	mode := ensureMode(c)
+	src := c.String("src")
+	fi, err := os.Stat(src)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	} else if fi.IsDir() {
+		fmt.Println("--src should be a file")
+		os.Exit(1)
+	}
+	content, err := ioutil.ReadFile(src)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	createMode := fmt.Sprintf("%o", fi.Mode().Perm())
+	list := ensureHosts(c)
+
+	if c.Bool("template") {
+		// Content differs among hosts, so it's sent along with command of each host
+		user := c.String("user")
+		for _, info := range list {
+			host := *info
+			if host.User == "" {
+				host.User = user
+			}
+			rendered, err := executor.RenderTemplate(string(content), &host)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			info.Cmd = ensure.Embed([]byte(rendered)) + ensure.File(`"$f"`, file, mode, createMode, opt)
+		}
+		runEnsure(c, list, "", nil)
+		return
+	}
+	// Same content for all hosts, which is copied into remote tmpdir at first
+	random := make([]byte, 8)
+	if _, err = rand.Read(random); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	tmpdir := config.GetString("remote.tmpdir")
+	basename := ".gsck-ensure-" + hex.EncodeToString(random)
+	staged := path.Join(tmpdir, basename)
+	runEnsure(c, list, ensure.File(util.ShellQuote(staged), file, mode, createMode, opt), func(exec *executor.Executor) {
+		exec.Parameter.Transfer = &executor.TransferFile{
+			Data:        content,
+			Perm:        "0600",
+			Basename:    basename,
+			Destination: tmpdir,
+			Src:         src,
+			Dst:         staged,
+		}
+	})
+}
@@ -0,0 +1,168 @@
+package commander
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lidongpeng36/gsck/command"
+	"github.com/lidongpeng36/gsck/config"
+	"github.com/lidongpeng36/gsck/facts"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command.RegisterCommand(cli.Command{
+		Name:      "facts",
+		Usage:     "Gather facts of hosts, and cache them",
+		ArgsUsage: "[KEY...]",
+		Description: "Facts: " + strings.Join(facts.Keys, ", ") + ", and custom facts from config,\n" +
+			"   e.g. `gsck config custom_facts.nginx 'nginx -v 2>&1'`. Given KEYs, only those are shown.\n" +
+			"   Cached facts select hosts, e.g. `-f 'facts:kernel~^5.4,cpus>=8'`.",
+		Flags: []cli.Flag{
+			JSONFlag,
+			UserFlag,
+			HostsFlag,
+			MethodFlag,
+			WorkerOptFlag,
+			PreferFlag,
+			PasswdFlag,
+			PasswordFlag,
+			AccountFlag,
+			TimeoutFlag,
+			ConnectTimeoutFlag,
+			ConcurrencyFlag,
+			cli.BoolFlag{
+				Name:  "refresh, r",
+				Usage: "Gather facts again, even if cached ones are fresh",
+			},
+			cli.DurationFlag{
+				Name:  "ttl",
+				Usage: "Cached facts older than `TTL` are gathered again (default: facts.ttl in config, or 1h)",
+			},
+		},
+		Action: factsAction,
+	})
+}
+
+// formatMB shows size in MB like 512M, 15.6G
+func formatMB(mb int64) string {
+	if mb < 1024 {
+		return fmt.Sprintf("%dM", mb)
+	}
+	return fmt.Sprintf("%.1fG", float64(mb)/1024)
+}
+
+// formatUptime shows seconds like 12d3h, 5h20m
+func formatUptime(seconds int64) string {
+	d := time.Duration(seconds) * time.Second
+	days := int64(d / (24 * time.Hour))
+	hours := int64(d/time.Hour) % 24
+	if days > 0 {
+		return fmt.Sprintf("%dd%dh", days, hours)
+	}
+	return fmt.Sprintf("%dh%dm", hours, int64(d/time.Minute)%60)
+}
+
+// printFacts prints facts in a table, with columns of @keys or a default set
+func printFacts(list []*facts.Facts, keys []string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if len(keys) > 0 {
+		fmt.Fprintf(w, "HOST\t%s\n", strings.ToUpper(strings.Join(keys, "\t")))
+	} else {
+		fmt.Fprintln(w, "HOST\tOS\tKERNEL\tCPUS\tMEMORY\tIPS\tUPTIME")
+	}
+	for _, f := range list {
+		if f.Error != "" {
+			fmt.Fprintf(w, "%s\terror: %s\n", f.Alias, strings.Replace(f.Error, "\n", " ", -1))
+			continue
+		}
+		if len(keys) > 0 {
+			values := make([]string, len(keys))
+			for i, key := range keys {
+				values[i] = strings.Join(f.Get(key), ",")
+			}
+			fmt.Fprintf(w, "%s\t%s\n", f.Alias, strings.Join(values, "\t"))
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n", f.Alias, f.OS, f.Kernel, f.CPUs,
+			formatMB(f.MemoryMB), strings.Join(f.IPs, ","), formatUptime(f.Uptime))
+	}
+	_ = w.Flush()
+}
+
+// FACTS Action (gsck facts ...)
+func factsAction(c *cli.Context) {
+	list, err := GetHostList(c.String("hosts"), c.String("prefer"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	cache, err := facts.LoadCache(facts.CacheFile())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	ttl := facts.TTL()
+	if c.IsSet("ttl") {
+		ttl = c.Duration("ttl")
+	}
+
+	result := make([]*facts.Facts, len(list))
+	missing := list[:0:0]
+	for i, info := range list {
+		if f, ok := cache.Get(info.Alias, ttl); ok && !c.Bool("refresh") {
+			result[i] = f
+		} else {
+			missing = append(missing, info)
+		}
+	}
+	if len(missing) > 0 {
+		parameter := SetupParameter(c)
+		if !c.IsSet("concurrency") {
+			// Facts are light, so as many hosts run at once as method recommends, instead of one by one
+			parameter.Concurrency = 0
+		}
+		gathered, err := facts.Gather(context.Background(), parameter, missing, config.GetSection("custom_facts"))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		byAlias := make(map[string]*facts.Facts, len(gathered))
+		for _, f := range gathered {
+			cache.Put(f)
+			byAlias[f.Alias] = f
+		}
+		for i, info := range list {
+			if result[i] == nil {
+				result[i] = byAlias[info.Alias]
+			}
+		}
+		if err = cache.Save(); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+
+	failed := 0
+	for _, f := range result {
+		if f.Error != "" {
+			failed++
+		}
+	}
+	if c.Bool("json") {
+		enc, err := json.MarshalIndent(result, "", "    ")
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		fmt.Println(string(enc))
+	} else {
+		printFacts(result, c.Args())
+	}
+	os.Exit(failed)
+}
@@ -0,0 +1,187 @@
+package commander
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lidongpeng36/gsck/command"
+	"github.com/lidongpeng36/gsck/executor"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh"
+)
+
+func init() {
+	command.RegisterCommand(cli.Command{
+		Name:  "forward",
+		Usage: "Forward local ports to an address of each host",
+		Description: "Each host gets a local port, which is forwarded to --remote from the host.\n" +
+			"   With --socks, a single SOCKS5 proxy is opened instead: `ALIAS:PORT` is forwarded to\n" +
+			"   REMOTE_HOST:PORT of host ALIAS, e.g. `curl -x socks5h://127.0.0.1:1080 http://web01:9100/`.\n" +
+			"   Connections to hosts are dialed again once broken. Press C-c to stop.",
+		Flags: []cli.Flag{
+			JSONFlag,
+			UserFlag,
+			HostsFlag,
+			MethodFlag,
+			WorkerOptFlag,
+			PreferFlag,
+			PasswdFlag,
+			PasswordFlag,
+			AccountFlag,
+			ConnectTimeoutFlag,
+			KeepAliveFlag,
+			cli.StringFlag{
+				Name:  "remote, r",
+				Value: "127.0.0.1",
+				Usage: "`ADDR` to connect from hosts, HOST:PORT (or HOST for --socks)",
+			},
+			cli.StringFlag{
+				Name:  "bind, b",
+				Value: "127.0.0.1",
+				Usage: "Local `ADDR` to listen on",
+			},
+			cli.IntFlag{
+				Name:  "port, l",
+				Usage: "First local `PORT`, the others follow in order of hosts (default: random ports)",
+			},
+			cli.IntFlag{
+				Name:  "socks, D",
+				Usage: "Open a SOCKS5 proxy on local `PORT`, instead of a port for each host",
+			},
+		},
+		Action: forwardAction,
+	})
+}
+
+// longKeepAlive is keepalive interval (Unit: s) for long lived sessions, e.g. tunnels and tail,
+// unless --keepalive is set. Quiet connections are closed by NAT and firewalls without it.
+const longKeepAlive = 15
+
+// forwardErrors prints failed forwarding, at most once a while for each host
+type forwardErrors struct {
+	mu      sync.Mutex
+	aliases []string
+	last    map[int]time.Time
+}
+
+func (fe *forwardErrors) handle(index int, err error) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	if time.Since(fe.last[index]) < 5*time.Second {
+		return
+	}
+	fe.last[index] = time.Now()
+	fmt.Fprintf(os.Stderr, "[%s] forward failed: %s\n", fe.aliases[index], err)
+}
+
+// printTunnels prints mapping of local addresses and hosts
+func printTunnels(tunnels []*executor.Tunnel, status []string, inJSON bool) {
+	if inJSON {
+		type tunnelStatus struct {
+			*executor.Tunnel
+			Status string `json:"status"`
+		}
+		list := make([]tunnelStatus, len(tunnels))
+		for i, t := range tunnels {
+			list[i] = tunnelStatus{t, status[i]}
+		}
+		enc, err := json.MarshalIndent(list, "", "    ")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(string(enc))
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tLOCAL\tREMOTE\tSTATUS")
+	for i, t := range tunnels {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", t.Alias, t.Local, t.Remote, status[i])
+	}
+	_ = w.Flush()
+}
+
+// FORWARD Action (gsck forward ...)
+func forwardAction(c *cli.Context) {
+	exec := PrepareExecutor(c)
+	if !c.IsSet("keepalive") {
+		exec.Parameter.KeepAlive = longKeepAlive
+	}
+	hosts := exec.Parameter.HostInfoList
+	aliases := make([]string, len(hosts))
+	for i, info := range hosts {
+		aliases[i] = info.Alias
+	}
+	errs := &forwardErrors{aliases: aliases, last: make(map[int]time.Time)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	remote := c.String("remote")
+
+	var tunnels []*executor.Tunnel
+	if port := c.Int("socks"); port > 0 {
+		addr, err := exec.ForwardSOCKS(ctx, net.JoinHostPort(c.String("bind"), fmt.Sprint(port)), remote, errs.handle)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		tunnels = make([]*executor.Tunnel, len(hosts))
+		for i, info := range hosts {
+			tunnels[i] = &executor.Tunnel{
+				Index:  i,
+				Alias:  info.Alias,
+				Local:  "socks5://" + addr.String(),
+				Remote: net.JoinHostPort(remote, "*"),
+			}
+		}
+	} else {
+		if _, _, err := net.SplitHostPort(remote); err != nil {
+			fmt.Println("--remote should be HOST:PORT")
+			os.Exit(1)
+		}
+		var err error
+		if tunnels, err = exec.ForwardPorts(ctx, c.String("bind"), c.Int("port"), remote, errs.handle); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	// Connect to all hosts before showing the table, so that first use is fast,
+	// and hosts that are down show up at once.
+	status := make([]string, len(hosts))
+	var wg sync.WaitGroup
+	for i := range hosts {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			status[index] = "ok"
+			target := remote
+			if c.Int("socks") > 0 {
+				// Any port would do, since only connection to host matters
+				target = net.JoinHostPort(remote, "22")
+			}
+			conn, err := exec.Dial(ctx, index, "tcp", target)
+			if _, ok := err.(*ssh.OpenChannelError); ok && c.Int("socks") > 0 {
+				// Host is connected, port just refused
+				return
+			} else if err != nil {
+				status[index] = err.Error()
+				return
+			}
+			_ = conn.Close()
+		}(i)
+	}
+	wg.Wait()
+	printTunnels(tunnels, status, c.Bool("json"))
+
+	command.StopSignal()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+}
@@ -0,0 +1,165 @@
+package commander
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lidongpeng36/gsck/command"
+	"github.com/lidongpeng36/gsck/executor"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh"
+)
+
+func init() {
+	command.RegisterCommand(cli.Command{
+		Name:  "keyscan",
+		Usage: "Fetch host keys of hosts, and manage known_hosts",
+		Description: "Prints fingerprints of host keys. With --diff, each key is compared with known_hosts\n" +
+			"   (--known-hosts, default: config `ssh.known_hosts` or ~/.ssh/known_hosts) as new, same or changed,\n" +
+			"   and exit code is the count of hosts with changed keys.",
+		Flags: []cli.Flag{
+			HostsFlag,
+			PreferFlag,
+			ConnectTimeoutFlag,
+			ConcurrencyFlag,
+			cli.StringSliceFlag{
+				Name:  "type, t",
+				Usage: "Key types to scan: ed25519, ecdsa, rsa (default: all)",
+			},
+			cli.StringFlag{
+				Name:  "write, w",
+				Usage: "Write scanned keys into `FILE`, replacing it",
+			},
+			cli.StringFlag{
+				Name:  "merge, m",
+				Usage: "Merge scanned keys into `FILE`: replace old keys of scanned hosts, and add new ones",
+			},
+			cli.BoolFlag{
+				Name:  "diff, d",
+				Usage: "Compare scanned keys with known_hosts",
+			},
+			cli.StringFlag{
+				Name:  "known-hosts",
+				Usage: "known_hosts `FILE` for --diff",
+			},
+		},
+		Action: keyscanAction,
+	})
+}
+
+// keyAlgorithms translates short names of key types
+func keyAlgorithms(types []string) ([]string, error) {
+	names := map[string]string{
+		"ed25519": ssh.KeyAlgoED25519,
+		"ecdsa":   ssh.KeyAlgoECDSA256,
+		"rsa":     ssh.KeyAlgoRSA,
+	}
+	algorithms := make([]string, 0, len(types))
+	for _, t := range types {
+		for _, name := range strings.Split(t, ",") {
+			if algorithm, ok := names[name]; ok {
+				algorithms = append(algorithms, algorithm)
+			} else if strings.Contains(name, "-") {
+				algorithms = append(algorithms, name)
+			} else {
+				return nil, fmt.Errorf("Unknown Key Type: %s", name)
+			}
+		}
+	}
+	return algorithms, nil
+}
+
+// KEYSCAN Action (gsck keyscan ...)
+func keyscanAction(c *cli.Context) {
+	algorithms, err := keyAlgorithms(c.StringSlice("type"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	exec := PrepareExecutor(c)
+	if !c.IsSet("concurrency") {
+		exec.Parameter.Concurrency = 0
+	}
+	scanned, err := exec.ScanHostKeys(context.Background(), algorithms)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	var known []byte
+	if c.Bool("diff") {
+		file := c.String("known-hosts")
+		if file == "" {
+			file = executor.KnownHostsFile()
+		}
+		if known, err = ioutil.ReadFile(file); err != nil && !os.IsNotExist(err) {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	failed, changed := 0, 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if c.Bool("diff") {
+		fmt.Fprintln(w, "HOST\tTYPE\tFINGERPRINT\tSTATUS")
+	} else {
+		fmt.Fprintln(w, "HOST\tTYPE\tFINGERPRINT")
+	}
+	for _, hk := range scanned {
+		if hk.Error != "" {
+			failed++
+			fmt.Fprintf(w, "%s\t-\t%s\n", hk.Alias, hk.Error)
+			continue
+		}
+		var status []string
+		if c.Bool("diff") {
+			status = executor.DiffKnownHosts(known, hk)
+		}
+		hostChanged := false
+		for i, key := range hk.Keys {
+			fmt.Fprintf(w, "%s\t%s\t%s", hk.Alias, key.Type(), ssh.FingerprintSHA256(key))
+			if status != nil {
+				fmt.Fprintf(w, "\t%s", status[i])
+				hostChanged = hostChanged || status[i] == executor.KeyChanged
+			}
+			fmt.Fprintln(w)
+		}
+		if hostChanged {
+			changed++
+		}
+	}
+	_ = w.Flush()
+
+	if file := c.String("write"); file != "" {
+		var lines []string
+		for _, hk := range scanned {
+			lines = append(lines, hk.Lines()...)
+		}
+		if err = ioutil.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+	if file := c.String("merge"); file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		if err = ioutil.WriteFile(file, executor.MergeKnownHosts(data, scanned), 0644); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+	fmt.Printf("\nTotal: %d, Failed: %d", len(scanned), failed)
+	if c.Bool("diff") {
+		fmt.Printf(", Changed: %d", changed)
+		fmt.Println()
+		os.Exit(changed)
+	}
+	fmt.Println()
+	os.Exit(failed)
+}
@@ -0,0 +1,150 @@
+package commander
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lidongpeng36/gsck/command"
+	"github.com/lidongpeng36/gsck/formatter"
+	"github.com/lidongpeng36/gsck/hostlist"
+	"github.com/lidongpeng36/gsck/playbook"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command.RegisterCommand(cli.Command{
+		Name:      "play",
+		Usage:     "Run steps of a task file on hosts, in order",
+		ArgsUsage: "TASKS.yml",
+		Description: "Steps are run, script, copy and fetch. A step may be skipped by `when`, and its result\n" +
+			"   registered for later steps. Hosts that fail a step are left out of the following ones.\n" +
+			"   See package playbook for the format. C-c stops after the running step, and C-c again kills it.",
+		Flags: []cli.Flag{
+			JSONFlag,
+			UserFlag,
+			HostsFlag,
+			MethodFlag,
+			WorkerOptFlag,
+			DryRunFlag,
+			PreferFlag,
+			PasswdFlag,
+			PasswordFlag,
+			PTYFlag,
+			SudoFlag,
+			SudoUserFlag,
+			AccountFlag,
+			RetryFlag,
+			TimeoutFlag,
+			ConnectTimeoutFlag,
+			KeepAliveFlag,
+			RetryOnFlag,
+			RetryCodesFlag,
+			RetryBackoffFlag,
+			ConcurrencyFlag,
+			cli.StringSliceFlag{
+				Name:  "var, e",
+				Usage: "Set variable `key=value`, over vars of task file. Repeatable.",
+			},
+		},
+		Action: playAction,
+	})
+}
+
+// printRecap prints counts of each host
+func printRecap(report *playbook.Report) {
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tOK\tFAILED\tIGNORED\tSKIPPED\tFAILED STEP")
+	for _, recap := range report.Recap {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\n", recap.Alias, recap.OK, recap.Failed, recap.Ignored, recap.Skipped, recap.FailedStep)
+	}
+	_ = w.Flush()
+}
+
+// PLAY Action (gsck play ...)
+func playAction(c *cli.Context) {
+	if len(c.Args()) != 1 {
+		fmt.Println("TASKS.yml is required")
+		os.Exit(1)
+	}
+	file := c.Args()[0]
+	pb, err := playbook.Load(file)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	vars := make(map[string]string)
+	for _, kv := range c.StringSlice("var") {
+		pair := strings.SplitN(kv, "=", 2)
+		if len(pair) != 2 || pair[0] == "" {
+			fmt.Printf("Invalid Variable: %s. Should be key=value\n", kv)
+			os.Exit(1)
+		}
+		vars[pair[0]] = pair[1]
+	}
+	list, err := GetHostList(c.String("hosts"), c.String("prefer"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	// Flags win over defaults of task file
+	if c.IsSet("concurrency") {
+		pb.Concurrency = int64(c.Int("concurrency"))
+	}
+	if c.IsSet("timeout") {
+		pb.Timeout = int64(c.Int("timeout"))
+	}
+	runner := &playbook.Runner{
+		Parameter: SetupParameter(c),
+		Hosts:     list,
+		Vars:      vars,
+		Dir:       filepath.Dir(file),
+	}
+	if !c.Bool("json") {
+		runner.Out = os.Stdout
+		runner.NewFormatter = func(hosts hostlist.HostInfoList) formatter.Formatter {
+			return formatter.NewAnsiFormatter(formatter.Info{
+				User:        runner.Parameter.User,
+				Concurrency: int64(c.Int("concurrency")),
+				Hosts:       hosts,
+			})
+		}
+	}
+
+	// First C-c stops before the next step, and the second one kills the running step
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	command.StopSignal()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		runner.Stop()
+		fmt.Fprintln(os.Stderr, "Stopping after the running step. C-c again to kill it.")
+		<-interrupt
+		cancel()
+	}()
+
+	report, err := runner.Run(ctx, pb)
+	if c.Bool("json") {
+		enc, e := json.MarshalIndent(report, "", "    ")
+		if e != nil {
+			fmt.Println(e)
+			os.Exit(2)
+		}
+		fmt.Println(string(enc))
+	} else {
+		printRecap(report)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	os.Exit(report.Failed())
+}
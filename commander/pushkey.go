@@ -0,0 +1,135 @@
+package commander
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/lidongpeng36/gsck/command"
+	"github.com/lidongpeng36/gsck/util"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh"
+)
+
+func init() {
+	command.RegisterCommand(cli.Command{
+		Name:  "push-key",
+		Usage: "Add (or remove) a public key in authorized_keys of hosts",
+		Description: "Each host reports one of: added, present, removed, absent.\n" +
+			"   Keys are compared by type and base64 blob, so options and comment do not matter.\n" +
+			"   Use --passwd for first-time bootstrap, and --sudo-user to manage keys of another user.",
+		Flags: []cli.Flag{
+			JSONFlag,
+			UserFlag,
+			HostsFlag,
+			MethodFlag,
+			WorkerOptFlag,
+			DryRunFlag,
+			PreferFlag,
+			PasswdFlag,
+			PasswordFlag,
+			SudoFlag,
+			SudoUserFlag,
+			WindowFlag,
+			AccountFlag,
+			RetryFlag,
+			TimeoutFlag,
+			ConnectTimeoutFlag,
+			ConcurrencyFlag,
+			cli.StringFlag{
+				Name:  "key, k",
+				Usage: "Public key file, e.g. ~/.ssh/id_rsa.pub",
+			},
+			cli.BoolFlag{
+				Name:  "remove, r",
+				Usage: "Remove the key instead",
+			},
+		},
+		Action: pushKeyAction,
+	})
+}
+
+// readPublicKey reads the first key of authorized_keys format @file.
+// It returns the whole line, and `type base64` that identifies the key.
+func readPublicKey(file string) (line, blob string, err error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+	key, comment, options, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		err = fmt.Errorf("Invalid Public Key %s: %v", file, err)
+		return
+	}
+	blob = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	for _, l := range strings.Split(string(data), "\n") {
+		if strings.Contains(l, blob) {
+			line = strings.TrimSpace(l)
+			break
+		}
+	}
+	// Fields are not separated by a single space, e.g. by tab, so line is built from what's parsed
+	if line == "" {
+		line = blob
+		if len(options) > 0 {
+			line = strings.Join(options, ",") + " " + line
+		}
+		if comment != "" {
+			line += " " + comment
+		}
+	}
+	return
+}
+
+// authorizedKeysCmd returns shell commands that add @line into authorized_keys of current user
+// (or remove lines containing @blob), and print what happened.
+// ~/.ssh and authorized_keys are created with 700 and 600 if missing.
+// $HOME is taken only if it's owned by current user, since sudo may keep HOME of the calling user.
+func authorizedKeysCmd(line, blob string, remove bool) string {
+	script := []string{
+		"umask 077",
+		`home=$HOME; [ -n "$home" ] && [ -O "$home" ] || home=$(eval echo ~$(id -un))`,
+		`f="$home/.ssh/authorized_keys"`,
+		"blob=" + util.ShellQuote(blob),
+	}
+	if remove {
+		script = append(script,
+			`if [ ! -f "$f" ] || ! grep -qF "$blob" "$f"; then echo absent; exit 0; fi`,
+			// Rewrite in place, to keep owner and perm
+			`grep -vF "$blob" "$f" > "$f.gsck" ; cat "$f.gsck" > "$f" && rm -f "$f.gsck" && echo removed`,
+		)
+	} else {
+		script = append(script,
+			"line="+util.ShellQuote(line),
+			`mkdir -p "$home/.ssh" && chmod 700 "$home/.ssh" && touch "$f" && chmod 600 "$f" || exit 1`,
+			`if grep -qF "$blob" "$f"; then echo present; exit 0; fi`,
+			// Make sure key starts on a new line
+			`if [ -s "$f" ] && [ -n "$(tail -c 1 "$f")" ]; then echo >> "$f"; fi`,
+			`echo "$line" >> "$f" && echo added`,
+		)
+	}
+	return strings.Join(script, "\n")
+}
+
+// PUSH-KEY Action (gsck push-key ...)
+func pushKeyAction(c *cli.Context) {
+	file := c.String("key")
+	if file == "" {
+		fmt.Println("Public key file is required: --key FILE")
+		os.Exit(1)
+	}
+	line, blob, err := readPublicKey(file)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	exec := PrepareExecutor(c)
+	exec.Parameter.Cmd = authorizedKeysCmd(line, blob, c.Bool("remove"))
+	failed, err := exec.Run()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	os.Exit(failed)
+}
@@ -0,0 +1,115 @@
+package commander
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lidongpeng36/gsck/executor"
+	"github.com/lidongpeng36/gsck/formatter"
+	"github.com/lidongpeng36/gsck/hostlist"
+	"golang.org/x/crypto/ssh"
+)
+
+// runLocal runs @cmd on a host with local worker, and returns its output
+func runLocal(t *testing.T, cmd string) formatter.Output {
+	exec, err := executor.NewExecutor(executor.Parameter{Method: "local", Cmd: cmd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec.SetHostInfoList(hostlist.MakeHostInfoListFromStringList([]string{"web01"}))
+	collector := &shellCollector{outputs: make(map[string]formatter.Output)}
+	exec.AddFormatter("test", collector)
+	if _, err = exec.RunContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return collector.outputs["web01"]
+}
+
+func TestAuthorizedKeysCmd(t *testing.T) {
+	home, err := ioutil.TempDir("", "gsck-pushkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+	file := filepath.Join(home, ".ssh", "authorized_keys")
+	blob := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHg"
+	line := `from="10.0.0.1" ` + blob + " deploy@ci"
+	expect := func(remove bool, status string) {
+		t.Helper()
+		output := runLocal(t, authorizedKeysCmd(line, blob, remove))
+		if output.ExitCode != 0 || output.Stdout != status {
+			t.Fatalf("Got %q (%d), expected %s: %s", output.Stdout, output.ExitCode, status, output.Stderr)
+		}
+	}
+	content := func() string {
+		data, _ := ioutil.ReadFile(file)
+		return string(data)
+	}
+
+	expect(false, "added")
+	for path, mode := range map[string]os.FileMode{filepath.Dir(file): 0700, file: 0600} {
+		if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != mode {
+			t.Fatalf("Mode of %s: %v, %v", path, fi.Mode(), err)
+		}
+	}
+	expect(false, "present")
+	if got := content(); got != line+"\n" {
+		t.Fatalf("Unexpected content: %q", got)
+	}
+
+	// Key starts on a new line, even if file does not end with one
+	other := "ssh-rsa AAAAB3NzaC1yc2E other@host"
+	if err = ioutil.WriteFile(file, []byte(other), 0600); err != nil {
+		t.Fatal(err)
+	}
+	expect(false, "added")
+	if got := content(); got != other+"\n"+line+"\n" {
+		t.Fatalf("Unexpected content: %q", got)
+	}
+
+	expect(true, "removed")
+	expect(true, "absent")
+	if got := content(); got != other+"\n" {
+		t.Fatalf("Unexpected content: %q", got)
+	}
+}
+
+func TestReadPublicKey(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	file, err := ioutil.TempFile("", "gsck-pushkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	for text, expected := range map[string]string{
+		blob + " deploy@ci\n": blob + " deploy@ci",
+		// Separated by tab
+		strings.Replace(blob, " ", "\t", 1) + "\tdeploy@ci\n": blob + " deploy@ci",
+		`from="10.0.0.1"` + "\t" + strings.Replace(blob, " ", "\t", 1) + "\n": `from="10.0.0.1" ` + blob,
+	} {
+		if err = ioutil.WriteFile(file.Name(), []byte(text), 0600); err != nil {
+			t.Fatal(err)
+		}
+		line, b, err := readPublicKey(file.Name())
+		if err != nil || line != expected || b != blob {
+			t.Fatalf("%q: got %q, %q, %v", text, line, b, err)
+		}
+	}
+}
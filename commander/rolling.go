@@ -0,0 +1,153 @@
+package commander
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lidongpeng36/gsck/command"
+	"github.com/lidongpeng36/gsck/rolling"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command.RegisterCommand(cli.Command{
+		Name:  "rolling-restart",
+		Usage: "Run an action batch by batch, and wait until hosts are healthy before the next batch",
+		Description: "After the action, --health is polled on each host of the batch until it succeeds,\n" +
+			"   or --health-timeout is hit. Rollout halts once a host fails its action or health check,\n" +
+			"   and hosts left are untouched. C-c halts after the running batch, and C-c again kills it.",
+		Flags: []cli.Flag{
+			JSONFlag,
+			UserFlag,
+			HostsFlag,
+			MethodFlag,
+			WorkerOptFlag,
+			PreferFlag,
+			PasswdFlag,
+			PasswordFlag,
+			PTYFlag,
+			SudoFlag,
+			SudoUserFlag,
+			AccountFlag,
+			TimeoutFlag,
+			ConnectTimeoutFlag,
+			KeepAliveFlag,
+			cli.StringFlag{
+				Name:  "cmd",
+				Usage: "Action `CMD`, e.g. 'systemctl restart app'",
+			},
+			cli.StringFlag{
+				Name:  "health",
+				Usage: "`CMD` that succeeds once host is healthy, e.g. 'curl -sf localhost:8080/health'",
+			},
+			cli.IntFlag{
+				Name:  "batch",
+				Value: 1,
+				Usage: "`N` hosts in a batch",
+			},
+			cli.DurationFlag{
+				Name:  "health-timeout",
+				Value: time.Minute,
+				Usage: "How long to wait for a host to become healthy",
+			},
+			cli.DurationFlag{
+				Name:  "health-interval",
+				Value: 2 * time.Second,
+				Usage: "Interval of health checks",
+			},
+			cli.DurationFlag{
+				Name:  "pause",
+				Usage: "Wait between batches",
+			},
+		},
+		Action: rollingAction,
+	})
+}
+
+// printRollout prints status of each host, and counts
+func printRollout(report []*rolling.Host) {
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tBATCH\tSTATUS\tDETAIL")
+	counts := make(map[string]int)
+	for _, host := range report {
+		counts[host.Status]++
+		detail := ""
+		switch host.Status {
+		case rolling.Done:
+			if host.Healthy > 0 {
+				detail = "healthy after " + (time.Duration(host.Healthy * float64(time.Second))).Round(time.Second).String()
+			}
+		case rolling.Failed:
+			detail = host.Phase + ": " + host.Error
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", host.Alias, host.Batch, host.Status, detail)
+	}
+	_ = w.Flush()
+	fmt.Printf("Done: %d, Failed: %d, Untouched: %d\n", counts[rolling.Done], counts[rolling.Failed], counts[rolling.Untouched])
+}
+
+// ROLLING-RESTART Action (gsck rolling-restart ...)
+func rollingAction(c *cli.Context) {
+	if c.String("cmd") == "" {
+		fmt.Println("--cmd is required")
+		os.Exit(1)
+	}
+	if c.Int("batch") < 1 {
+		fmt.Println("--batch should be at least 1")
+		os.Exit(1)
+	}
+	list, err := GetHostList(c.String("hosts"), c.String("prefer"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	r := &rolling.Rollout{
+		Parameter:      SetupParameter(c),
+		Hosts:          list,
+		Action:         c.String("cmd"),
+		Health:         c.String("health"),
+		HealthTimeout:  c.Duration("health-timeout"),
+		HealthInterval: c.Duration("health-interval"),
+		Pause:          c.Duration("pause"),
+		Batch:          c.Int("batch"),
+	}
+	if !c.Bool("json") {
+		r.Out = os.Stdout
+	}
+
+	// First C-c halts before the next batch, and the second one kills the running batch
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	command.StopSignal()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		r.Stop()
+		fmt.Fprintln(os.Stderr, "Halting after the running batch. C-c again to kill it.")
+		<-interrupt
+		cancel()
+	}()
+
+	err = r.Start(ctx)
+	if c.Bool("json") {
+		enc, e := json.MarshalIndent(r.Report, "", "    ")
+		if e != nil {
+			fmt.Println(e)
+			os.Exit(2)
+		}
+		fmt.Println(string(enc))
+	} else {
+		printRollout(r.Report)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+}
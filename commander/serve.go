@@ -0,0 +1,125 @@
+package commander
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lidongpeng36/gsck/command"
+	"github.com/lidongpeng36/gsck/config"
+	"github.com/lidongpeng36/gsck/server"
+	"github.com/lidongpeng36/gsck/util"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command.RegisterCommand(cli.Command{
+		Name:  "serve",
+		Usage: "Serve a JSON HTTP API to submit, watch and cancel runs",
+		Description: "POST /runs, GET /runs, GET /runs/ID, GET /runs/ID/events (SSE), POST /runs/ID/cancel.\n" +
+			"   Clients send `Authorization: Bearer TOKEN`. Without --token (or serve.token in config),\n" +
+			"   a random token is printed at start. Runs use keys and config of the user serving.\n" +
+			"   Requests may use ssh only, unless --method allows more. local runs on this server, so it needs --allow-local.",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "listen, l",
+				Value: "127.0.0.1:8080",
+				Usage: "`ADDR` to listen on",
+			},
+			cli.StringSliceFlag{
+				Name:  "method",
+				Usage: "`METHOD` allowed in requests, besides ssh. Could be given more than once",
+			},
+			cli.BoolFlag{
+				Name:  "allow-local",
+				Usage: "Allow method local, which runs commands on this server as the user serving",
+			},
+			cli.StringFlag{
+				Name:   "token",
+				Usage:  "`TOKEN` required from clients",
+				EnvVar: "SERVE_TOKEN",
+			},
+			cli.StringFlag{
+				Name:  "history",
+				Usage: "`DIR` where runs are kept (default: serve.history in config, or ~/.gsck_runs)",
+			},
+			cli.IntFlag{
+				Name:  "history-limit",
+				Value: 1000,
+				Usage: "Finished runs kept in history. 0: unlimited",
+			},
+		},
+		Action: serveAction,
+	})
+}
+
+// SERVE Action (gsck serve ...)
+func serveAction(c *cli.Context) {
+	methods := []string{"ssh"}
+	for _, method := range c.StringSlice("method") {
+		if method == "local" && !c.Bool("allow-local") {
+			fmt.Println("Method local runs commands on this server. Enable it with --allow-local.")
+			os.Exit(1)
+		}
+		methods = append(methods, method)
+	}
+	if c.Bool("allow-local") {
+		methods = append(methods, "local")
+	}
+
+	dir := c.String("history")
+	if dir == "" {
+		dir = config.GetString("serve.history")
+	}
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".gsck_runs")
+	}
+	store, err := server.OpenStore(dir, c.Int("history-limit"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	token := c.String("token")
+	if token == "" {
+		token = config.GetString("serve.token")
+	}
+	if token == "" {
+		buf := make([]byte, 16)
+		_, _ = rand.Read(buf)
+		token = hex.EncodeToString(buf)
+		fmt.Printf("Token: %s\n", token)
+	}
+
+	logger := util.NewLogger("")
+	s := server.New(store, token)
+	s.Methods = methods
+	s.Logf = logger.Info
+	httpServer := &http.Server{Addr: c.String("listen"), Handler: s}
+
+	command.StopSignal()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		logger.Info("shutting down, running ones are cancelled")
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		// Cancelled first, so event streams end
+		s.Close()
+		_ = httpServer.Shutdown(ctx)
+	}()
+
+	logger.Info("serving on %s, history in %s, methods: %s", c.String("listen"), dir, strings.Join(methods, ","))
+	if err = httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+}
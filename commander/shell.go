@@ -0,0 +1,375 @@
+package commander
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lidongpeng36/gsck/command"
+	"github.com/lidongpeng36/gsck/config"
+	"github.com/lidongpeng36/gsck/executor"
+	"github.com/lidongpeng36/gsck/formatter"
+	"github.com/lidongpeng36/gsck/hostlist"
+	"github.com/lidongpeng36/gsck/util"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+func init() {
+	command.RegisterCommand(cli.Command{
+		Name:  "shell",
+		Usage: "Run commands on hosts interactively, over the same connections",
+		Description: "Each line is run on all active hosts, with identical outputs grouped together.\n" +
+			"   `cd DIR` is remembered for each host. Built-ins:\n" + shellUsage,
+		Flags: []cli.Flag{
+			UserFlag,
+			HostsFlag,
+			MethodFlag,
+			WorkerOptFlag,
+			PreferFlag,
+			PasswdFlag,
+			PasswordFlag,
+			PTYFlag,
+			SudoFlag,
+			SudoUserFlag,
+			JSONFlag,
+			AccountFlag,
+			TimeoutFlag,
+			ConnectTimeoutFlag,
+			KeepAliveFlag,
+			ConcurrencyFlag,
+		},
+		Action: shellAction,
+	})
+}
+
+const shellUsage = `   :hosts                  list active hosts
+   :only failed|PATTERN..  keep hosts failed in last command, or matching glob PATTERN
+   :exclude PATTERN..      remove hosts matching glob PATTERN
+   :all                    make all hosts active again
+   :history                show history
+   :help                   show this help
+   :quit                   quit (or C-d)`
+
+// shellCollector remembers result of each host in last command
+type shellCollector struct {
+	mu      sync.Mutex
+	outputs map[string]formatter.Output
+}
+
+func (sc *shellCollector) Add(output formatter.Output) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.outputs[output.Alias] = output
+}
+
+func (sc *shellCollector) Print() {}
+
+type shell struct {
+	c         *cli.Context
+	parameter executor.Parameter
+	hosts     hostlist.HostInfoList
+	active    map[string]bool
+	failed    map[string]bool
+	cwd       map[string]string
+	history   []string
+	// historyFile keeps history between sessions, empty to disable
+	historyFile string
+	// cancel stops the running command
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+func newShell(c *cli.Context, hosts hostlist.HostInfoList) *shell {
+	sh := &shell{
+		c:         c,
+		parameter: SetupParameter(c),
+		hosts:     hosts,
+		active:    make(map[string]bool),
+		failed:    make(map[string]bool),
+		cwd:       make(map[string]string),
+	}
+	// Commands reuse connections of the session
+	sh.parameter.SSHPool = executor.NewSSHPool()
+	for _, info := range hosts {
+		sh.active[info.Alias] = true
+	}
+	sh.historyFile = config.GetString("shell.history")
+	if sh.historyFile == "" {
+		sh.historyFile = filepath.Join(os.Getenv("HOME"), ".gsck_history")
+	}
+	sh.loadHistory()
+	return sh
+}
+
+func (sh *shell) loadHistory() {
+	file, err := os.Open(sh.historyFile)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		sh.history = append(sh.history, scanner.Text())
+	}
+}
+
+func (sh *shell) addHistory(line string) {
+	sh.history = append(sh.history, line)
+	file, err := os.OpenFile(sh.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	fmt.Fprintln(file, line)
+}
+
+// activeHosts returns copies of active hosts, with @cmd run in cwd of each host
+func (sh *shell) activeHosts(cmd string) hostlist.HostInfoList {
+	list := make(hostlist.HostInfoList, 0, len(sh.hosts))
+	for _, info := range sh.hosts {
+		if !sh.active[info.Alias] {
+			continue
+		}
+		host := *info
+		host.Cmd = cmd
+		if dir := sh.cwd[info.Alias]; dir != "" {
+			host.Cmd = "cd " + util.ShellQuote(dir) + " && " + cmd
+		}
+		list = append(list, &host)
+	}
+	return list
+}
+
+// run executes @cmd on active hosts, and returns outputs of all hosts.
+// Outputs are shown only if @show is set.
+func (sh *shell) run(cmd string, show bool) map[string]formatter.Output {
+	collector := &shellCollector{outputs: make(map[string]formatter.Output)}
+	list := sh.activeHosts(cmd)
+	if len(list) == 0 {
+		fmt.Println("No active hosts. Try :all")
+		return collector.outputs
+	}
+	exec, err := executor.NewExecutor(sh.parameter)
+	if err != nil {
+		fmt.Println(err)
+		return collector.outputs
+	}
+	exec.SetHostInfoList(list)
+	exec.AddFormatter("shell", collector)
+	if show {
+		if sh.c.Bool("json") {
+			exec.AddFormatter("merge", formatter.NewJSONFormatter())
+		} else {
+			exec.AddFormatter("merge", formatter.NewAggregateFormatter())
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sh.mu.Lock()
+	sh.cancel = cancel
+	sh.mu.Unlock()
+	defer func() {
+		sh.mu.Lock()
+		sh.cancel = nil
+		sh.mu.Unlock()
+		cancel()
+	}()
+	if _, err = exec.RunContext(ctx); err != nil {
+		fmt.Println("Execute Error: ", err)
+	}
+	sh.failed = make(map[string]bool)
+	for alias, output := range collector.outputs {
+		if output.ExitCode != 0 || output.Error != "" {
+			sh.failed[alias] = true
+		}
+	}
+	return collector.outputs
+}
+
+// interrupt cancels the running command. It returns false if nothing is running.
+func (sh *shell) interrupt() bool {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.cancel == nil {
+		return false
+	}
+	sh.cancel()
+	return true
+}
+
+// cd changes cwd of active hosts, to where `cd @dir` leads on each host
+func (sh *shell) cd(dir string) {
+	cmd := "cd"
+	if dir != "" {
+		cmd += " " + dir
+	}
+	outputs := sh.run(cmd+" && pwd", false)
+	for alias, output := range outputs {
+		if output.ExitCode == 0 && output.Error == "" {
+			lines := strings.Split(output.Stdout, "\n")
+			sh.cwd[alias] = lines[len(lines)-1]
+		}
+	}
+	if len(sh.failed) > 0 {
+		fmt.Printf("cd failed on %d host(s): %s\n", len(sh.failed), strings.Join(sortedKeys(sh.failed), ", "))
+	}
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// match tells whether @alias matches any of glob @patterns
+func match(alias string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, alias); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// builtin handles `:xxx` commands. It returns false to quit.
+func (sh *shell) builtin(line string) bool {
+	fields := util.SplitBySpace(strings.TrimSpace(line[1:]))
+	name, args := fields[0], fields[1:]
+	switch name {
+	case "quit", "q", "exit":
+		return false
+	case "hosts":
+		for _, info := range sh.hosts {
+			if sh.active[info.Alias] {
+				fmt.Printf("%s\t%s\n", info.Alias, sh.cwd[info.Alias])
+			}
+		}
+	case "all":
+		for _, info := range sh.hosts {
+			sh.active[info.Alias] = true
+		}
+	case "only":
+		if len(args) == 0 {
+			fmt.Println("Usage: :only failed|PATTERN..")
+			break
+		}
+		for alias := range sh.active {
+			if len(args) == 1 && args[0] == "failed" {
+				sh.active[alias] = sh.failed[alias]
+			} else {
+				sh.active[alias] = sh.active[alias] && match(alias, args)
+			}
+		}
+	case "exclude":
+		for alias := range sh.active {
+			if match(alias, args) {
+				sh.active[alias] = false
+			}
+		}
+	case "history":
+		for i, cmd := range sh.history {
+			fmt.Printf("%5d  %s\n", i+1, cmd)
+		}
+	case "help":
+		fmt.Println(shellUsage)
+	default:
+		fmt.Printf("Unknown built-in :%s. Try :help\n", name)
+	}
+	return true
+}
+
+func (sh *shell) activeCount() (count int) {
+	for _, active := range sh.active {
+		if active {
+			count++
+		}
+	}
+	return
+}
+
+// loop reads commands from @input until EOF or :quit
+func (sh *shell) loop(input io.Reader, interactive bool) {
+	scanner := bufio.NewScanner(input)
+	for {
+		if interactive {
+			fmt.Printf("gsck [%d/%d]$ ", sh.activeCount(), len(sh.hosts))
+		}
+		if !scanner.Scan() {
+			if interactive {
+				fmt.Println()
+			}
+			return
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		sh.addHistory(line)
+		switch {
+		case strings.HasPrefix(line, ":"):
+			if !sh.builtin(line) {
+				return
+			}
+		case line == "cd" || strings.HasPrefix(line, "cd "):
+			sh.cd(strings.TrimSpace(line[2:]))
+		default:
+			sh.run(line, true)
+		}
+	}
+}
+
+// SHELL Action (gsck shell ...)
+func shellAction(c *cli.Context) {
+	hostsArg := c.String("hosts")
+	if hostsArg == "" {
+		hostsArg = command.Instance().Fifo
+	}
+	if hostsArg == "" {
+		fmt.Println("Hosts (-f) is required, since stdin is used for commands.")
+		os.Exit(1)
+	}
+	list, err := GetHostList(hostsArg, c.String("prefer"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	sh := newShell(c, list)
+
+	// C-c stops the running command, instead of gsck
+	command.StopSignal()
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt)
+	go func() {
+		for range sigc {
+			if !sh.interrupt() {
+				fmt.Println()
+			}
+		}
+	}()
+
+	var input io.Reader = os.Stdin
+	interactive := terminal.IsTerminal(int(os.Stdin.Fd()))
+	if pipe := command.Instance().PipeReader(); pipe != nil {
+		input = pipe
+		interactive = false
+	}
+	// Connect to all hosts at first, so that commands later reuse the connections.
+	outputs := sh.run("true", false)
+	fmt.Printf("Connected: %d/%d\n", len(outputs)-len(sh.failed), len(list))
+	if len(sh.failed) > 0 {
+		fmt.Printf("Failed: %s\n", strings.Join(sortedKeys(sh.failed), ", "))
+	}
+	sh.loop(input, interactive)
+	sh.parameter.SSHPool.CloseIdle()
+}
@@ -0,0 +1,164 @@
+package commander
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lidongpeng36/gsck/command"
+	"github.com/lidongpeng36/gsck/executor"
+	"github.com/lidongpeng36/gsck/formatter"
+	"github.com/lidongpeng36/gsck/util"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command.RegisterCommand(cli.Command{
+		Name:      "tail",
+		Usage:     "Follow files on hosts, in one merged stream",
+		ArgsUsage: "FILE [FILE...]",
+		Description: "Lines are prefixed with alias of host. Lost connections are dialed again,\n" +
+			"   and lines written meanwhile are skipped. Press C-c to stop.",
+		Flags: []cli.Flag{
+			UserFlag,
+			HostsFlag,
+			MethodFlag,
+			WorkerOptFlag,
+			PreferFlag,
+			PasswdFlag,
+			PasswordFlag,
+			SudoFlag,
+			SudoUserFlag,
+			WindowFlag,
+			AccountFlag,
+			ConnectTimeoutFlag,
+			KeepAliveFlag,
+			cli.StringFlag{
+				Name:  "grep, g",
+				Usage: "Show lines matching regular expression `RE` only",
+			},
+			cli.IntFlag{
+				Name:  "lines, n",
+				Value: 10,
+				Usage: "Show last `N` lines of files at first",
+			},
+		},
+		Action: tailAction,
+	})
+}
+
+// tailBackoff is the max interval of reconnecting
+const tailBackoff = 30 * time.Second
+
+// tailCmd returns command that follows @files, even if they're rotated
+func tailCmd(files []string, lines int) string {
+	quoted := make([]string, len(files))
+	for i, file := range files {
+		quoted[i] = util.ShellQuote(file)
+	}
+	return fmt.Sprintf("exec tail -n %d -F -- %s", lines, strings.Join(quoted, " "))
+}
+
+// follow streams host @index until ctx is done, or command exits by itself.
+// Connection is dialed again with backoff once it's lost.
+func follow(ctx context.Context, exec *executor.Executor, index int, files []string, view formatter.TailView) {
+	output := view.Output(index)
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := exec.Stream(ctx, index, output, output)
+		if ctx.Err() != nil {
+			return
+		}
+		if exitErr, ok := err.(*executor.ExitError); ok {
+			view.Notice(index, exitErr.Error())
+			return
+		} else if err == nil {
+			view.Notice(index, "exited")
+			return
+		}
+		// Lines already shown should not show again
+		exec.Parameter.HostInfoList[index].Cmd = tailCmd(files, 0)
+		if time.Since(start) > tailBackoff {
+			backoff = time.Second
+		}
+		view.Notice(index, fmt.Sprintf("reconnecting in %s: %s", backoff, err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > tailBackoff {
+			backoff = tailBackoff
+		}
+		view.Notice(index, "")
+	}
+}
+
+// TAIL Action (gsck tail ...)
+func tailAction(c *cli.Context) {
+	files := []string(c.Args())
+	if len(files) == 0 {
+		fmt.Println("FILE is required")
+		os.Exit(1)
+	}
+	var grep *regexp.Regexp
+	if re := c.String("grep"); re != "" {
+		var err error
+		if grep, err = regexp.Compile(re); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	exec := PrepareExecutor(c)
+	exec.Parameter.Cmd = tailCmd(files, c.Int("lines"))
+	if !c.IsSet("keepalive") {
+		exec.Parameter.KeepAlive = longKeepAlive
+	}
+	hosts := exec.Parameter.HostInfoList
+	aliases := make([]string, len(hosts))
+	for i, info := range hosts {
+		aliases[i] = info.Alias
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	run := func(view formatter.TailView) {
+		for i := range hosts {
+			wg.Add(1)
+			go func(index int) {
+				defer wg.Done()
+				follow(ctx, exec, index, files, view)
+			}(i)
+		}
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+	}
+	if c.Bool("window") {
+		tw, err := formatter.NewTailWindow(aliases, grep)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		run(tw)
+		tw.Run(done)
+	} else {
+		run(formatter.NewTailPrinter(aliases, grep))
+		command.StopSignal()
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		select {
+		case <-interrupt:
+		case <-done:
+		}
+	}
+	cancel()
+	<-done
+}
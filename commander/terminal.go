@@ -0,0 +1,83 @@
+package commander
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/lidongpeng36/gsck/command"
+	"github.com/lidongpeng36/gsck/executor"
+	"github.com/lidongpeng36/gsck/formatter"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command.RegisterCommand(cli.Command{
+		Name:      "terminal",
+		Aliases:   []string{"term", "cssh"},
+		Usage:     "Open terminals on hosts in window, and type into all of them at once",
+		ArgsUsage: "[command, default: login shell, of sudo user with --sudo]",
+		Flags: []cli.Flag{
+			UserFlag,
+			HostsFlag,
+			MethodFlag,
+			WorkerOptFlag,
+			PreferFlag,
+			PasswdFlag,
+			PasswordFlag,
+			SudoFlag,
+			SudoUserFlag,
+			AccountFlag,
+			ConnectTimeoutFlag,
+			KeepAliveFlag,
+		},
+		Action: terminalAction,
+	})
+}
+
+// TERMINAL Action (gsck terminal ...)
+func terminalAction(c *cli.Context) {
+	exec := PrepareExecutor(c)
+	exec.Parameter.Cmd = strings.Join(c.Args(), " ")
+	hosts := exec.Parameter.HostInfoList
+	aliases := make([]string, len(hosts))
+	for i, info := range hosts {
+		aliases[i] = info.Alias
+	}
+	tw, err := formatter.NewTerminalWindow(aliases)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	terminals := make([]executor.Terminal, 0, len(hosts))
+	width, height := tw.Size()
+	for i := range hosts {
+		go func(index int) {
+			term, err := exec.OpenTerminal(ctx, index, width, height, tw.Output(index))
+			if err != nil {
+				tw.Detach(index, err)
+				return
+			}
+			mu.Lock()
+			terminals = append(terminals, term)
+			mu.Unlock()
+			tw.Attach(index, term)
+			tw.Detach(index, term.Wait())
+		}(i)
+	}
+	tw.Run()
+	cancel()
+	mu.Lock()
+	for _, term := range terminals {
+		_ = term.Close()
+	}
+	mu.Unlock()
+	if summary := tw.Summary(); summary != "" {
+		fmt.Println(summary)
+		os.Exit(1)
+	}
+}
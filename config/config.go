@@ -69,6 +69,10 @@ func bindEnv(prefix string) {
 }
 
 func splitKey(raw string) (section *ini.Section, key string) {
+	if nil == conf {
+		// Not Setup yet
+		conf = ini.Empty()
+	}
 	fields := strings.Split(raw, ".")
 	length := len(fields)
 	sectionName := defaultSection
@@ -107,3 +111,11 @@ func Set(key, value string) {
 	_, _ = section.NewKey(sectionKey, value)
 	_ = conf.SaveTo(configPath)
 }
+
+// GetSection returns all keys of @section, e.g. keys set by `section.key`
+func GetSection(section string) map[string]string {
+	if nil == conf {
+		return map[string]string{}
+	}
+	return conf.Section(section).KeysHash()
+}
@@ -0,0 +1,174 @@
+// Package ensure builds shell commands that bring a file, a line in a file, or a directory
+// into the wanted state, and do nothing if it's already there.
+//
+// Each command ends its stdout with a status line, see Parse:
+//   gsck-ensure: unchanged
+//   gsck-ensure: changed content,mode
+//   gsck-ensure: pending created        (check mode, nothing is applied)
+package ensure
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lidongpeng36/gsck/util"
+)
+
+// Status of a host
+const (
+	Unchanged = "unchanged"
+	Changed   = "changed"
+	// Pending means there are changes, not applied in check mode
+	Pending = "pending"
+)
+
+const statusPrefix = "gsck-ensure: "
+
+// Options are shared by all commands
+type Options struct {
+	// Check reports pending changes, without applying them
+	Check bool
+	// After is run once changes are applied, e.g. to reload a service
+	After string
+}
+
+// Result is the status line of a host
+type Result struct {
+	Status string `json:"status"`
+	// Detail is what is (or would be) changed, e.g. "content,mode"
+	Detail string `json:"detail"`
+}
+
+// Parse finds the status line in @stdout. It returns nil if there is none.
+func Parse(stdout string) *Result {
+	lines := strings.Split(stdout, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(line, statusPrefix) {
+			continue
+		}
+		fields := strings.SplitN(strings.TrimPrefix(line, statusPrefix), " ", 2)
+		result := &Result{Status: fields[0]}
+		if len(fields) == 2 {
+			result.Detail = fields[1]
+		}
+		return result
+	}
+	return nil
+}
+
+// NormalizeMode checks octal @mode, and strips leading zeros like `stat -c %a` does
+func NormalizeMode(mode string) (string, error) {
+	if mode == "" {
+		return "", nil
+	}
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || perm > 07777 {
+		return "", fmt.Errorf("Invalid Mode: %s", mode)
+	}
+	return strconv.FormatUint(perm, 8), nil
+}
+
+// finish reports and applies changes listed in `$d`. Nothing is done if it's empty.
+// @install applies changes unless in check mode, and @cleanup runs in any case.
+func finish(opt Options, install, cleanup string) string {
+	if cleanup == "" {
+		cleanup = ":"
+	}
+	cmd := fmt.Sprintf("if [ -z \"$d\" ]; then %s; echo '%s%s'; exit 0; fi\n", cleanup, statusPrefix, Unchanged)
+	if opt.Check {
+		return cmd + fmt.Sprintf("%s; echo \"%s%s $d\"\n", cleanup, statusPrefix, Pending)
+	}
+	cmd += fmt.Sprintf("{ %s; }; rc=$?; %s; [ $rc -eq 0 ] || exit $rc\n", install, cleanup)
+	if opt.After != "" {
+		cmd += fmt.Sprintf("{ %s; } || exit $?\n", opt.After)
+	}
+	return cmd + fmt.Sprintf("echo \"%s%s $d\"\n", statusPrefix, Changed)
+}
+
+// modeDiffers is a condition, true if @mode is set and file `$p` has another mode
+func modeDiffers(mode string) string {
+	if mode == "" {
+		return "false"
+	}
+	return fmt.Sprintf("[ \"$(stat -c %%a \"$p\")\" != %s ]", mode)
+}
+
+const lineAwk = `BEGIN { l = ENVIRON["GSCK_LINE"]; re = ENVIRON["GSCK_MATCH"] }
+((l != "" || re == "") && $0 == l) || (re != "" && $0 ~ re) { %s }
+{ print }
+%s`
+
+// Line ensures @line is in file @path, or not if @absent.
+// Lines matching extended regular expression @match (if it's not empty) are taken as the same line:
+// the first is replaced with @line and the others are removed, or all of them are removed if @absent.
+// Empty @line is not compared if @match is given, so removing lines by @match alone keeps empty lines.
+// A missing file is created, unless @absent. Change is reported as added, replaced (of a matched line) or removed.
+func Line(path, line, match string, absent bool, opt Options) string {
+	program := fmt.Sprintf(lineAwk, "if (!found) print l; found = 1; next", "END { if (!found) print l }")
+	detail := "added"
+	if absent {
+		program = fmt.Sprintf(lineAwk, "next", "")
+		detail = "removed"
+	}
+	cmd := fmt.Sprintf("p=%s; export GSCK_LINE=%s GSCK_MATCH=%s\n",
+		util.ShellQuote(path), util.ShellQuote(line), util.ShellQuote(match))
+	if absent {
+		cmd += fmt.Sprintf("[ -e \"$p\" ] || { echo '%s%s'; exit 0; }\n", statusPrefix, Unchanged)
+	}
+	cmd += "in=/dev/null; [ -e \"$p\" ] && in=\"$p\"\n" +
+		"f=$(mktemp) || exit 1\n" +
+		"awk " + util.ShellQuote(program) + " \"$in\" > \"$f\" || { rm -f \"$f\"; exit 1; }\n" +
+		"d=" + detail + "\n"
+	if match != "" && !absent {
+		// Line taking place of a matched one is replaced, instead of added
+		cmd += "grep -Eq -e \"$GSCK_MATCH\" \"$in\" && d=replaced\n"
+	}
+	cmd += "[ -e \"$p\" ] && cmp -s \"$p\" \"$f\" && d=\n"
+	return cmd + finish(opt, "cat \"$f\" > \"$p\"", "rm -f \"$f\"")
+}
+
+// File ensures file @path has content of file @src on host, which is removed at last.
+// @src is a shell word, e.g. quoted path or "$f". Mode is set to @mode if it's not empty,
+// or @createMode if file is created.
+func File(src, path, mode, createMode string, opt Options) string {
+	cmd := fmt.Sprintf("s=%s; p=%s\n", src, util.ShellQuote(path)) +
+		"if [ -e \"$p\" ]; then\n" +
+		"  d=; cmp -s \"$s\" \"$p\" || d=content\n" +
+		"  " + modeDiffers(mode) + " && d=${d:+$d,}mode\n" +
+		"else\n" +
+		"  d=created\n" +
+		"fi\n"
+	if mode == "" {
+		mode = createMode
+	}
+	install := "{ cmp -s \"$s\" \"$p\" 2>/dev/null || cat \"$s\" > \"$p\"; }"
+	if mode != "" {
+		install += " && chmod " + mode + " \"$p\""
+	}
+	return cmd + finish(opt, install, "rm -f \"$s\"")
+}
+
+// Embed returns command that writes @content into a temporary file, whose path is in `$f`
+func Embed(content []byte) string {
+	return "f=$(mktemp) && echo " + util.ShellQuote(base64.StdEncoding.EncodeToString(content)) + " | base64 -d > \"$f\" || exit 1\n"
+}
+
+// Dir ensures directory @path exists, with @mode if it's not empty
+func Dir(path, mode string, opt Options) string {
+	cmd := fmt.Sprintf("p=%s\n", util.ShellQuote(path)) +
+		"if [ -d \"$p\" ]; then\n" +
+		"  d=; " + modeDiffers(mode) + " && d=mode\n" +
+		"elif [ -e \"$p\" ]; then\n" +
+		"  echo \"$p exists, and is not a directory\" >&2; exit 1\n" +
+		"else\n" +
+		"  d=created\n" +
+		"fi\n"
+	install := "mkdir -p \"$p\""
+	if mode != "" {
+		install += " && chmod " + mode + " \"$p\""
+	}
+	return cmd + finish(opt, install, "")
+}
@@ -0,0 +1,91 @@
+package ensure
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// run runs @cmd with sh, and returns its status line
+func run(t *testing.T, cmd string) *Result {
+	out, err := exec.Command("/bin/sh", "-c", cmd).Output()
+	if err != nil {
+		t.Fatalf("%s: %v", cmd, err)
+	}
+	result := Parse(string(out))
+	if result == nil {
+		t.Fatalf("No status in %q", out)
+	}
+	return result
+}
+
+func expect(t *testing.T, result *Result, status, detail string) {
+	t.Helper()
+	if result.Status != status || result.Detail != detail {
+		t.Errorf("Got %s %s, expected %s %s", result.Status, result.Detail, status, detail)
+	}
+}
+
+func TestLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gsck-ensure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "conf")
+	content := func() string {
+		data, _ := ioutil.ReadFile(file)
+		return string(data)
+	}
+
+	expect(t, run(t, Line(file, "a = 1", "", false, Options{Check: true})), Pending, "added")
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Error("File should not be created in check mode")
+	}
+	expect(t, run(t, Line(file, "a = 1", "", false, Options{})), Changed, "added")
+	expect(t, run(t, Line(file, "a = 1", "", false, Options{})), Unchanged, "")
+	expect(t, run(t, Line(file, `b = "$x\n"`, "", false, Options{})), Changed, "added")
+	expect(t, run(t, Line(file, "a = 2", "^a =", false, Options{After: "echo reloaded"})), Changed, "replaced")
+	if got := content(); got != "a = 2\nb = \"$x\\n\"\n" {
+		t.Errorf("Unexpected content: %q", got)
+	}
+	expect(t, run(t, Line(file, `b = "$x\n"`, "", true, Options{})), Changed, "removed")
+	expect(t, run(t, Line(file, `b = "$x\n"`, "", true, Options{})), Unchanged, "")
+	if got := content(); got != "a = 2\n" {
+		t.Errorf("Unexpected content: %q", got)
+	}
+	// Nothing matched
+	expect(t, run(t, Line(file, "c = 3", "^c =", false, Options{})), Changed, "added")
+	// Matched lines are removed, and empty ones are kept
+	ioutil.WriteFile(file, []byte("a = 2\n\nc = 3\n"), 0644)
+	expect(t, run(t, Line(file, "", "^c =", true, Options{})), Changed, "removed")
+	if got := content(); got != "a = 2\n\n" {
+		t.Errorf("Unexpected content: %q", got)
+	}
+}
+
+func TestFileAndDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gsck-ensure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sub := filepath.Join(dir, "sub")
+	expect(t, run(t, Dir(sub, "750", Options{})), Changed, "created")
+	expect(t, run(t, Dir(sub, "750", Options{})), Unchanged, "")
+	expect(t, run(t, Dir(sub, "700", Options{Check: true})), Pending, "mode")
+
+	file := filepath.Join(sub, "app.conf")
+	expect(t, run(t, Embed([]byte("v1\n"))+File(`"$f"`, file, "", "600", Options{})), Changed, "created")
+	expect(t, run(t, Embed([]byte("v1\n"))+File(`"$f"`, file, "", "644", Options{})), Unchanged, "")
+	expect(t, run(t, Embed([]byte("v2\n"))+File(`"$f"`, file, "640", "", Options{})), Changed, "content,mode")
+	fi, err := os.Stat(file)
+	if err != nil || fi.Mode().Perm() != 0640 {
+		t.Errorf("Unexpected file: %v, %v", fi, err)
+	}
+	if data, _ := ioutil.ReadFile(file); string(data) != "v2\n" {
+		t.Errorf("Unexpected content: %q", data)
+	}
+}
@@ -0,0 +1,78 @@
+package executor
+
+import (
+	"io"
+	"sync"
+)
+
+// broadcastChunkSize is the most data held in memory by stdinBroadcast
+const broadcastChunkSize = 32 * 1024
+
+// stdinBroadcast tees a local stream to stdin of all hosts.
+// It starts once every host has joined (or left), so that each host gets the whole stream.
+// Data is passed chunk by chunk, and the slowest host throttles all the others.
+type stdinBroadcast struct {
+	src     io.Reader
+	waiting int
+	writers []*io.PipeWriter
+	mu      sync.Mutex
+}
+
+func newStdinBroadcast(src io.Reader, hosts int) *stdinBroadcast {
+	return &stdinBroadcast{
+		src:     src,
+		waiting: hosts,
+		writers: make([]*io.PipeWriter, 0, hosts),
+	}
+}
+
+// join returns stdin for a host. Host must Close it when finished, so that it stops blocking others.
+func (sb *stdinBroadcast) join() *io.PipeReader {
+	pr, pw := io.Pipe()
+	sb.mu.Lock()
+	sb.writers = append(sb.writers, pw)
+	sb.mu.Unlock()
+	sb.done()
+	return pr
+}
+
+// leave tells that a host would never join, e.g. it fails to connect.
+func (sb *stdinBroadcast) leave() {
+	sb.done()
+}
+
+func (sb *stdinBroadcast) done() {
+	sb.mu.Lock()
+	sb.waiting--
+	start := sb.waiting == 0
+	sb.mu.Unlock()
+	if start {
+		go sb.pump()
+	}
+}
+
+func (sb *stdinBroadcast) pump() {
+	buf := make([]byte, broadcastChunkSize)
+	writers := sb.writers
+	for {
+		n, err := sb.src.Read(buf)
+		if n > 0 {
+			alive := writers[:0]
+			for _, w := range writers {
+				if _, werr := w.Write(buf[:n]); werr == nil {
+					alive = append(alive, w)
+				}
+			}
+			writers = alive
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			for _, w := range writers {
+				_ = w.CloseWithError(err)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package executor
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStdinBroadcast(t *testing.T) {
+	data := strings.Repeat("gsck", broadcastChunkSize)
+	sb := newStdinBroadcast(strings.NewReader(data), 4)
+	var wg sync.WaitGroup
+	results := make([][]byte, 2)
+	for i := range results {
+		wg.Add(1)
+		go func(i int, reader *io.PipeReader) {
+			defer wg.Done()
+			results[i], _ = ioutil.ReadAll(reader)
+		}(i, sb.join())
+	}
+	// A host quits after the first chunk, which must not block others.
+	quitter := sb.join()
+	go func() {
+		_, _ = quitter.Read(make([]byte, 1))
+		_ = quitter.Close()
+	}()
+	sb.leave()
+	wg.Wait()
+	for i, result := range results {
+		if !bytes.Equal(result, []byte(data)) {
+			t.Fatalf("Host %d got %d bytes. Expected: %d", i, len(result), len(data))
+		}
+	}
+}
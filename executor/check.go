@@ -0,0 +1,68 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/lidongpeng36/gsck/formatter"
+)
+
+// WorkerWithCheck could diagnose hosts phase by phase, without running command of hosts
+type WorkerWithCheck interface {
+	// Check diagnoses host @index. It should return as soon as possible once ctx is done.
+	Check(ctx context.Context, index int) *formatter.CheckResult
+	Worker
+}
+
+// Check initializes worker, diagnoses every host and sends results to @f.
+// It returns how many hosts failed. Once it's cancelled (by ctx or Cancel), hosts not checked yet
+// are failed without results, and results collected are still printed.
+func (exec *Executor) Check(ctx context.Context, f *formatter.CheckFormatter) (failed int, err error) {
+	w, ok := exec.worker.(WorkerWithCheck)
+	if !ok {
+		return 0, errors.New("Method " + exec.worker.Name() + " does not support check")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	finished := make(chan struct{})
+	exec.mu.Lock()
+	exec.cancel = cancel
+	exec.finished = finished
+	exec.mu.Unlock()
+	defer close(finished)
+	defer cancel()
+	if err = exec.integration(); err != nil {
+		return
+	}
+	if err = exec.worker.Init(exec.Parameter); err != nil {
+		return
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	sem := make(chan bool, exec.Parameter.Concurrency)
+	for i := range exec.Parameter.HostInfoList {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			sem <- true
+			defer func() { <-sem }()
+			if ctx.Err() != nil {
+				mu.Lock()
+				failed++
+				mu.Unlock()
+				return
+			}
+			result := w.Check(ctx, index)
+			result.Index = index
+			mu.Lock()
+			defer mu.Unlock()
+			if result.Failed() {
+				failed++
+			}
+			f.Add(result)
+		}(i)
+	}
+	wg.Wait()
+	f.Print()
+	return
+}
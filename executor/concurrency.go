@@ -0,0 +1,89 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/lidongpeng36/gsck/formatter"
+	"github.com/lidongpeng36/gsck/hostlist"
+)
+
+// hostTask produces Output for the host at @index of HostInfoList.
+// It should return as soon as possible once ctx is done.
+type hostTask func(ctx context.Context, index int) *formatter.Output
+
+// runConcurrently drives @task for every host, with at most data.Concurrency tasks running at once.
+// Hosts which have not started yet when ctx is done are reported as cancelled (or timed out).
+// Both channels are closed after all Outputs are sent, so receiver must drain the Output channel.
+func runConcurrently(ctx context.Context, data *Parameter, task hostTask) (<-chan *formatter.Output, <-chan error) {
+	ch := make(chan *formatter.Output)
+	errc := make(chan error)
+	concurrency := data.Concurrency
+	if concurrency <= 0 {
+		concurrency = int64(len(data.HostInfoList))
+	}
+	go func() {
+		var wg sync.WaitGroup
+		sem := make(chan bool, concurrency)
+		for i, info := range data.HostInfoList {
+			wg.Add(1)
+			go func(index int, info *hostlist.HostInfo) {
+				defer wg.Done()
+				select {
+				case sem <- true:
+				case <-ctx.Done():
+					ch <- interruptedOutput(info, ctx.Err())
+					return
+				}
+				defer func() { <-sem }()
+				if err := ctx.Err(); err != nil {
+					ch <- interruptedOutput(info, err)
+					return
+				}
+				ch <- task(ctx, index)
+			}(i, info)
+		}
+		wg.Wait()
+		close(errc)
+		close(ch)
+	}()
+	return ch, errc
+}
+
+// Errors for hosts that run out of time
+var (
+	errConnectTimeout = errors.New("Connection Timeout.")
+	errExecTimeout    = errors.New("Execution Timeout.")
+	errDeadline       = errors.New("Deadline Exceeded.")
+)
+
+// interruptedOutput is Output for host that never started
+func interruptedOutput(info *hostlist.HostInfo, err error) *formatter.Output {
+	output := &formatter.Output{
+		Hostname: info.Host,
+		Alias:    info.Alias,
+		ExitCode: -1,
+	}
+	markInterrupted(output, err)
+	return output
+}
+
+// markInterrupted marks output as Cancelled or TimedOut according to @err.
+// It returns false, and leaves output untouched, if @err is not caused by cancellation or timeout.
+func markInterrupted(output *formatter.Output, err error) bool {
+	switch err {
+	case context.Canceled:
+		output.Cancelled = true
+		output.Error = "Cancelled."
+	case context.DeadlineExceeded:
+		output.TimedOut = true
+		output.Error = errDeadline.Error()
+	case errConnectTimeout, errExecTimeout:
+		output.TimedOut = true
+		output.Error = err.Error()
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package executor
+
+import (
+	"os/exec"
+
+	"github.com/lidongpeng36/gsck/hostlist"
+)
+
+func init() {
+	RegisterWorker(func() Worker {
+		return new(dockerExecutor)
+	})
+}
+
+// dockerExecutor runs command in containers with `docker exec`. Host is the container name or ID.
+// File is streamed as tar into `tar` of the container, like what `docker cp` does.
+// Options:
+//   host: daemon socket to connect to, e.g. `unix:///var/run/docker.sock`
+//   user: user in container, instead of default user of the image
+// Killing `docker exec` (for timeout or cancellation) does not always stop command in container.
+type dockerExecutor struct {
+	processWorker
+}
+
+func (de *dockerExecutor) dockerCommand(info *hostlist.HostInfo, cmd string) *exec.Cmd {
+	var args []string
+	if host := de.data.Options["host"]; host != "" {
+		args = append(args, "--host", host)
+	}
+	args = append(args, "exec", "-i")
+	if user := de.data.Options["user"]; user != "" {
+		args = append(args, "--user", user)
+	}
+	args = append(args, info.Host, "/bin/sh", "-c", cmd)
+	return exec.Command("docker", args...)
+}
+
+// pragma mark - Worker Interface
+
+func (de *dockerExecutor) Name() string {
+	return "docker"
+}
+
+func (de *dockerExecutor) Init(data *Parameter) error {
+	de.command = de.dockerCommand
+	de.archive = true
+	return de.init(data)
+}
@@ -1,13 +1,17 @@
 package executor
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/user"
 	"path"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/lidongpeng36/gsck/formatter"
 	"github.com/lidongpeng36/gsck/hostlist"
@@ -24,6 +28,7 @@ var constructorMap = map[string]WorkerConstructor{}
 
 // NewExecutor returns an empty Executor
 func NewExecutor(p Parameter) (exec *Executor, err error) {
+	loadPlugins()
 	p1 := p
 	setupParameter(&p1)
 	exec = &Executor{
@@ -31,6 +36,10 @@ func NewExecutor(p Parameter) (exec *Executor, err error) {
 		indexMap:   make(map[string]int),
 		formatters: make(map[string]formatter.Formatter),
 	}
+	if p1.SSHPool == nil {
+		p1.SSHPool = NewSSHPool()
+		exec.ownPool = true
+	}
 	if nil != p1.HostInfoList {
 		exec.SetHostInfoList(p1.HostInfoList)
 	}
@@ -59,6 +68,7 @@ func setupParameter(p *Parameter) {
 
 // Available returns all Worker's Name
 func Available() []string {
+	loadPlugins()
 	ret := make([]string, 0, len(constructorMap))
 	for name := range constructorMap {
 		ret = append(ret, name)
@@ -69,10 +79,13 @@ func Available() []string {
 // Worker should able to
 // 1. execute cmd string
 // 2. copy file (from *Executor.transferFile)
+// 3. stop all hosts once ctx is done: kill the running ones, and mark them (and those not started)
+//    as Cancelled, or as TimedOut if ctx hits its deadline.
+//    Worker must send an Output for every host, and close both channels at last.
 type Worker interface {
 	Init(*Parameter) error
 	Name() string
-	Execute(done <-chan struct{}) (<-chan *formatter.Output, <-chan error)
+	Execute(ctx context.Context) (<-chan *formatter.Output, <-chan error)
 }
 
 // WorkerWithRecommendedConcurrency could give its recommended concurrency
@@ -117,12 +130,36 @@ type Parameter struct {
 	Script       string
 	Account      string
 	Method       string
-	Retry        int
+	Retry        RetryPolicy
 	Concurrency  int64
 	Hostlist     []string
 	HostInfoList hostlist.HostInfoList
-	Timeout      int64
-	Transfer     *TransferFile
+	// Timeouts. Unit: s
+	//   ConnectTimeout: for connecting to each host
+	//   Timeout: for the command on each host
+	//   Deadline: for the whole run. Hosts left are marked as TimedOut.
+	ConnectTimeout int64
+	Timeout        int64
+	Deadline       int64
+	// KeepAlive is interval (Unit: s) of keepalive messages, if worker supports.
+	KeepAlive int64
+	Transfer  *TransferFile
+	// PTY requests a pseudo-terminal for the command
+	PTY bool
+	// SudoUser makes command run as this user with sudo, which implies PTY.
+	// Sudo password prompt is answered with Passwd.
+	SudoUser string
+	// Stdin is streamed to the command of every host at once.
+	// All hosts must be running together, so Concurrency should be -1.
+	Stdin io.Reader
+	// DryRun makes Executor send Plan of each host to Formatter(s), without touching any host
+	DryRun bool
+	// Template enables text/template in Cmd, with fields of HostInfo, e.g. `{{.Alias}}`
+	Template bool
+	// Options are worker specific settings, given by `--worker-opt key=value`
+	Options map[string]string
+	// SSHPool is shared by Executors given the same one. Executor has its own pool if it's nil.
+	SSHPool *SSHPool
 }
 
 // WrapCmdWithHook returns wrapped cmd, e.g. add `-a` and `-b` args
@@ -157,6 +194,13 @@ type Executor struct {
 	indexMap   map[string]int
 	formatters map[string]formatter.Formatter
 	err        []error
+	mu         sync.Mutex
+	cancel     context.CancelFunc
+	finished   chan struct{}
+	// ready is set once worker is initialized by prepare
+	ready bool
+	// ownPool is set if SSHPool is not given, and Executor closes its connections
+	ownPool bool
 }
 
 // SetHostlist sets hostlist for execution, without check or modification.
@@ -177,7 +221,6 @@ func (exec *Executor) SetHostInfoList(list hostlist.HostInfoList) *Executor {
 		for i, info := range list {
 			exec.indexMap[info.Alias] = i
 		}
-		formatter.SetHostInfoList(&list)
 	}
 	return exec
 }
@@ -276,12 +319,38 @@ func (exec *Executor) integration() (err error) {
 		if hi.User == "" {
 			hi.User = exec.Parameter.User
 		}
+		if exec.Parameter.Template {
+			if hi.Cmd, err = RenderTemplate(hi.Cmd, hi); err != nil {
+				return
+			}
+		}
 	}
 	return
 }
 
 // Run will initialize and drive worker and send output to Formatter(s)
 func (exec *Executor) Run() (failed int, err error) {
+	return exec.RunContext(context.Background())
+}
+
+// RunContext is Run that stops once ctx is done, or Parameter.Deadline is hit.
+// Outputs of cancelled or timed-out hosts are still sent to Formatter(s).
+func (exec *Executor) RunContext(ctx context.Context) (failed int, err error) {
+	var cancel context.CancelFunc
+	if exec.Parameter.Deadline > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(exec.Parameter.Deadline)*time.Second)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	finished := make(chan struct{})
+	exec.mu.Lock()
+	exec.cancel = cancel
+	exec.finished = finished
+	exec.mu.Unlock()
+	defer close(finished)
+	defer cancel()
+	// Connections of own pool are of no use once run is over
+	defer exec.closeIdle()
 
 	if err = exec.integration(); err != nil {
 		return
@@ -290,12 +359,21 @@ func (exec *Executor) Run() (failed int, err error) {
 	if err = exec.worker.Init(exec.Parameter); err != nil {
 		return
 	}
-	done := make(chan struct{})
 
-	ch, errc := exec.worker.Execute(done)
+	if exec.Parameter.DryRun {
+		exec.dryRun()
+		return
+	}
+
+	ch, errc := exec.worker.Execute(ctx)
 
 	defer func() {
-		close(done)
+		cancel()
+		// Let worker finish sending if we quit early.
+		go func() {
+			for range ch {
+			}
+		}()
 		for _, f := range exec.formatters {
 			f.Print()
 		}
@@ -303,8 +381,8 @@ func (exec *Executor) Run() (failed int, err error) {
 
 	for {
 		select {
-		case o := <-ch:
-			if nil == o {
+		case o, ok := <-ch:
+			if !ok {
 				return
 			}
 			if 0 != o.ExitCode {
@@ -314,8 +392,10 @@ func (exec *Executor) Run() (failed int, err error) {
 			for _, f := range exec.formatters {
 				f.Add(*o)
 			}
-		case e := <-errc:
-			if nil != e {
+		case e, ok := <-errc:
+			if !ok {
+				errc = nil
+			} else if nil != e {
 				err = e
 				return
 			}
@@ -323,3 +403,34 @@ func (exec *Executor) Run() (failed int, err error) {
 	}
 
 }
+
+func (exec *Executor) closeIdle() {
+	if exec.ownPool {
+		exec.Parameter.SSHPool.CloseIdle()
+	}
+}
+
+// Close closes idle connections of Executor's own pool, e.g. after Dial, Stream or OpenTerminal.
+// Connections of a pool given by Parameter.SSHPool are left to its owner.
+func (exec *Executor) Close() {
+	exec.closeIdle()
+}
+
+// Cancel stops current Run, and waits until it returns.
+// It returns false if Executor is not running.
+func (exec *Executor) Cancel() bool {
+	exec.mu.Lock()
+	cancel, finished := exec.cancel, exec.finished
+	exec.mu.Unlock()
+	if cancel == nil {
+		return false
+	}
+	select {
+	case <-finished:
+		return false
+	default:
+	}
+	cancel()
+	<-finished
+	return true
+}
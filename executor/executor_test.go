@@ -0,0 +1,289 @@
+package executor
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lidongpeng36/gsck/formatter"
+	"github.com/lidongpeng36/gsck/hostlist"
+)
+
+// collector keeps all outputs, in order of alias
+type collector struct {
+	mu      sync.Mutex
+	outputs map[string]formatter.Output
+}
+
+func (c *collector) Add(o formatter.Output) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.outputs[o.Alias] = o
+}
+
+func (c *collector) Print() {}
+
+func runExecutor(t *testing.T, ctx context.Context, p Parameter, hosts ...string) (*collector, int, error) {
+	exec, err := NewExecutor(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &collector{outputs: make(map[string]formatter.Output)}
+	exec.SetHostInfoList(hostlist.MakeHostInfoListFromStringList(hosts)).AddFormatter("test", c)
+	failed, err := exec.RunContext(ctx)
+	if len(c.outputs) != len(hosts) {
+		t.Fatalf("Expected %d outputs. Actual: %d", len(hosts), len(c.outputs))
+	}
+	return c, failed, err
+}
+
+func writeFixture(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "gsck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "fixture.json")
+	if err = ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestMockWorker(t *testing.T) {
+	fixture := writeFixture(t, `{
+		"default": {"stdout": "ok"},
+		"hosts": {
+			"web02": {"stderr": "oops", "exitcode": 2},
+			"web03": {"error": "connection refused"}
+		}
+	}`)
+	defer os.RemoveAll(filepath.Dir(fixture))
+	p := Parameter{Method: "mock", Cmd: "uptime", Options: map[string]string{"fixture": fixture}}
+	c, failed, err := runExecutor(t, context.Background(), p, "web01", "web02", "web03")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed != 2 {
+		t.Fatalf("Expected 2 failed hosts. Actual: %d", failed)
+	}
+	if o := c.outputs["web01"]; o.Stdout != "ok" || o.ExitCode != 0 {
+		t.Fatalf("Unexpected output of web01: %+v", o)
+	}
+	if o := c.outputs["web02"]; o.Error != "oops" || o.ExitCode != 2 {
+		t.Fatalf("Unexpected output of web02: %+v", o)
+	}
+	if o := c.outputs["web03"]; o.Error != "connection refused" || o.ExitCode != -1 {
+		t.Fatalf("Unexpected output of web03: %+v", o)
+	}
+}
+
+func TestMockWorkerRetry(t *testing.T) {
+	fixture := writeFixture(t, `{
+		"hosts": {
+			"web01": [{"error": "connection refused"}, {"exitcode": 255}, {"stdout": "ok"}]
+		}
+	}`)
+	defer os.RemoveAll(filepath.Dir(fixture))
+	p := Parameter{
+		Method:  "mock",
+		Options: map[string]string{"fixture": fixture},
+		Retry:   RetryPolicy{Count: 3, Exec: true},
+	}
+	c, failed, err := runExecutor(t, context.Background(), p, "web01")
+	if err != nil || failed != 0 {
+		t.Fatalf("Expected success. Actual: failed %d, error %v", failed, err)
+	}
+	o := c.outputs["web01"]
+	if o.Stdout != "ok" || len(o.Attempts) != 2 || o.Attempts[0].Phase != RetryConnect {
+		t.Fatalf("Unexpected output: %+v", o)
+	}
+}
+
+func TestMockWorkerDeadline(t *testing.T) {
+	fixture := writeFixture(t, `{"default": {"delay": "10s"}, "hosts": {"fast": {"stdout": "ok"}}}`)
+	defer os.RemoveAll(filepath.Dir(fixture))
+	p := Parameter{Method: "mock", Deadline: 1, Options: map[string]string{"fixture": fixture}}
+	start := time.Now()
+	c, failed, _ := runExecutor(t, context.Background(), p, "fast", "slow")
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("Deadline is not honored")
+	}
+	if failed != 1 || !c.outputs["slow"].TimedOut || c.outputs["fast"].TimedOut {
+		t.Fatalf("Unexpected outputs: %+v", c.outputs)
+	}
+}
+
+func TestExecutorCancel(t *testing.T) {
+	fixture := writeFixture(t, `{"default": {"delay": "10s"}}`)
+	defer os.RemoveAll(filepath.Dir(fixture))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	p := Parameter{Method: "mock", Concurrency: 1, Options: map[string]string{"fixture": fixture}}
+	c, failed, _ := runExecutor(t, ctx, p, "web01", "web02")
+	if failed != 2 || !c.outputs["web01"].Cancelled || !c.outputs["web02"].Cancelled {
+		t.Fatalf("Unexpected outputs: %+v", c.outputs)
+	}
+}
+
+func TestLocalWorker(t *testing.T) {
+	p := Parameter{Method: "local", Cmd: `echo "$GSCK_HOST:$GSCK_PORT $GSCK_INDEX"; [ "$GSCK_HOST" = web01 ]`}
+	c, failed, err := runExecutor(t, context.Background(), p, "web01:2222", "web02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed != 1 {
+		t.Fatalf("Expected 1 failed host. Actual: %d", failed)
+	}
+	if o := c.outputs["web01"]; o.Stdout != "web01:2222 0" {
+		t.Fatalf("Unexpected output of web01: %+v", o)
+	}
+	if o := c.outputs["web02"]; o.ExitCode != 1 || o.Stdout != "" {
+		t.Fatalf("Unexpected output of web02: %+v", o)
+	}
+}
+
+func TestLocalWorkerStdin(t *testing.T) {
+	p := Parameter{
+		Method:      "local",
+		Cmd:         "wc -c",
+		Concurrency: -1,
+		Stdin:       strings.NewReader(strings.Repeat("gsck", broadcastChunkSize)),
+	}
+	c, failed, err := runExecutor(t, context.Background(), p, "web01", "web02")
+	if err != nil || failed != 0 {
+		t.Fatalf("Expected success. Actual: failed %d, error %v", failed, err)
+	}
+	for alias, o := range c.outputs {
+		if o.Stdout != "131072" {
+			t.Fatalf("Unexpected output of %s: %+v", alias, o)
+		}
+	}
+}
+
+// chanWriter sends everything written into a channel
+type chanWriter chan string
+
+func (cw chanWriter) Write(p []byte) (int, error) {
+	cw <- string(p)
+	return len(p), nil
+}
+
+func TestLocalWorkerStream(t *testing.T) {
+	exec, err := NewExecutor(Parameter{Method: "local", Cmd: "echo first; sleep 10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec.SetHostInfoList(hostlist.MakeHostInfoListFromStringList([]string{"web01"}))
+	ctx, cancel := context.WithCancel(context.Background())
+	out := make(chanWriter, 1)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- exec.Stream(ctx, 0, out, out)
+	}()
+	// Output comes before command exits
+	if line := <-out; line != "first\n" {
+		t.Fatalf("Unexpected output: %q", line)
+	}
+	cancel()
+	select {
+	case err = <-errc:
+		if err != context.Canceled {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stream should stop once cancelled")
+	}
+
+	exec.Parameter.HostInfoList[0].Cmd = "exit 3"
+	err = exec.Stream(context.Background(), 0, out, out)
+	if exitErr, ok := err.(*ExitError); !ok || exitErr.ExitCode != 3 {
+		t.Fatalf("Expected exit code 3. Actual: %v", err)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	p := Parameter{
+		Method:   "local",
+		User:     "deploy",
+		Cmd:      "touch /tmp/gsck-dry-run-{{.Alias}}-{{.Index}}",
+		DryRun:   true,
+		Template: true,
+	}
+	c, failed, err := runExecutor(t, context.Background(), p, "web01:2222", "web02")
+	if err != nil || failed != 0 {
+		t.Fatalf("Expected success. Actual: failed %d, error %v", failed, err)
+	}
+	plan := c.outputs["web01"].Plan
+	if plan == nil || plan.User != "deploy" || plan.Port != "2222" || plan.Cmd != "touch /tmp/gsck-dry-run-web01-0" {
+		t.Fatalf("Unexpected plan of web01: %+v", plan)
+	}
+	if _, err = os.Stat("/tmp/gsck-dry-run-web01-0"); err == nil {
+		t.Fatalf("Dry-run touched host")
+	}
+}
+
+func TestTemplateError(t *testing.T) {
+	exec, _ := NewExecutor(Parameter{Method: "mock", Cmd: "echo {{.Nothing}}", Template: true})
+	exec.SetHostlist([]string{"web01"})
+	if _, err := exec.Run(); err == nil {
+		t.Fatalf("Expected error for unknown field")
+	}
+}
+
+func TestKubectlCommand(t *testing.T) {
+	ke := &kubectlExecutor{}
+	ke.data = &Parameter{Options: map[string]string{"context": "prod"}}
+	hosts := hostlist.MakeHostInfoListFromStringList([]string{"kube-system/dns-0:sidecar", "web-0"})
+	expected := []string{
+		"kubectl --context prod --namespace kube-system exec -i dns-0 --container sidecar -- /bin/sh -c uptime",
+		"kubectl --context prod exec -i web-0 -- /bin/sh -c uptime",
+	}
+	for i, info := range hosts {
+		if args := strings.Join(ke.kubectlCommand(info, "uptime").Args, " "); args != expected[i] {
+			t.Fatalf("Expected: %s. Actual: %s", expected[i], args)
+		}
+	}
+}
+
+// TestDockerWorker runs a fake `docker` which executes the command locally
+func TestDockerWorker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gsck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fakeDocker := "#!/bin/sh\nwhile [ \"$1\" != /bin/sh ]; do shift; done\nexec \"$@\"\n"
+	if err = ioutil.WriteFile(filepath.Join(dir, "docker"), []byte(fakeDocker), 0755); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "run.sh")
+	if err = ioutil.WriteFile(src, []byte("echo copied"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, "dst")
+	if err = os.Mkdir(dst, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+":"+os.Getenv("PATH"))
+
+	exec, _ := NewExecutor(Parameter{Method: "docker", Cmd: "./run.sh"})
+	c := &collector{outputs: make(map[string]formatter.Output)}
+	exec.SetHostlist([]string{"web"}).AddFormatter("test", c)
+	exec.SetTransfer(src, dst).SetTransferHook("", "")
+	if failed, err := exec.Run(); err != nil || failed != 0 {
+		t.Fatalf("Expected success. Actual: failed %d, error %v, outputs %+v", failed, err, c.outputs)
+	}
+	if o := c.outputs["web"]; o.Stdout != filepath.Join(dst, "run.sh")+" saved.\ncopied" {
+		t.Fatalf("Unexpected output: %+v", o)
+	}
+	fi, err := os.Stat(filepath.Join(dst, "run.sh"))
+	if err != nil || fi.Mode().Perm()&0700 != 0700 {
+		t.Fatalf("File is not copied with perm: %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package executor
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// WorkerWithDial could open connections from hosts to others, e.g. for port forwarding
+type WorkerWithDial interface {
+	// Dial connects to @addr from host @index
+	Dial(ctx context.Context, index int, network, addr string) (net.Conn, error)
+	Worker
+}
+
+// Dial connects to @addr from host @index, see WorkerWithDial.
+// Worker is initialized at the first call.
+func (exec *Executor) Dial(ctx context.Context, index int, network, addr string) (net.Conn, error) {
+	w, ok := exec.worker.(WorkerWithDial)
+	if !ok {
+		return nil, errors.New("Method " + exec.worker.Name() + " does not support forwarding")
+	}
+	if err := exec.prepare(); err != nil {
+		return nil, err
+	}
+	return w.Dial(ctx, index, network, addr)
+}
+
+// Tunnel is a local address, whose connections are forwarded to Remote from host
+type Tunnel struct {
+	Index  int    `json:"index"`
+	Alias  string `json:"alias"`
+	Local  string `json:"local"`
+	Remote string `json:"remote"`
+}
+
+// ForwardErrorHandler is called once a connection could not be forwarded through host @index
+type ForwardErrorHandler func(index int, err error)
+
+// pipe copies between @a and @b until either side ends, and closes both
+func pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	cp := func(dst, src net.Conn) {
+		_, _ = io.Copy(dst, src)
+		done <- struct{}{}
+	}
+	go cp(a, b)
+	go cp(b, a)
+	<-done
+	_ = a.Close()
+	_ = b.Close()
+	<-done
+}
+
+// serve accepts connections of @ln until ctx is done, and hands them to @handle
+func serve(ctx context.Context, ln net.Listener, handle func(net.Conn)) {
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+	}()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go handle(conn)
+	}
+}
+
+// ForwardPorts listens on a local port for each host on @bind, from @port (or random ones if it's 0),
+// and forwards connections to @remote from the host. Connections to hosts are dialed on demand,
+// so broken ones are dialed again by the next forwarded connection.
+// It returns once all listeners are ready, and they're closed once ctx is done.
+func (exec *Executor) ForwardPorts(ctx context.Context, bind string, port int, remote string, onError ForwardErrorHandler) ([]*Tunnel, error) {
+	if err := exec.prepare(); err != nil {
+		return nil, err
+	}
+	hosts := exec.Parameter.HostInfoList
+	listeners := make([]net.Listener, 0, len(hosts))
+	fail := func(err error) ([]*Tunnel, error) {
+		for _, ln := range listeners {
+			_ = ln.Close()
+		}
+		return nil, err
+	}
+	tunnels := make([]*Tunnel, len(hosts))
+	for i, info := range hosts {
+		localPort := 0
+		if port > 0 {
+			localPort = port + i
+		}
+		ln, err := net.Listen("tcp", net.JoinHostPort(bind, strconv.Itoa(localPort)))
+		if err != nil {
+			return fail(err)
+		}
+		listeners = append(listeners, ln)
+		tunnels[i] = &Tunnel{Index: i, Alias: info.Alias, Local: ln.Addr().String(), Remote: remote}
+	}
+	for i, ln := range listeners {
+		go serve(ctx, ln, func(index int) func(net.Conn) {
+			return func(local net.Conn) {
+				conn, err := exec.Dial(ctx, index, "tcp", remote)
+				if err != nil {
+					_ = local.Close()
+					onError(index, err)
+					return
+				}
+				pipe(local, conn)
+			}
+		}(i))
+	}
+	return tunnels, nil
+}
+
+// SOCKS5, RFC 1928. Only CONNECT without authentication is supported.
+const (
+	socksVersion          = 5
+	socksNoAuth           = 0
+	socksNoAcceptable     = 0xff
+	socksConnect          = 1
+	socksAddrIPv4         = 1
+	socksAddrDomain       = 3
+	socksAddrIPv6         = 4
+	socksSucceeded        = 0
+	socksNotAllowed       = 2
+	socksHostDown         = 4
+	socksNotSupported     = 7
+	socksAddrNotSupported = 8
+)
+
+// readSOCKSRequest does SOCKS5 handshake on @conn, and returns target of CONNECT request
+func readSOCKSRequest(conn net.Conn) (host string, port int, err error) {
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(conn, header); err != nil {
+		return
+	}
+	if header[0] != socksVersion {
+		err = fmt.Errorf("Unsupported SOCKS Version: %d", header[0])
+		return
+	}
+	methods := make([]byte, header[1])
+	if _, err = io.ReadFull(conn, methods); err != nil {
+		return
+	}
+	method := byte(socksNoAcceptable)
+	for _, m := range methods {
+		if m == socksNoAuth {
+			method = socksNoAuth
+		}
+	}
+	if _, err = conn.Write([]byte{socksVersion, method}); err != nil {
+		return
+	}
+	if method == socksNoAcceptable {
+		err = errors.New("SOCKS Client Requires Authentication")
+		return
+	}
+	request := make([]byte, 4)
+	if _, err = io.ReadFull(conn, request); err != nil {
+		return
+	}
+	if request[1] != socksConnect {
+		writeSOCKSReply(conn, socksNotSupported)
+		err = fmt.Errorf("Unsupported SOCKS Command: %d", request[1])
+		return
+	}
+	switch request[3] {
+	case socksAddrIPv4, socksAddrIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if request[3] == socksAddrIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err = io.ReadFull(conn, ip); err != nil {
+			return
+		}
+		host = ip.String()
+	case socksAddrDomain:
+		length := make([]byte, 1)
+		if _, err = io.ReadFull(conn, length); err != nil {
+			return
+		}
+		domain := make([]byte, length[0])
+		if _, err = io.ReadFull(conn, domain); err != nil {
+			return
+		}
+		host = string(domain)
+	default:
+		writeSOCKSReply(conn, socksAddrNotSupported)
+		err = fmt.Errorf("Unsupported SOCKS Address Type: %d", request[3])
+		return
+	}
+	portBytes := make([]byte, 2)
+	if _, err = io.ReadFull(conn, portBytes); err != nil {
+		return
+	}
+	port = int(binary.BigEndian.Uint16(portBytes))
+	return
+}
+
+// writeSOCKSReply replies CONNECT request. Bound address is always 0.0.0.0:0.
+func writeSOCKSReply(conn net.Conn, code byte) {
+	_, _ = conn.Write([]byte{socksVersion, code, 0, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+}
+
+// ForwardSOCKS listens on @addr as a SOCKS5 proxy. Host of CONNECT request picks the host by alias
+// (or hostname), and @remoteHost:port is connected from that host, e.g. with remoteHost 127.0.0.1,
+// `web01:9100` means 127.0.0.1:9100 of web01. Listener is closed once ctx is done.
+func (exec *Executor) ForwardSOCKS(ctx context.Context, addr, remoteHost string, onError ForwardErrorHandler) (net.Addr, error) {
+	if err := exec.prepare(); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]int)
+	for i, info := range exec.Parameter.HostInfoList {
+		// Alias wins over hostname
+		if _, ok := byName[info.Host]; !ok {
+			byName[info.Host] = i
+		}
+		byName[info.Alias] = i
+	}
+	go serve(ctx, ln, func(local net.Conn) {
+		host, port, err := readSOCKSRequest(local)
+		if err != nil {
+			_ = local.Close()
+			return
+		}
+		index, ok := byName[host]
+		if !ok {
+			writeSOCKSReply(local, socksNotAllowed)
+			_ = local.Close()
+			return
+		}
+		conn, err := exec.Dial(ctx, index, "tcp", net.JoinHostPort(remoteHost, strconv.Itoa(port)))
+		if err != nil {
+			writeSOCKSReply(local, socksHostDown)
+			_ = local.Close()
+			onError(index, err)
+			return
+		}
+		writeSOCKSReply(local, socksSucceeded)
+		pipe(local, conn)
+	})
+	return ln.Addr(), nil
+}
@@ -0,0 +1,89 @@
+package executor
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/lidongpeng36/gsck/hostlist"
+)
+
+// echoServer echoes every line back, until ctx is done
+func echoServer(t *testing.T, ctx context.Context) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serve(ctx, ln, func(conn net.Conn) {
+		defer conn.Close()
+		_, _ = io.Copy(conn, conn)
+	})
+	return ln.Addr().String()
+}
+
+func expectEcho(t *testing.T, conn net.Conn) {
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != "ping\n" {
+		t.Fatalf("Unexpected echo: %q, %v", line, err)
+	}
+}
+
+func TestForward(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	remote := echoServer(t, ctx)
+	exec, err := NewExecutor(Parameter{Method: "local"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec.SetHostInfoList(hostlist.MakeHostInfoListFromStringList([]string{"web01", "web02"}))
+	onError := func(index int, err error) {
+		t.Errorf("Forward failed for host %d: %v", index, err)
+	}
+
+	tunnels, err := exec.ForwardPorts(ctx, "127.0.0.1", 0, remote, onError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tunnels) != 2 || tunnels[1].Alias != "web02" {
+		t.Fatalf("Unexpected tunnels: %+v", tunnels)
+	}
+	conn, err := net.Dial("tcp", tunnels[1].Local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEcho(t, conn)
+	conn.Close()
+
+	// SOCKS5: connect `web02:PORT` with domain name
+	host, port, _ := net.SplitHostPort(remote)
+	addr, err := exec.ForwardSOCKS(ctx, "127.0.0.1:0", host, onError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err = net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	p, _ := net.LookupPort("tcp", port)
+	request := []byte{socksVersion, 1, socksNoAuth, socksVersion, socksConnect, 0, socksAddrDomain, 5}
+	request = append(request, "web02"...)
+	request = append(request, byte(p>>8), byte(p))
+	if _, err = conn.Write(request); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, 12)
+	if _, err = io.ReadFull(conn, reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply[1] != socksNoAuth || reply[3] != socksSucceeded {
+		t.Fatalf("Unexpected SOCKS reply: %v", reply)
+	}
+	expectEcho(t, conn)
+}
@@ -0,0 +1,287 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lidongpeng36/gsck/formatter"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// KeyScanAlgorithms are host key types scanned by default, one handshake for each
+var KeyScanAlgorithms = []string{
+	ssh.KeyAlgoED25519,
+	ssh.KeyAlgoECDSA256,
+	ssh.KeyAlgoRSA,
+}
+
+// errKeyScanned stops handshake once host key is received
+var errKeyScanned = errors.New("Host Key Scanned.")
+
+// Status of scanned key, compared with known_hosts
+const (
+	KeyNew     = "new"
+	KeySame    = "same"
+	KeyChanged = "changed"
+)
+
+// HostKeys holds keys that a host offers
+type HostKeys struct {
+	Index int
+	Alias string
+	Host  string
+	Port  string
+	Keys  []ssh.PublicKey
+	// Error is set if no key is scanned
+	Error string
+}
+
+// Address is how host appears in known_hosts, e.g. `host` or `[host]:2222`
+func (hk *HostKeys) Address() string {
+	return knownhosts.Normalize(net.JoinHostPort(hk.Host, hk.Port))
+}
+
+// Lines returns known_hosts lines of all keys
+func (hk *HostKeys) Lines() []string {
+	lines := make([]string, len(hk.Keys))
+	for i, key := range hk.Keys {
+		lines[i] = knownhosts.Line([]string{hk.Address()}, key)
+	}
+	return lines
+}
+
+// scanHostKey does a handshake with only @algorithm allowed, and returns host key of server.
+// It returns nil key, without error, if server does not have such key.
+func scanHostKey(ctx context.Context, addr, algorithm string) (key ssh.PublicKey, err error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+	stop := closeOnDone(ctx, conn)
+	defer stop()
+	_, _, _, err = ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+		HostKeyAlgorithms: []string{algorithm},
+		HostKeyCallback: func(hostname string, remote net.Addr, k ssh.PublicKey) error {
+			key = k
+			return errKeyScanned
+		},
+	})
+	if key != nil {
+		return key, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil && strings.Contains(err.Error(), "no common algorithm") {
+		return nil, nil
+	}
+	return
+}
+
+// ScanHostKeys fetches host keys of @algorithms (KeyScanAlgorithms if empty) from every host.
+// Hosts are scanned concurrently as Run does, within Parameter.ConnectTimeout for each key.
+// Nothing is sent to Formatter(s), and worker is not used.
+func (exec *Executor) ScanHostKeys(ctx context.Context, algorithms []string) (result []*HostKeys, err error) {
+	if err = exec.integration(); err != nil {
+		return
+	}
+	if len(algorithms) == 0 {
+		algorithms = KeyScanAlgorithms
+	}
+	data := exec.Parameter
+	result = make([]*HostKeys, len(data.HostInfoList))
+	for i, info := range data.HostInfoList {
+		result[i] = &HostKeys{Index: i, Alias: info.Alias, Host: info.Host, Port: info.Port}
+	}
+	ch, _ := runConcurrently(ctx, data, func(ctx context.Context, index int) *formatter.Output {
+		hk := result[index]
+		addr := net.JoinHostPort(hk.Host, hk.Port)
+		var lastErr error
+		for _, algorithm := range algorithms {
+			scanCtx, cancel := ctx, context.CancelFunc(func() {})
+			if data.ConnectTimeout > 0 {
+				scanCtx, cancel = context.WithTimeout(ctx, time.Duration(data.ConnectTimeout)*time.Second)
+			}
+			key, err := scanHostKey(scanCtx, addr, algorithm)
+			if err == context.DeadlineExceeded && ctx.Err() == nil {
+				err = errConnectTimeout
+			}
+			cancel()
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if key != nil {
+				hk.Keys = append(hk.Keys, key)
+			}
+		}
+		output := &formatter.Output{Hostname: hk.Host, Alias: hk.Alias}
+		if len(hk.Keys) == 0 {
+			if lastErr == nil {
+				lastErr = errors.New("No Host Key Scanned.")
+			}
+			output.ExitCode = -1
+			output.Error = lastErr.Error()
+		}
+		return output
+	})
+	for output := range ch {
+		if output.Error != "" {
+			result[exec.indexMap[output.Alias]].Error = output.Error
+		}
+	}
+	return
+}
+
+// knownHostsEntry is a parsed line of known_hosts
+type knownHostsEntry struct {
+	// raw is the original line, which is written back untouched if possible
+	raw    string
+	marker string
+	hosts  []string
+	key    ssh.PublicKey
+	// comment is kept with options of line
+	comment string
+}
+
+// parseKnownHosts parses @data line by line. Comments, blank and invalid lines are kept as raw.
+func parseKnownHosts(data []byte) (entries []*knownHostsEntry) {
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		entry := &knownHostsEntry{raw: line}
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			marker, hosts, key, comment, _, err := ssh.ParseKnownHosts([]byte(trimmed))
+			if err == nil {
+				entry.marker, entry.hosts, entry.key, entry.comment = marker, hosts, key, comment
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if len(data) == 0 {
+		entries = nil
+	}
+	return
+}
+
+// String formats entry back into a line
+func (e *knownHostsEntry) String() string {
+	line := knownhosts.Line(e.hosts, e.key)
+	if e.marker != "" {
+		line = "@" + e.marker + " " + line
+	}
+	if e.comment != "" {
+		line += " " + e.comment
+	}
+	return line
+}
+
+// knownHostsCallback looks keys up in @entries the way ssh does, so hashed and wildcard hosts match as well.
+// knownhosts only reads files, so entries are written to a temporary one.
+func knownHostsCallback(entries []*knownHostsEntry) (ssh.HostKeyCallback, error) {
+	file, err := ioutil.TempFile("", "gsck-known_hosts")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	for _, entry := range entries {
+		if entry.key != nil {
+			file.WriteString(strings.TrimSpace(entry.raw) + "\n")
+		}
+	}
+	if err = file.Close(); err != nil {
+		return nil, err
+	}
+	return knownhosts.New(file.Name())
+}
+
+// anyRemote is the remote address of lookups. It's not used, since the address is always given.
+var anyRemote = &net.TCPAddr{IP: net.IPv4zero}
+
+// DiffKnownHosts compares keys of @hk with known_hosts @data, and returns status for each key.
+// A key is changed only if the address has another key of the same type, or the key is revoked.
+func DiffKnownHosts(data []byte, hk *HostKeys) []string {
+	status := make([]string, len(hk.Keys))
+	callback, err := knownHostsCallback(parseKnownHosts(data))
+	for i, key := range hk.Keys {
+		status[i] = KeyNew
+		if err != nil {
+			continue
+		}
+		switch e := callback(net.JoinHostPort(hk.Host, hk.Port), anyRemote, key).(type) {
+		case nil:
+			status[i] = KeySame
+		case *knownhosts.RevokedError:
+			status[i] = KeyChanged
+		case *knownhosts.KeyError:
+			for _, want := range e.Want {
+				if want.Key.Type() == key.Type() {
+					status[i] = KeyChanged
+				}
+			}
+		}
+	}
+	return status
+}
+
+// MergeKnownHosts replaces keys of scanned hosts in known_hosts @data, and appends new ones.
+// For each host and key type, the old key is dropped from its line; other hosts in the line,
+// other lines and comments are kept. A hashed hostname is looked up like ssh does, and dropped as well if it matches.
+func MergeKnownHosts(data []byte, scanned []*HostKeys) []byte {
+	replaced := make(map[string]bool)
+	for _, hk := range scanned {
+		for _, key := range hk.Keys {
+			replaced[hk.Address()+" "+key.Type()] = true
+		}
+	}
+	// hashedReplaced tells if hashed @host of @entry is a scanned host, which has a key of the same type
+	hashedReplaced := func(entry *knownHostsEntry, host string) bool {
+		callback, err := knownHostsCallback([]*knownHostsEntry{{raw: knownhosts.Line([]string{host}, entry.key), key: entry.key}})
+		if err != nil {
+			return false
+		}
+		for _, hk := range scanned {
+			if replaced[hk.Address()+" "+entry.key.Type()] && callback(net.JoinHostPort(hk.Host, hk.Port), anyRemote, entry.key) == nil {
+				return true
+			}
+		}
+		return false
+	}
+	var buf bytes.Buffer
+	for _, entry := range parseKnownHosts(data) {
+		if entry.key == nil || entry.marker != "" {
+			buf.WriteString(entry.raw + "\n")
+			continue
+		}
+		hosts := entry.hosts[:0:0]
+		for _, host := range entry.hosts {
+			if strings.HasPrefix(host, "|") {
+				if !hashedReplaced(entry, host) {
+					hosts = append(hosts, host)
+				}
+			} else if !replaced[host+" "+entry.key.Type()] {
+				hosts = append(hosts, host)
+			}
+		}
+		if len(hosts) == len(entry.hosts) {
+			buf.WriteString(entry.raw + "\n")
+		} else if len(hosts) > 0 {
+			entry.hosts = hosts
+			buf.WriteString(entry.String() + "\n")
+		}
+	}
+	for _, hk := range scanned {
+		for _, line := range hk.Lines() {
+			buf.WriteString(line + "\n")
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,85 @@
+package executor
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newTestHostKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestKnownHosts(t *testing.T) {
+	oldKey, newKey, otherKey := newTestHostKey(t), newTestHostKey(t), newTestHostKey(t)
+	known := strings.Join([]string{
+		"# comment",
+		knownhosts.Line([]string{"web1", "web2"}, oldKey),
+		knownhosts.Line([]string{"[db1]:2222"}, otherKey),
+	}, "\n") + "\n"
+
+	scanned := []*HostKeys{
+		{Host: "web1", Port: "22", Keys: []ssh.PublicKey{newKey}},
+		{Host: "db1", Port: "2222", Keys: []ssh.PublicKey{otherKey}},
+		{Host: "app1", Port: "22", Keys: []ssh.PublicKey{newKey}},
+	}
+	for i, want := range []string{KeyChanged, KeySame, KeyNew} {
+		if status := DiffKnownHosts([]byte(known), scanned[i]); status[0] != want {
+			t.Fatalf("%s: expect %s, got %s", scanned[i].Host, want, status[0])
+		}
+	}
+
+	merged := string(MergeKnownHosts([]byte(known), scanned))
+	expected := strings.Join([]string{
+		"# comment",
+		knownhosts.Line([]string{"web2"}, oldKey),
+		knownhosts.Line([]string{"web1"}, newKey),
+		knownhosts.Line([]string{"[db1]:2222"}, otherKey),
+		knownhosts.Line([]string{"app1"}, newKey),
+	}, "\n") + "\n"
+	if merged != expected {
+		t.Fatalf("Unexpected merge:\n%s", merged)
+	}
+	for _, hk := range scanned {
+		if status := DiffKnownHosts([]byte(merged), hk); status[0] != KeySame {
+			t.Fatalf("%s should be same after merge, got %s", hk.Host, status[0])
+		}
+	}
+}
+
+func TestKnownHostsHashed(t *testing.T) {
+	oldKey, newKey, otherKey := newTestHostKey(t), newTestHostKey(t), newTestHostKey(t)
+	known := strings.Join([]string{
+		knownhosts.Line([]string{knownhosts.HashHostname("web1")}, oldKey),
+		knownhosts.Line([]string{knownhosts.HashHostname("[db1]:2222")}, otherKey),
+	}, "\n") + "\n"
+
+	scanned := []*HostKeys{
+		{Host: "web1", Port: "22", Keys: []ssh.PublicKey{newKey}},
+		{Host: "db1", Port: "2222", Keys: []ssh.PublicKey{otherKey}},
+	}
+	for i, want := range []string{KeyChanged, KeySame} {
+		if status := DiffKnownHosts([]byte(known), scanned[i]); status[0] != want {
+			t.Fatalf("%s: expect %s, got %s", scanned[i].Host, want, status[0])
+		}
+	}
+
+	merged := string(MergeKnownHosts([]byte(known), scanned[:1]))
+	lines := strings.Split(known, "\n")
+	expected := lines[1] + "\n" + knownhosts.Line([]string{"web1"}, newKey) + "\n"
+	if merged != expected {
+		t.Fatalf("Unexpected merge:\n%s", merged)
+	}
+}
@@ -0,0 +1,71 @@
+package executor
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/lidongpeng36/gsck/hostlist"
+)
+
+func init() {
+	RegisterWorker(func() Worker {
+		return new(kubectlExecutor)
+	})
+}
+
+// kubectlExecutor runs command in pods with `kubectl exec`.
+// Host is `namespace/pod[:container]`, or `pod[:container]` for namespace of current context.
+// Container is taken from Port of HostInfo, which is ignored if it's a number (e.g. the default 22).
+// File is streamed as tar into `tar` of the container, like what `kubectl cp` does.
+// Options:
+//   context: kubeconfig context to use
+//   kubeconfig: path to kubeconfig file
+// Killing `kubectl exec` (for timeout or cancellation) does not always stop command in container.
+type kubectlExecutor struct {
+	processWorker
+}
+
+// parsePod splits HostInfo into namespace, pod and container
+func parsePod(info *hostlist.HostInfo) (namespace, pod, container string) {
+	pod = info.Host
+	if i := strings.Index(pod, "/"); i >= 0 {
+		namespace, pod = pod[:i], pod[i+1:]
+	}
+	if _, err := strconv.Atoi(info.Port); err != nil {
+		container = info.Port
+	}
+	return
+}
+
+func (ke *kubectlExecutor) kubectlCommand(info *hostlist.HostInfo, cmd string) *exec.Cmd {
+	var args []string
+	if kubeconfig := ke.data.Options["kubeconfig"]; kubeconfig != "" {
+		args = append(args, "--kubeconfig", kubeconfig)
+	}
+	if context := ke.data.Options["context"]; context != "" {
+		args = append(args, "--context", context)
+	}
+	namespace, pod, container := parsePod(info)
+	if namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+	args = append(args, "exec", "-i", pod)
+	if container != "" {
+		args = append(args, "--container", container)
+	}
+	args = append(args, "--", "/bin/sh", "-c", cmd)
+	return exec.Command("kubectl", args...)
+}
+
+// pragma mark - Worker Interface
+
+func (ke *kubectlExecutor) Name() string {
+	return "kubectl"
+}
+
+func (ke *kubectlExecutor) Init(data *Parameter) error {
+	ke.command = ke.kubectlCommand
+	ke.archive = true
+	return ke.init(data)
+}
@@ -0,0 +1,52 @@
+package executor
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/lidongpeng36/gsck/hostlist"
+)
+
+func init() {
+	RegisterWorker(func() Worker {
+		return new(localExecutor)
+	})
+}
+
+// localExecutor runs command of each host with `/bin/sh` on local machine.
+// Host is described by environment variables: GSCK_HOST, GSCK_PORT, GSCK_ALIAS, GSCK_USER and GSCK_INDEX.
+type localExecutor struct {
+	processWorker
+}
+
+func localCommand(info *hostlist.HostInfo, cmd string) *exec.Cmd {
+	command := exec.Command("/bin/sh", "-c", cmd)
+	command.Env = append(os.Environ(),
+		"GSCK_HOST="+info.Host,
+		"GSCK_PORT="+info.Port,
+		"GSCK_ALIAS="+info.Alias,
+		"GSCK_USER="+info.User,
+		"GSCK_INDEX="+strconv.Itoa(info.Index),
+	)
+	return command
+}
+
+// pragma mark - Worker Interface
+
+func (le *localExecutor) Name() string {
+	return "local"
+}
+
+func (le *localExecutor) Init(data *Parameter) error {
+	le.command = localCommand
+	return le.init(data)
+}
+
+// Dial is part of WorkerWithDial interface. All hosts are the local machine.
+func (le *localExecutor) Dial(ctx context.Context, index int, network, addr string) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, addr)
+}
@@ -0,0 +1,184 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/lidongpeng36/gsck/config"
+	"github.com/lidongpeng36/gsck/formatter"
+)
+
+func init() {
+	RegisterWorker(func() Worker {
+		return new(mockExecutor)
+	})
+}
+
+// MockResponse is a canned result for a host.
+// If Error is set, host fails to connect, otherwise command gives Stdout/Stderr/ExitCode after Delay.
+type MockResponse struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exitcode"`
+	Error    string `json:"error"`
+	// Delay is in format of time.ParseDuration, e.g. "1.5s"
+	Delay string `json:"delay"`
+}
+
+// MockResponses are responses for successive tries of a host. The last one is repeated.
+// In fixture it could be a single object as well.
+type MockResponses []MockResponse
+
+// UnmarshalJSON accepts both object and array
+func (mr *MockResponses) UnmarshalJSON(data []byte) error {
+	var single MockResponse
+	if err := json.Unmarshal(data, &single); err == nil {
+		*mr = MockResponses{single}
+		return nil
+	}
+	var list []MockResponse
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*mr = list
+	return nil
+}
+
+// MockFixture is content of fixture file for mock worker:
+//   {
+//     "default": {"stdout": "ok"},
+//     "hosts": {
+//       "web01": {"stderr": "oops", "exitcode": 1, "delay": "2s"},
+//       "web02": [{"error": "connection refused"}, {"stdout": "ok"}]
+//     }
+//   }
+// Hosts are looked up by Alias. Those not listed get Default.
+type MockFixture struct {
+	Default MockResponses            `json:"default"`
+	Hosts   map[string]MockResponses `json:"hosts"`
+}
+
+// mockExecutor returns canned outputs from a fixture file, which is given by
+// Parameter.Options["fixture"], or config `mock.fixture`. Without fixture, every host succeeds silently.
+type mockExecutor struct {
+	data    *Parameter
+	fixture MockFixture
+}
+
+// LoadMockFixture reads fixture from @file
+func LoadMockFixture(file string) (fixture MockFixture, err error) {
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(buf, &fixture)
+	return
+}
+
+func (me *mockExecutor) responses(alias string) MockResponses {
+	if rs, ok := me.fixture.Hosts[alias]; ok && len(rs) > 0 {
+		return rs
+	}
+	if len(me.fixture.Default) > 0 {
+		return me.fixture.Default
+	}
+	return MockResponses{MockResponse{}}
+}
+
+// try plays @r, just like a real command.
+func (me *mockExecutor) try(ctx context.Context, r MockResponse) (phase string, rc int, err error) {
+	if r.Error != "" {
+		return RetryConnect, -1, errors.New(r.Error)
+	}
+	var delay time.Duration
+	if r.Delay != "" {
+		if delay, err = time.ParseDuration(r.Delay); err != nil {
+			return RetryExec, -1, err
+		}
+	}
+	execCtx, cancel := ctx, context.CancelFunc(func() {})
+	if me.data.Timeout > 0 {
+		execCtx, cancel = context.WithTimeout(ctx, time.Duration(me.data.Timeout)*time.Second)
+	}
+	defer cancel()
+	select {
+	case <-time.After(delay):
+	case <-execCtx.Done():
+		err = ctx.Err()
+		if err == nil {
+			err = errExecTimeout
+		}
+		return RetryExec, -1, err
+	}
+	if r.ExitCode != 0 {
+		err = errors.New(r.Stderr)
+	}
+	return RetryExec, r.ExitCode, err
+}
+
+func (me *mockExecutor) output(ctx context.Context, index int) *formatter.Output {
+	info := me.data.HostInfoList[index]
+	responses := me.responses(info.Alias)
+	start := time.Now()
+	var r MockResponse
+	var rc int
+	var mockErr error
+	tries := 0
+	attempts := me.data.Retry.do(ctx, func() (phase string, code int, err error) {
+		r = responses[len(responses)-1]
+		if tries < len(responses) {
+			r = responses[tries]
+		}
+		tries++
+		phase, rc, mockErr = me.try(ctx, r)
+		return phase, rc, mockErr
+	})
+	if mockErr != nil && ctx.Err() != nil {
+		mockErr = ctx.Err()
+	}
+	output := &formatter.Output{
+		Hostname: info.Host,
+		Alias:    info.Alias,
+		ExitCode: rc,
+		Start:    start,
+		End:      time.Now(),
+		Attempts: attempts,
+	}
+	output.Phases.Exec = output.End.Sub(start)
+	if mockErr == nil {
+		output.Stdout = r.Stdout
+		output.Stderr = r.Stderr
+	} else if !markInterrupted(output, mockErr) {
+		output.Error = mockErr.Error()
+	}
+	return output
+}
+
+// pragma mark - Worker Interface
+
+func (me *mockExecutor) Name() string {
+	return "mock"
+}
+
+func (me *mockExecutor) Init(data *Parameter) (err error) {
+	me.data = data
+	file := data.Options["fixture"]
+	if file == "" {
+		file = config.GetString("mock.fixture")
+	}
+	if file != "" {
+		me.fixture, err = LoadMockFixture(file)
+	}
+	if data.Stdin != nil {
+		go func() { _, _ = io.Copy(ioutil.Discard, data.Stdin) }()
+	}
+	return
+}
+
+func (me *mockExecutor) Execute(ctx context.Context) (<-chan *formatter.Output, <-chan error) {
+	return runConcurrently(ctx, me.data, me.output)
+}
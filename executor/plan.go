@@ -0,0 +1,74 @@
+package executor
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	"github.com/lidongpeng36/gsck/formatter"
+	"github.com/lidongpeng36/gsck/hostlist"
+)
+
+// WorkerWithPlan could tell what it would run for each host, without running it.
+// Workers that do not implement it are planned with the raw command of HostInfo.
+type WorkerWithPlan interface {
+	Plan(index int) formatter.Plan
+	Worker
+}
+
+// transferPlan describes Transfer, and how it's sent (@via)
+func (data *Parameter) transferPlan(via string) string {
+	if !data.NeedTransferFile() {
+		return ""
+	}
+	trans := data.Transfer
+	return fmt.Sprintf("%s -> %s (%s, %d bytes, via %s)", trans.Src, trans.Dst, trans.Perm, len(trans.Data), via)
+}
+
+// plan gives Plan of host @index
+func (exec *Executor) plan(index int) formatter.Plan {
+	if w, ok := exec.worker.(WorkerWithPlan); ok {
+		return w.Plan(index)
+	}
+	info := exec.Parameter.HostInfoList[index]
+	return formatter.Plan{
+		User: info.User,
+		Host: info.Host,
+		Port: info.Port,
+		Cmd:  info.Cmd,
+	}
+}
+
+// dryRun sends Plan of every host to Formatter(s), instead of running worker
+func (exec *Executor) dryRun() {
+	for i, info := range exec.Parameter.HostInfoList {
+		plan := exec.plan(i)
+		output := formatter.Output{
+			Index:    i,
+			Hostname: info.Host,
+			Alias:    info.Alias,
+			Stdout:   plan.String(),
+			Plan:     &plan,
+		}
+		for _, f := range exec.formatters {
+			f.Add(output)
+		}
+	}
+	for _, f := range exec.formatters {
+		f.Print()
+	}
+}
+
+// RenderTemplate executes @text as text/template with fields of @info, e.g. `echo {{.Alias}}:{{.Port}}`.
+// It renders commands, as well as contents sent to hosts.
+func RenderTemplate(text string, info *hostlist.HostInfo) (string, error) {
+	tmpl, err := template.New(info.Alias).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, info); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,345 @@
+package executor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lidongpeng36/gsck/config"
+	"github.com/lidongpeng36/gsck/formatter"
+	"github.com/lidongpeng36/gsck/plugin"
+)
+
+// pluginPrefix is prefix of plugin executables. What follows is the name of Worker.
+const pluginPrefix = "gsck-worker-"
+
+// pluginInitTimeout is how long to wait for plugin to be ready
+const pluginInitTimeout = 10 * time.Second
+
+var discoverOnce sync.Once
+
+// pluginDirs returns where to find plugins: config `plugin.dir`, and then PATH
+func pluginDirs() []string {
+	dir := config.GetString("plugin.dir")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".gsck", "plugins")
+	}
+	return append([]string{dir}, filepath.SplitList(os.Getenv("PATH"))...)
+}
+
+// loadPlugins registers plugins once. Config must be ready before.
+func loadPlugins() {
+	discoverOnce.Do(func() {
+		discoverPlugins(pluginDirs())
+	})
+}
+
+// discoverPlugins registers executables named `gsck-worker-<name>` in @dirs as Worker.
+// Workers registered earlier, including builtin ones, are never overridden.
+func discoverPlugins(dirs []string) {
+	for _, dir := range dirs {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, fi := range files {
+			name := strings.TrimPrefix(fi.Name(), pluginPrefix)
+			if name == fi.Name() || name == "" {
+				continue
+			}
+			if _, exists := constructorMap[name]; exists {
+				continue
+			}
+			file := filepath.Join(dir, fi.Name())
+			// Follow symlinks
+			if fi, err = os.Stat(file); err != nil || !fi.Mode().IsRegular() || fi.Mode().Perm()&0111 == 0 {
+				continue
+			}
+			RegisterWorker(func() Worker {
+				return &pluginWorker{name: name, path: file}
+			})
+		}
+	}
+}
+
+// pluginWorker runs an external plugin, and talks to it with package plugin's protocol.
+type pluginWorker struct {
+	name string
+	path string
+	data *Parameter
+	cmd  *exec.Cmd
+
+	stdin   io.WriteCloser
+	wmu     sync.Mutex
+	encoder *json.Encoder
+
+	mu      sync.Mutex
+	nextID  int
+	pending map[int]chan *plugin.Output
+	// exited is closed once plugin stops sending events, with the reason in exitErr
+	exited  chan struct{}
+	exitErr error
+}
+
+func (pw *pluginWorker) send(msg *plugin.Message) error {
+	pw.wmu.Lock()
+	defer pw.wmu.Unlock()
+	return pw.encoder.Encode(msg)
+}
+
+// read dispatches output events to the waiting hosts
+func (pw *pluginWorker) read(scanner *bufio.Scanner) {
+	defer close(pw.exited)
+	for scanner.Scan() {
+		var msg plugin.Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			pw.exitErr = fmt.Errorf("Plugin %s sent invalid message: %s", pw.name, err)
+			return
+		}
+		if msg.Type != plugin.TypeOutput {
+			continue
+		}
+		if msg.Output == nil {
+			msg.Output = new(plugin.Output)
+		}
+		pw.mu.Lock()
+		ch, ok := pw.pending[msg.ID]
+		delete(pw.pending, msg.ID)
+		pw.mu.Unlock()
+		if ok {
+			ch <- msg.Output
+		}
+	}
+	pw.exitErr = fmt.Errorf("Plugin %s exited", pw.name)
+	if err := scanner.Err(); err != nil {
+		pw.exitErr = fmt.Errorf("Plugin %s: %s", pw.name, err)
+	}
+}
+
+func (pw *pluginWorker) start() (err error) {
+	pw.cmd = exec.Command(pw.path)
+	pw.cmd.Stderr = os.Stderr
+	if pw.stdin, err = pw.cmd.StdinPipe(); err != nil {
+		return
+	}
+	stdout, err := pw.cmd.StdoutPipe()
+	if err != nil {
+		return
+	}
+	if err = pw.cmd.Start(); err != nil {
+		return
+	}
+	pw.encoder = json.NewEncoder(pw.stdin)
+	pw.pending = make(map[int]chan *plugin.Output)
+	pw.exited = make(chan struct{})
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1<<30)
+
+	params := &plugin.Init{
+		Version:        plugin.Version,
+		User:           pw.data.User,
+		Passwd:         pw.data.Passwd,
+		Concurrency:    pw.data.Concurrency,
+		ConnectTimeout: pw.data.ConnectTimeout,
+		Timeout:        pw.data.Timeout,
+		Options:        pw.data.Options,
+	}
+	if pw.data.NeedTransferFile() {
+		trans := pw.data.Transfer
+		params.Transfer = &plugin.Transfer{
+			Data:        trans.Data,
+			Perm:        trans.Perm,
+			Basename:    trans.Basename,
+			Destination: trans.Destination,
+			Dst:         trans.Dst,
+		}
+		if trans.hook != nil {
+			params.Transfer.Before = trans.hook.before
+			params.Transfer.After = trans.hook.after
+		}
+	}
+	readyc := make(chan error, 1)
+	go func() {
+		var msg plugin.Message
+		if !scanner.Scan() {
+			readyc <- fmt.Errorf("Plugin %s exited before ready", pw.name)
+			return
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			readyc <- fmt.Errorf("Plugin %s sent invalid message: %s", pw.name, err)
+			return
+		}
+		switch msg.Type {
+		case plugin.TypeReady:
+			readyc <- nil
+			pw.read(scanner)
+		case plugin.TypeError:
+			readyc <- fmt.Errorf("Plugin %s: %s", pw.name, msg.Error)
+		default:
+			readyc <- fmt.Errorf("Plugin %s sent %s before ready", pw.name, msg.Type)
+		}
+	}()
+	if err = pw.send(&plugin.Message{Type: plugin.TypeInit, Init: params}); err == nil {
+		select {
+		case err = <-readyc:
+		case <-time.After(pluginInitTimeout):
+			err = fmt.Errorf("Plugin %s is not ready in %s", pw.name, pluginInitTimeout)
+		}
+	}
+	if err != nil {
+		pw.stop()
+	}
+	return
+}
+
+// stop asks plugin to quit, and kills it if it does not in time
+func (pw *pluginWorker) stop() {
+	_ = pw.send(&plugin.Message{Type: plugin.TypeShutdown})
+	_ = pw.stdin.Close()
+	waitc := make(chan error, 1)
+	go func() {
+		waitc <- pw.cmd.Wait()
+	}()
+	select {
+	case <-waitc:
+	case <-time.After(killGrace):
+		_ = pw.cmd.Process.Kill()
+		<-waitc
+	}
+}
+
+// try sends an execute request, and waits for its output.
+// Once ctx is done or timeout, the request is cancelled, and plugin gets killGrace to answer.
+func (pw *pluginWorker) try(ctx context.Context, host *plugin.Host) (output *plugin.Output, err error) {
+	ch := make(chan *plugin.Output, 1)
+	pw.mu.Lock()
+	pw.nextID++
+	id := pw.nextID
+	pw.pending[id] = ch
+	pw.mu.Unlock()
+	if err = pw.send(&plugin.Message{Type: plugin.TypeExecute, ID: id, Host: host}); err != nil {
+		return
+	}
+	execCtx, cancel := ctx, context.CancelFunc(func() {})
+	if pw.data.Timeout > 0 {
+		// Plugin may need to connect first
+		timeout := time.Duration(pw.data.ConnectTimeout+pw.data.Timeout) * time.Second
+		execCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+	select {
+	case output = <-ch:
+		return
+	case <-pw.exited:
+		return nil, pw.exitErr
+	case <-execCtx.Done():
+	}
+	_ = pw.send(&plugin.Message{Type: plugin.TypeCancel, ID: id})
+	select {
+	case <-ch:
+	case <-pw.exited:
+	case <-time.After(killGrace):
+		pw.mu.Lock()
+		delete(pw.pending, id)
+		pw.mu.Unlock()
+	}
+	err = ctx.Err()
+	if err == nil {
+		err = errExecTimeout
+	}
+	return
+}
+
+func (pw *pluginWorker) output(ctx context.Context, index int) *formatter.Output {
+	info := pw.data.HostInfoList[index]
+	host := &plugin.Host{
+		Index: index,
+		Host:  info.Host,
+		Port:  info.Port,
+		Alias: info.Alias,
+		User:  info.User,
+		Cmd:   info.Cmd,
+	}
+	start := time.Now()
+	var result *plugin.Output
+	var rc int
+	var tryErr error
+	attempts := pw.data.Retry.do(ctx, func() (string, int, error) {
+		result, tryErr = pw.try(ctx, host)
+		if tryErr != nil {
+			rc = -1
+			return plugin.PhaseExec, rc, tryErr
+		}
+		rc = result.ExitCode
+		phase := result.Phase
+		if phase == "" {
+			phase = plugin.PhaseExec
+		}
+		if result.Error != "" {
+			return phase, rc, errors.New(result.Error)
+		}
+		return phase, rc, nil
+	})
+	if tryErr != nil && ctx.Err() != nil {
+		tryErr = ctx.Err()
+	}
+	output := &formatter.Output{
+		Hostname: info.Host,
+		Alias:    info.Alias,
+		ExitCode: rc,
+		Start:    start,
+		End:      time.Now(),
+		Attempts: attempts,
+	}
+	output.Phases.Exec = output.End.Sub(start)
+	if tryErr != nil {
+		if !markInterrupted(output, tryErr) {
+			output.Error = tryErr.Error()
+		}
+		return output
+	}
+	output.Stdout = strings.TrimSpace(result.Stdout)
+	output.Stderr = strings.TrimSpace(result.Stderr)
+	output.Error = result.Error
+	return output
+}
+
+// pragma mark - Worker Interface
+
+func (pw *pluginWorker) Name() string {
+	return pw.name
+}
+
+func (pw *pluginWorker) Init(data *Parameter) error {
+	if data.PTY || data.SudoUser != "" || data.Stdin != nil {
+		return errors.New("PTY, sudo and stdin streaming are not supported by plugins")
+	}
+	pw.data = data
+	if data.DryRun {
+		return nil
+	}
+	return pw.start()
+}
+
+func (pw *pluginWorker) Execute(ctx context.Context) (<-chan *formatter.Output, <-chan error) {
+	outputs, errc := runConcurrently(ctx, pw.data, pw.output)
+	ch := make(chan *formatter.Output)
+	go func() {
+		for output := range outputs {
+			ch <- output
+		}
+		pw.stop()
+		close(ch)
+	}()
+	return ch, errc
+}
@@ -0,0 +1,104 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lidongpeng36/gsck/plugin"
+)
+
+// testHandler is served by the test binary itself, when GSCK_TEST_PLUGIN is set
+type testHandler struct{}
+
+func (th testHandler) Init(params *plugin.Init) error {
+	if params.Options["fail"] != "" {
+		return errors.New(params.Options["fail"])
+	}
+	return nil
+}
+
+func (th testHandler) Execute(ctx context.Context, host *plugin.Host) *plugin.Output {
+	switch host.Cmd {
+	case "sleep":
+		<-ctx.Done()
+		return &plugin.Output{ExitCode: -1, Error: "killed"}
+	case "refuse":
+		return &plugin.Output{ExitCode: -1, Error: "refused", Phase: plugin.PhaseConnect}
+	}
+	return &plugin.Output{Stdout: host.Alias + ": " + host.Cmd}
+}
+
+func TestMain(m *testing.M) {
+	if os.Getenv("GSCK_TEST_PLUGIN") != "" {
+		if err := plugin.Serve(testHandler{}); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func setupTestPlugin(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "gsck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink(self, filepath.Join(dir, pluginPrefix+"test")); err != nil {
+		t.Fatal(err)
+	}
+	discoverPlugins([]string{dir})
+	os.Setenv("GSCK_TEST_PLUGIN", "1")
+	return func() {
+		os.Unsetenv("GSCK_TEST_PLUGIN")
+		os.RemoveAll(dir)
+	}
+}
+
+func TestPluginWorker(t *testing.T) {
+	defer setupTestPlugin(t)()
+	found := false
+	for _, name := range Available() {
+		found = found || name == "test"
+	}
+	if !found {
+		t.Fatalf("Plugin is not available")
+	}
+
+	p := Parameter{Method: "test", Cmd: "uptime", Retry: RetryPolicy{Count: 1}}
+	c, failed, err := runExecutor(t, context.Background(), p, "web01", "web02")
+	if err != nil || failed != 0 {
+		t.Fatalf("Expected success. Actual: failed %d, error %v", failed, err)
+	}
+	if o := c.outputs["web02"]; o.Stdout != "web02: uptime" {
+		t.Fatalf("Unexpected output: %+v", o)
+	}
+
+	p.Cmd = "refuse"
+	c, failed, _ = runExecutor(t, context.Background(), p, "web01")
+	if o := c.outputs["web01"]; failed != 1 || o.Error != "refused" || len(o.Attempts) != 1 {
+		t.Fatalf("Unexpected output: %+v", o)
+	}
+
+	p.Cmd = "sleep"
+	p.Timeout = 1
+	start := time.Now()
+	c, failed, _ = runExecutor(t, context.Background(), p, "web01")
+	if o := c.outputs["web01"]; failed != 1 || !o.TimedOut || time.Since(start) > 5*time.Second {
+		t.Fatalf("Unexpected output: %+v", o)
+	}
+
+	exec, _ := NewExecutor(Parameter{Method: "test", Options: map[string]string{"fail": "bad option"}})
+	exec.SetHostlist([]string{"web01"})
+	if _, err := exec.Run(); err == nil || err.Error() != "Plugin test: bad option" {
+		t.Fatalf("Expected init error. Actual: %v", err)
+	}
+}
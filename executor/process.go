@@ -0,0 +1,281 @@
+package executor
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lidongpeng36/gsck/formatter"
+	"github.com/lidongpeng36/gsck/hostlist"
+	"github.com/lidongpeng36/gsck/util"
+)
+
+// processWorker is base of Workers which run command of each host through a local process,
+// such as `/bin/sh -c`, `docker exec` or `kubectl exec`.
+type processWorker struct {
+	data      *Parameter
+	cmds      []string
+	broadcast *stdinBroadcast
+	// command builds the local process that runs @cmd for host
+	command func(info *hostlist.HostInfo, cmd string) *exec.Cmd
+	// archive makes file transferred as a tar stream and extracted by `tar` on host,
+	// which keeps perm (when extracted by root) without `chmod`.
+	// Set it before init.
+	archive bool
+	// transfer is what to write into stdin for file transfer
+	transfer []byte
+}
+
+func (pw *processWorker) init(data *Parameter) error {
+	if data.PTY || data.SudoUser != "" {
+		return errors.New("PTY and sudo are only supported by ssh")
+	}
+	if data.Stdin != nil && data.NeedTransferFile() {
+		return errors.New("Cannot stream stdin along with file transfer")
+	}
+	pw.data = data
+	if data.NeedTransferFile() {
+		pw.transfer = data.Transfer.Data
+		if pw.archive {
+			var err error
+			if pw.transfer, err = tarFile(data.Transfer); err != nil {
+				return err
+			}
+		}
+	}
+	pw.cmds = make([]string, len(data.HostInfoList))
+	for i, info := range data.HostInfoList {
+		pw.cmds[i] = pw.assembleCmd(info.Cmd)
+	}
+	if data.Stdin != nil {
+		pw.broadcast = newStdinBroadcast(data.Stdin, len(data.HostInfoList))
+	}
+	return nil
+}
+
+// assembleCmd is like sshExecutor.assembleSSHCmd, but file is piped into `cat` (or `tar`) through stdin.
+func (pw *processWorker) assembleCmd(cmd string) string {
+	var transferCmd string
+	if pw.data.NeedTransferFile() {
+		trans := pw.data.Transfer
+		basename := util.ShellQuote(trans.Basename)
+		transferCmd = "cd " + trans.Destination + " && "
+		if pw.archive {
+			transferCmd += "tar xmf - && "
+		} else {
+			transferCmd += "cat > " + basename + " && chmod " + trans.Perm + " " + basename + " && "
+		}
+		transferCmd += fmt.Sprintf("echo '%s saved.'", trans.Dst)
+	}
+	transferCmd = pw.data.WrapCmdWithHook(transferCmd)
+	return util.WrapCmdBefore(cmd, transferCmd)
+}
+
+// tarFile packs @trans into a tar archive with a single file
+func tarFile(trans *TransferFile) ([]byte, error) {
+	perm, err := strconv.ParseUint(trans.Perm, 0, 32)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	header := &tar.Header{
+		Name:    trans.Basename,
+		Mode:    int64(perm),
+		Size:    int64(len(trans.Data)),
+		ModTime: time.Now(),
+	}
+	if err = tw.WriteHeader(header); err != nil {
+		return nil, err
+	}
+	if _, err = tw.Write(trans.Data); err != nil {
+		return nil, err
+	}
+	if err = tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// run starts process in its own process group, and kills the whole group if ctx is done or timeout.
+func (pw *processWorker) run(ctx context.Context, cmd *exec.Cmd, stdin io.Reader) (stdout, stderr string, rc int, err error) {
+	var stdoutBuf, stderrBuf bytes.Buffer
+	cmd.Stdout = &stdoutBuf
+	cmd.Stderr = &stderrBuf
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	var stdinPipe io.WriteCloser
+	if stdin != nil {
+		if stdinPipe, err = cmd.StdinPipe(); err != nil {
+			rc = -1
+			return
+		}
+	}
+	if err = cmd.Start(); err != nil {
+		rc = -1
+		return
+	}
+	if stdin != nil {
+		go func() {
+			_, _ = io.Copy(stdinPipe, stdin)
+			_ = stdinPipe.Close()
+		}()
+	}
+	waitc := make(chan error, 1)
+	go func() {
+		waitc <- cmd.Wait()
+	}()
+	execCtx, cancel := ctx, context.CancelFunc(func() {})
+	if pw.data.Timeout > 0 {
+		execCtx, cancel = context.WithTimeout(ctx, time.Duration(pw.data.Timeout)*time.Second)
+	}
+	defer cancel()
+	select {
+	case err = <-waitc:
+	case <-execCtx.Done():
+		killProcessGroup(cmd, waitc)
+		rc = -1
+		err = ctx.Err()
+		if err == nil {
+			err = errExecTimeout
+		}
+		return
+	}
+	stdout = strings.TrimSpace(stdoutBuf.String())
+	stderr = strings.TrimSpace(stderrBuf.String())
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			rc = exitErr.Sys().(syscall.WaitStatus).ExitStatus()
+			err = errors.New(stderr)
+		} else {
+			rc = -1
+		}
+	}
+	return
+}
+
+// killProcessGroup sends SIGTERM, and then SIGKILL, to process group of @cmd
+func killProcessGroup(cmd *exec.Cmd, waitc <-chan error) {
+	for _, sig := range []syscall.Signal{syscall.SIGTERM, syscall.SIGKILL} {
+		_ = syscall.Kill(-cmd.Process.Pid, sig)
+		select {
+		case <-waitc:
+			return
+		case <-time.After(killGrace):
+		}
+	}
+}
+
+func (pw *processWorker) output(ctx context.Context, index int) *formatter.Output {
+	info := pw.data.HostInfoList[index]
+	start := time.Now()
+	var stdout, stderr string
+	var rc int
+	var phases formatter.Phases
+	var clientErr error
+	joined := false
+	retry := pw.data.Retry
+	if pw.broadcast != nil {
+		retry.Exec = false
+	}
+	attempts := retry.do(ctx, func() (string, int, error) {
+		phases = formatter.Phases{}
+		var stdin io.Reader
+		if pw.data.NeedTransferFile() {
+			stdin = bytes.NewReader(pw.transfer)
+		}
+		if pw.broadcast != nil {
+			joined = true
+			reader := pw.broadcast.join()
+			defer func() { _ = reader.Close() }()
+			stdin = reader
+		}
+		execStart := time.Now()
+		stdout, stderr, rc, clientErr = pw.run(ctx, pw.command(info, pw.cmds[index]), stdin)
+		phases.Exec = time.Since(execStart)
+		return RetryExec, rc, clientErr
+	})
+	if pw.broadcast != nil && !joined {
+		pw.broadcast.leave()
+	}
+	if clientErr != nil && ctx.Err() != nil {
+		clientErr = ctx.Err()
+	}
+	output := &formatter.Output{
+		Hostname: info.Host,
+		Alias:    info.Alias,
+		ExitCode: rc,
+		Start:    start,
+		End:      time.Now(),
+		Phases:   phases,
+		Attempts: attempts,
+	}
+	if clientErr == nil {
+		output.Stdout = stdout
+		output.Stderr = stderr
+	} else if !markInterrupted(output, clientErr) {
+		output.Error = clientErr.Error()
+	}
+	return output
+}
+
+// Execute is part of Worker interface
+func (pw *processWorker) Execute(ctx context.Context) (<-chan *formatter.Output, <-chan error) {
+	return runConcurrently(ctx, pw.data, pw.output)
+}
+
+func (pw *processWorker) transferVia() string {
+	if pw.archive {
+		return "tar stream"
+	}
+	return "stdin"
+}
+
+// Plan is part of WorkerWithPlan interface
+func (pw *processWorker) Plan(index int) formatter.Plan {
+	info := pw.data.HostInfoList[index]
+	return formatter.Plan{
+		User:     info.User,
+		Host:     info.Host,
+		Port:     info.Port,
+		Cmd:      pw.cmds[index],
+		Transfer: pw.data.transferPlan(pw.transferVia()),
+	}
+}
+
+// Stream is part of WorkerWithStream interface
+func (pw *processWorker) Stream(ctx context.Context, index int, stdout, stderr io.Writer) error {
+	if pw.data.NeedTransferFile() || pw.broadcast != nil {
+		return errors.New("Cannot stream output along with file transfer or stdin streaming")
+	}
+	// Command of host may have changed since init
+	info := pw.data.HostInfoList[index]
+	cmd := pw.command(info, pw.assembleCmd(info.Cmd))
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	waitc := make(chan error, 1)
+	go func() {
+		waitc <- cmd.Wait()
+	}()
+	select {
+	case err := <-waitc:
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return &ExitError{ExitCode: exitErr.Sys().(syscall.WaitStatus).ExitStatus()}
+		}
+		return err
+	case <-ctx.Done():
+		killProcessGroup(cmd, waitc)
+		return ctx.Err()
+	}
+}
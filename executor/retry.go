@@ -0,0 +1,117 @@
+package executor
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/lidongpeng36/gsck/formatter"
+)
+
+// Phases that could be retried
+const (
+	RetryConnect = "connect"
+	RetryExec    = "exec"
+)
+
+// Defaults for RetryPolicy
+const (
+	defaultRetryBackoff    = time.Second
+	defaultRetryMaxBackoff = 30 * time.Second
+	defaultRetryJitter     = 0.2
+)
+
+var randGen = rand.New(rand.NewSource(time.Now().UnixNano()))
+var randMu sync.Mutex
+
+// RetryPolicy tells worker when and how to retry a failed host.
+// Connection failures are always retried. Command is retried only if Exec is set.
+type RetryPolicy struct {
+	// Count is how many retries are allowed after the first try
+	Count int
+	// Backoff is the delay before first retry. It doubles for each retry, but never exceeds MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Jitter (0 ~ 1) randomizes each delay by ±Jitter*delay
+	Jitter float64
+	// Exec enables retrying the command, if it exits with one of ExitCodes (or any non-zero code if empty)
+	Exec      bool
+	ExitCodes []int
+}
+
+// NewRetryPolicy returns RetryPolicy with default backoff for @count retries
+func NewRetryPolicy(count int) RetryPolicy {
+	return RetryPolicy{
+		Count:      count,
+		Backoff:    defaultRetryBackoff,
+		MaxBackoff: defaultRetryMaxBackoff,
+		Jitter:     defaultRetryJitter,
+	}
+}
+
+// delay returns how long to wait before the @n th retry (starts from 0)
+func (rp *RetryPolicy) delay(n int) time.Duration {
+	d := rp.Backoff
+	for i := 0; i < n && (rp.MaxBackoff <= 0 || d < rp.MaxBackoff); i++ {
+		d *= 2
+	}
+	if rp.MaxBackoff > 0 && d > rp.MaxBackoff {
+		d = rp.MaxBackoff
+	}
+	if rp.Jitter > 0 && d > 0 {
+		randMu.Lock()
+		r := randGen.Float64()
+		randMu.Unlock()
+		d += time.Duration((2*r - 1) * rp.Jitter * float64(d))
+	}
+	return d
+}
+
+func (rp *RetryPolicy) shouldRetry(phase string, rc int, err error) bool {
+	switch phase {
+	case RetryConnect:
+		return err != nil
+	case RetryExec:
+		if !rp.Exec || rc == 0 {
+			return false
+		}
+		if len(rp.ExitCodes) == 0 {
+			return true
+		}
+		for _, code := range rp.ExitCodes {
+			if code == rc {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// do calls @try until it succeeds, or policy gives up, or ctx is done.
+// @try returns the phase it stops at, with exit code and error.
+// Tries that are retried are returned as Attempts.
+func (rp *RetryPolicy) do(ctx context.Context, try func() (phase string, rc int, err error)) (attempts []formatter.Attempt) {
+	for n := 0; ; n++ {
+		start := time.Now()
+		phase, rc, err := try()
+		if n >= rp.Count || ctx.Err() != nil || !rp.shouldRetry(phase, rc, err) {
+			return
+		}
+		attempt := formatter.Attempt{
+			Phase:    phase,
+			ExitCode: rc,
+			Start:    start,
+			Duration: time.Since(start),
+		}
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+		attempts = append(attempts, attempt)
+		select {
+		case <-time.After(rp.delay(n)):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
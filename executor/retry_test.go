@@ -0,0 +1,51 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for n, e := range expected {
+		if d := policy.delay(n); d != e {
+			t.Fatalf("Retry #%d Expected: %s. Actual: %s", n, e, d)
+		}
+	}
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := policy.delay(1); d < time.Second || d > 3*time.Second {
+			t.Fatalf("Jittered delay out of range: %s", d)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	policy := RetryPolicy{Count: 3, Exec: true, ExitCodes: []int{255}}
+	results := []struct {
+		phase string
+		rc    int
+		err   error
+	}{
+		{RetryConnect, -1, errors.New("refused")},
+		{RetryExec, 255, errors.New("flaky")},
+		{RetryExec, 1, errors.New("failed")},
+		{RetryExec, 0, nil},
+	}
+	tries := 0
+	attempts := policy.do(context.Background(), func() (string, int, error) {
+		r := results[tries]
+		tries++
+		return r.phase, r.rc, r.err
+	})
+	// exit code 1 is not in ExitCodes, so the third try is final
+	if tries != 3 || len(attempts) != 2 {
+		t.Fatalf("Expected 3 tries with 2 attempts recorded. Actual: %d tries, %d attempts", tries, len(attempts))
+	}
+	if attempts[0].Phase != RetryConnect || attempts[1].ExitCode != 255 {
+		t.Fatalf("Unexpected attempts: %+v", attempts)
+	}
+}
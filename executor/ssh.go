@@ -2,10 +2,13 @@ package executor
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"math/rand"
 	"net"
 	"os"
 	"path"
@@ -19,9 +22,6 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-var randSrc = rand.NewSource(time.Now().UnixNano())
-var randGen = rand.New(randSrc)
-
 func init() {
 	RegisterWorker(func() Worker {
 		return &sshExecutor{
@@ -53,53 +53,239 @@ func getKeyFile(t string) (key ssh.Signer, err error) {
 	return
 }
 
+// hostKeyPolicyAny accepts any host key. Policy is part of pool key, so connections
+// accepted by a looser policy are never given to a stricter one.
+const hostKeyPolicyAny = "any"
+
+// sshIdentity hashes what a connection is authenticated with, and how host key is verified
+func sshIdentity(signers []ssh.Signer, passwd, account, hostKeyPolicy string) string {
+	h := sha256.New()
+	for _, signer := range signers {
+		_, _ = h.Write(signer.PublicKey().Marshal())
+	}
+	// Length prefixed, so fields never run into each other
+	for _, field := range []string{passwd, account, hostKeyPolicy} {
+		fmt.Fprintf(h, "%d:%s", len(field), field)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// killGrace is how long a remote process has to exit after each signal
+var killGrace = 2 * time.Second
+
+// keepAliveCountMax is how many keepalive replies could be missed before connection is considered lost
+const keepAliveCountMax = 3
+
 type sshClient struct {
 	hostname string
 	alias    string
 	port     string
-	cmd      string
-	timeout  int64
-	client   *ssh.Client
-	session  *ssh.Session
-	config   *ssh.ClientConfig
-	retry    int
+	// timeout for connection and command. Unit: s
+	connectTimeout int64
+	timeout        int64
+	keepAlive      int64
+	client         *ssh.Client
+	session        *ssh.Session
+	config         *ssh.ClientConfig
+	retry          RetryPolicy
+	pty            bool
+	sudo           bool
+	passwd         string
+	broadcast      *stdinBroadcast
+	joined         bool
+	// steps are run one by one, each in its own session of the same connection
+	steps []sshStep
+	pool  *SSHPool
+	// identity is hash of credentials and host key policy, which is part of pool key
+	identity string
+}
+
+// sshStep is a command that runs in its own session
+type sshStep struct {
+	cmd string
+	// transfer is sent to cmd by scp protocol
 	transfer *TransferFile
+	// stdin makes cmd receive broadcast
+	stdin bool
 }
 
-func (sc sshClient) exec() (stdout, stderr string, rc int, err error) {
-	timeout := sc.timeout
-	for retry := sc.retry; retry >= 0; retry-- {
-		connectError := make(chan error, 0)
-		go func() {
-			var _err error
-			sc.client, _err = ssh.Dial("tcp", sc.hostname+":"+sc.port, sc.config)
-			connectError <- _err
-		}()
-		go func() {
-			if timeout > 0 {
-				time.Sleep(time.Duration(timeout) * time.Second)
-				connectError <- errors.New("Connection Timeout.")
+// dial connects to host. Both TCP connect and SSH handshake are aborted once ctx is done.
+func (sc *sshClient) dial(ctx context.Context) (*ssh.Client, error) {
+	addr := net.JoinHostPort(sc.hostname, sc.port)
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	handshaked := make(chan struct{})
+	defer close(handshaked)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-handshaked:
+		}
+	}()
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, sc.config)
+	if err != nil {
+		_ = conn.Close()
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// keepAlive sends keepalive@openssh.com every @interval until done is closed.
+// Client is closed if server misses keepAliveCountMax replies in a row.
+func keepAlive(client *ssh.Client, interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	replied := make(chan error, 1)
+	pending, missed := false, 0
+	for {
+		select {
+		case <-done:
+			return
+		case err := <-replied:
+			pending = false
+			if err != nil {
+				_ = client.Close()
+				return
 			}
-		}()
-		if err = <-connectError; err == nil {
-			break
-		} else if retry > 0 {
-			ms := randGen.Int63n(1000)
-			if sc.client != nil {
-				_ = sc.client.Close()
+			missed = 0
+		case <-ticker.C:
+			if pending {
+				missed++
+				if missed >= keepAliveCountMax {
+					_ = client.Close()
+					return
+				}
+				continue
 			}
-			time.Sleep(time.Duration(ms) * time.Millisecond)
-		} else {
-			rc = -1
+			pending = true
+			go func() {
+				_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+				replied <- err
+			}()
+		}
+	}
+}
+
+// kill asks remote process to quit: SIGTERM first, then SIGKILL.
+// Some sshd ignore signal requests, so PTY session gets a `C-c` as well, and hangs up on close.
+func (sc *sshClient) kill(stdin io.Writer, waitc <-chan error) {
+	for _, sig := range []ssh.Signal{ssh.SIGTERM, ssh.SIGKILL} {
+		_ = sc.session.Signal(sig)
+		select {
+		case <-waitc:
 			return
+		case <-time.After(killGrace):
 		}
 	}
+	if sc.pty && stdin != nil {
+		_, _ = stdin.Write([]byte{3})
+	}
+	_ = sc.session.Close()
+}
+
+// connect gets connection from pool, or dials host within connectTimeout, and starts keepalive if needed.
+// Keepalive stops once client is closed.
+func (sc *sshClient) connect(ctx context.Context) (err error) {
+	sc.client, err = sc.getClient(ctx)
+	return
+}
+
+// getClient is connect, but leaves sc.client untouched, so that it could be called concurrently.
+// Client must be given back to pool.
+func (sc *sshClient) getClient(ctx context.Context) (client *ssh.Client, err error) {
+	client, err = sc.pool.get(ctx, sc.poolKey(), func(ctx context.Context) (*ssh.Client, error) {
+		dialCtx, cancel := ctx, context.CancelFunc(func() {})
+		if sc.connectTimeout > 0 {
+			dialCtx, cancel = context.WithTimeout(ctx, time.Duration(sc.connectTimeout)*time.Second)
+		}
+		defer cancel()
+		client, err := sc.dial(dialCtx)
+		if err != nil {
+			// Timed out dial is *net.OpError, instead of ctx's error
+			if ctx.Err() == nil && dialCtx.Err() == context.DeadlineExceeded {
+				return nil, errConnectTimeout
+			}
+			return nil, err
+		}
+		if sc.keepAlive > 0 {
+			closed := make(chan struct{})
+			go func() {
+				_ = client.Wait()
+				close(closed)
+			}()
+			go keepAlive(client, time.Duration(sc.keepAlive)*time.Second, closed)
+		}
+		return client, nil
+	})
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return
+}
+
+func (sc *sshClient) poolKey() string {
+	return sshPoolKey(sc.identity, sc.config.User, sc.hostname, sc.port)
+}
+
+// exec runs steps one by one, and stops at the first failed one.
+// Outputs of steps are joined together.
+func (sc *sshClient) exec(ctx context.Context) (stdout, stderr string, rc int, phases formatter.Phases, err error) {
+	execStart := time.Now()
 	defer func() {
-		// Close client
-		_ = sc.client.Close()
+		phases.Exec = time.Since(execStart)
 	}()
+	// Timeout is for all steps
+	execCtx, cancel := ctx, context.CancelFunc(func() {})
+	if sc.timeout > 0 {
+		execCtx, cancel = context.WithTimeout(ctx, time.Duration(sc.timeout)*time.Second)
+	}
+	defer cancel()
+	var stdouts, stderrs []string
+	defer func() {
+		stdout = strings.Join(stdouts, "\n")
+		stderr = strings.Join(stderrs, "\n")
+	}()
+	for _, step := range sc.steps {
+		stepStart := time.Now()
+		var stepStdout, stepStderr string
+		stepStdout, stepStderr, rc, err = sc.runStep(execCtx, step)
+		if step.transfer != nil {
+			phases.Transfer = time.Since(stepStart)
+		}
+		if stepStdout != "" {
+			stdouts = append(stdouts, stepStdout)
+		}
+		if stepStderr != "" {
+			stderrs = append(stderrs, stepStderr)
+		}
+		if err != nil {
+			if execCtx.Err() != nil {
+				err = ctx.Err()
+				if err == nil {
+					err = errExecTimeout
+				}
+			}
+			return
+		}
+	}
+	return
+}
+
+// runStep runs @step in a new session of connected client, and kills it once ctx is done
+func (sc *sshClient) runStep(ctx context.Context, step sshStep) (stdout, stderr string, rc int, err error) {
 	sc.session, err = sc.client.NewSession()
 	if err != nil {
+		// Connection seems broken, make it dialed again
+		sc.pool.discard(sc.poolKey(), sc.client)
+		sc.client = nil
+		rc = -1
 		return
 	}
 	defer func() {
@@ -109,51 +295,130 @@ func (sc sshClient) exec() (stdout, stderr string, rc int, err error) {
 	var stdoutBuf, stderrBuf bytes.Buffer
 	sc.session.Stdout = &stdoutBuf
 	sc.session.Stderr = &stderrBuf
-	execError := make(chan error, 0)
-	if sc.transfer != nil {
+	var stdin io.WriteCloser
+	if step.transfer != nil || sc.pty || step.stdin {
+		if stdin, err = sc.session.StdinPipe(); err != nil {
+			rc = -1
+			return
+		}
+	}
+	if sc.pty {
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          0,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+		if err = sc.session.RequestPty("xterm", 40, 80, modes); err != nil {
+			rc = -1
+			return
+		}
+	}
+	var answerer *promptAnswerer
+	if sc.sudo {
+		answerer = newPromptAnswerer(&stdoutBuf, stdin, sudoPrompt, sc.passwd)
+		sc.session.Stdout = answerer
+	}
+	if err = sc.session.Start(step.cmd); err != nil {
+		rc = -1
+		return
+	}
+	if step.stdin {
+		sc.joined = true
+		reader := sc.broadcast.join()
+		defer func() { _ = reader.Close() }()
 		go func() {
-			stdin, _err := sc.session.StdinPipe()
+			_, _ = io.Copy(stdin, reader)
+			_ = stdin.Close()
+		}()
+	}
+	if step.transfer != nil {
+		go func(trans *TransferFile) {
 			defer func() { _ = stdin.Close() }()
-			if _err != nil {
-				execError <- _err
-			}
-			fmt.Fprintf(stdin, "C%v %v %v\n", sc.transfer.Perm, len(sc.transfer.Data), sc.transfer.Basename)
-			_, _ = stdin.Write(sc.transfer.Data)
+			fmt.Fprintf(stdin, "C%v %v %v\n", trans.Perm, len(trans.Data), trans.Basename)
+			_, _ = stdin.Write(trans.Data)
 			fmt.Fprint(stdin, "\x00")
-		}()
+		}(step.transfer)
 	}
+	waitc := make(chan error, 1)
 	go func() {
-		_err := sc.session.Run(sc.cmd)
-		stdout = strings.TrimSpace(stdoutBuf.String())
-		stderr = strings.TrimSpace(stderrBuf.String())
-		if _err != nil {
-			sshErr := _err.(*ssh.ExitError)
-			rc = sshErr.ExitStatus()
-			execError <- errors.New(stderr)
-		}
-		execError <- nil
+		waitc <- sc.session.Wait()
 	}()
-	go func() {
-		if timeout > 0 {
-			time.Sleep(time.Duration(timeout) * time.Second)
-			execError <- errors.New("Execution Timeout.")
+	select {
+	case err = <-waitc:
+	case <-ctx.Done():
+		sc.kill(stdin, waitc)
+		rc = -1
+		err = ctx.Err()
+		return
+	}
+	if answerer != nil {
+		_ = answerer.Flush()
+	}
+	stdout = strings.TrimSpace(stdoutBuf.String())
+	stderr = strings.TrimSpace(stderrBuf.String())
+	if sc.pty {
+		stdout = strings.Replace(stdout, "\r\n", "\n", -1)
+	}
+	if sc.sudo && sc.passwd != "" {
+		// Never leak password, even if remote echoes it
+		stdout = strings.Replace(stdout, sc.passwd, "********", -1)
+		stderr = strings.Replace(stderr, sc.passwd, "********", -1)
+	}
+	if err != nil {
+		if exitErr, ok := err.(*ssh.ExitError); ok {
+			rc = exitErr.ExitStatus()
+			err = errors.New(stderr)
+		} else {
+			rc = -1
 		}
-	}()
-	err = <-execError
+	}
 	return
 }
 
-func (sc *sshClient) output() *formatter.Output {
-	stdout, stderr, rc, clientErr := sc.exec()
+func (sc *sshClient) output(ctx context.Context) *formatter.Output {
+	start := time.Now()
+	var stdout, stderr string
+	var rc int
+	var phases formatter.Phases
+	var clientErr error
+	attempts := sc.retry.do(ctx, func() (string, int, error) {
+		connectStart := time.Now()
+		phases = formatter.Phases{}
+		if clientErr = sc.connect(ctx); clientErr != nil {
+			rc = -1
+			return RetryConnect, rc, clientErr
+		}
+		defer func() {
+			// Give client back to pool, if it's not discarded
+			if sc.client != nil {
+				sc.pool.release(sc.poolKey(), sc.client)
+			}
+		}()
+		phases.Connect = time.Since(connectStart)
+		var execPhases formatter.Phases
+		stdout, stderr, rc, execPhases, clientErr = sc.exec(ctx)
+		phases.Transfer, phases.Exec = execPhases.Transfer, execPhases.Exec
+		return RetryExec, rc, clientErr
+	})
+	if sc.broadcast != nil && !sc.joined {
+		sc.broadcast.leave()
+	}
+	if clientErr != nil && ctx.Err() != nil {
+		clientErr = ctx.Err()
+	}
 	output := &formatter.Output{
 		Hostname: sc.hostname,
 		Alias:    sc.alias,
 		ExitCode: rc,
+		Start:    start,
+		End:      time.Now(),
+		Phases:   phases,
+		Attempts: attempts,
 	}
 	if clientErr == nil {
 		output.Stdout = stdout
 		output.Stderr = stderr
-	} else {
+	} else if !markInterrupted(output, clientErr) {
 		output.Error = clientErr.Error()
 	}
 	return output
@@ -163,18 +428,42 @@ type sshExecutor struct {
 	config  *ssh.ClientConfig
 	clients []*sshClient
 	data    *Parameter
+	signers []ssh.Signer
+	// knownHosts is loaded once for Check
+	knownHosts     ssh.HostKeyCallback
+	knownHostsOnce sync.Once
 }
 
-func (ss *sshExecutor) assembleSSHCmd(cmd string) string {
-	var transferCmd string
-	if ss.data.NeedTransferFile() {
-		trans := ss.data.Transfer
-		transferCmd = "cd " + trans.Destination +
-			" && /usr/bin/scp -qrt ." + " && " +
-			fmt.Sprintf("echo '%s saved.'", trans.Dst)
+// assembleSSHSteps splits work of a host into steps: before hook, file transfer, after hook and cmd.
+// They share one connection, and it's the same as `before && transfer && after && cmd`.
+func (ss *sshExecutor) assembleSSHSteps(cmd string) (steps []sshStep) {
+	data := ss.data
+	var hook transferHook
+	if data.Transfer != nil && data.Transfer.hook != nil {
+		hook = *data.Transfer.hook
+	}
+	if hook.before != "" {
+		steps = append(steps, sshStep{cmd: data.WrapCmdWithSudo(hook.before)})
 	}
-	transferCmd = ss.data.WrapCmdWithHook(transferCmd)
-	return util.WrapCmdBefore(cmd, transferCmd)
+	if data.NeedTransferFile() {
+		trans := data.Transfer
+		steps = append(steps, sshStep{
+			cmd: "cd " + trans.Destination +
+				" && /usr/bin/scp -qrt ." + " && " +
+				fmt.Sprintf("echo '%s saved.'", trans.Dst),
+			transfer: trans,
+		})
+	}
+	if hook.after != "" {
+		after := fmt.Sprintf("cd %s && %s", data.Transfer.Destination, hook.after)
+		steps = append(steps, sshStep{cmd: data.WrapCmdWithSudo(after)})
+	}
+	if cmd != "" || len(steps) == 0 {
+		steps = append(steps, sshStep{cmd: data.WrapCmdWithSudo(cmd)})
+	}
+	// Only the last step reads stdin
+	steps[len(steps)-1].stdin = data.Stdin != nil
+	return
 }
 
 // pragma mark - Worker Interface
@@ -186,16 +475,16 @@ func (ss *sshExecutor) Name() string {
 func (ss *sshExecutor) Init(data *Parameter) error {
 	ss.data = data
 	hostinfoList := data.HostInfoList
-	authKeys := make([]ssh.Signer, 0, 2)
+	ss.signers = make([]ssh.Signer, 0, 2)
 	for _, t := range []string{"rsa", "dsa"} {
 		key, err := getKeyFile(t)
 		if err != nil {
 			continue
 		}
-		authKeys = append(authKeys, key)
+		ss.signers = append(ss.signers, key)
 	}
 	authMethod := []ssh.AuthMethod{
-		ssh.PublicKeys(authKeys...),
+		ssh.PublicKeys(ss.signers...),
 	}
 	if data.Passwd != "" {
 		authMethod = append(authMethod, ssh.Password(data.Passwd))
@@ -207,15 +496,30 @@ func (ss *sshExecutor) Init(data *Parameter) error {
 			return nil
 		},
 	}
+	identity := sshIdentity(ss.signers, data.Passwd, data.Account, hostKeyPolicyAny)
+	pool := data.SSHPool
+	if pool == nil {
+		pool = NewSSHPool()
+	}
 	ss.clients = make([]*sshClient, len(hostinfoList))
-	var transfer *TransferFile
-	if data.NeedTransferFile() {
-		transfer = data.Transfer
+	transfer := data.NeedTransferFile()
+	sudo := data.SudoUser != ""
+	pty := data.PTY || sudo
+	if pty && transfer {
+		return errors.New("Cannot transfer file through PTY (required by --pty/--sudo)")
 	}
 	retry := data.Retry
+	var broadcast *stdinBroadcast
+	if data.Stdin != nil {
+		if pty || transfer {
+			return errors.New("Cannot stream stdin along with PTY or file transfer")
+		}
+		broadcast = newStdinBroadcast(data.Stdin, len(hostinfoList))
+		// Stream could not be replayed
+		retry.Exec = false
+	}
 	for i, info := range hostinfoList {
 		hostname := info.Host
-		cmdFinal := ss.assembleSSHCmd(info.Cmd)
 		client := &sshClient{
 			hostname: hostname,
 			alias:    info.Alias,
@@ -227,42 +531,217 @@ func (ss *sshExecutor) Init(data *Parameter) error {
 					return nil
 				},
 			},
-			cmd:      cmdFinal,
-			retry:    retry,
-			transfer: transfer,
-			timeout:  data.Timeout,
+			steps:          ss.assembleSSHSteps(info.Cmd),
+			pool:           pool,
+			identity:       identity,
+			retry:          retry,
+			connectTimeout: data.ConnectTimeout,
+			timeout:        data.Timeout,
+			keepAlive:      data.KeepAlive,
+			pty:            pty,
+			sudo:           sudo,
+			passwd:         data.Passwd,
+			broadcast:      broadcast,
 		}
 		ss.clients[i] = client
 	}
 	return nil
 }
 
-func (ss *sshExecutor) Execute(done <-chan struct{}) (<-chan *formatter.Output, <-chan error) {
-	ch := make(chan *formatter.Output)
-	errc := make(chan error)
-	go func() {
-		var wg sync.WaitGroup
-		sem := make(chan bool, ss.data.Concurrency)
-		for _, c := range ss.clients {
-			wg.Add(1)
-			go func(client *sshClient) {
-				sem <- true
-				defer func() {
-					wg.Done()
-					<-sem
-				}()
-				select {
-				case ch <- client.output():
-				case <-done:
-				}
-			}(c)
+// Plan is part of WorkerWithPlan interface
+func (ss *sshExecutor) Plan(index int) formatter.Plan {
+	client := ss.clients[index]
+	var cmd string
+	for _, step := range client.steps {
+		cmd = util.WrapCmdAfter(cmd, step.cmd)
+	}
+	return formatter.Plan{
+		User:     client.config.User,
+		Host:     client.hostname,
+		Port:     client.port,
+		Cmd:      cmd,
+		Transfer: ss.data.transferPlan("scp"),
+	}
+}
+
+func (ss *sshExecutor) Execute(ctx context.Context) (<-chan *formatter.Output, <-chan error) {
+	return runConcurrently(ctx, ss.data, func(ctx context.Context, index int) *formatter.Output {
+		return ss.clients[index].output(ctx)
+	})
+}
+
+// sshTerminal is a PTY session, and the connection it holds
+type sshTerminal struct {
+	client  *sshClient
+	conn    *ssh.Client
+	session *ssh.Session
+	stdin   io.WriteCloser
+}
+
+func (st *sshTerminal) Write(p []byte) (int, error) {
+	return st.stdin.Write(p)
+}
+
+func (st *sshTerminal) Resize(width, height int) error {
+	return st.session.WindowChange(height, width)
+}
+
+func (st *sshTerminal) Wait() error {
+	return st.session.Wait()
+}
+
+func (st *sshTerminal) Close() error {
+	err := st.session.Close()
+	st.client.pool.release(st.client.poolKey(), st.conn)
+	return err
+}
+
+// OpenTerminal is part of WorkerWithTerminal interface
+func (ss *sshExecutor) OpenTerminal(ctx context.Context, index, width, height int, out io.Writer) (Terminal, error) {
+	if ss.data.NeedTransferFile() || ss.data.Stdin != nil {
+		return nil, errors.New("Cannot open terminal along with file transfer or stdin streaming")
+	}
+	sc := ss.clients[index]
+	// sshClient is not used by others, since no Execute is going on
+	if err := sc.connect(ctx); err != nil {
+		return nil, err
+	}
+	term := &sshTerminal{client: sc, conn: sc.client}
+	fail := func(err error) (Terminal, error) {
+		sc.pool.release(sc.poolKey(), term.conn)
+		return nil, err
+	}
+	var err error
+	if term.session, err = sc.client.NewSession(); err != nil {
+		sc.pool.discard(sc.poolKey(), term.conn)
+		return nil, err
+	}
+	if term.stdin, err = term.session.StdinPipe(); err != nil {
+		_ = term.session.Close()
+		return fail(err)
+	}
+	term.session.Stdout = out
+	term.session.Stderr = out
+	if sc.sudo {
+		term.session.Stdout = newPromptAnswerer(out, term.stdin, sudoPrompt, sc.passwd)
+	}
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err = term.session.RequestPty("xterm", height, width, modes); err != nil {
+		_ = term.session.Close()
+		return fail(err)
+	}
+	cmd := ss.data.HostInfoList[index].Cmd
+	if cmd == "" && sc.sudo {
+		// Shell of login user would leave sudo out
+		err = term.session.Start(ss.data.SudoLoginShell())
+	} else if cmd == "" {
+		err = term.session.Shell()
+	} else {
+		err = term.session.Start(ss.data.WrapCmdWithSudo(cmd))
+	}
+	if err != nil {
+		_ = term.session.Close()
+		return fail(err)
+	}
+	return term, nil
+}
+
+// Stream is part of WorkerWithStream interface
+func (ss *sshExecutor) Stream(ctx context.Context, index int, stdout, stderr io.Writer) error {
+	if ss.data.NeedTransferFile() || ss.data.Stdin != nil {
+		return errors.New("Cannot stream output along with file transfer or stdin streaming")
+	}
+	sc := ss.clients[index]
+	if err := sc.connect(ctx); err != nil {
+		return err
+	}
+	conn := sc.client
+	session, err := conn.NewSession()
+	if err != nil {
+		sc.pool.discard(sc.poolKey(), conn)
+		return err
+	}
+	sc.session = session
+	broken := false
+	defer func() {
+		_ = session.Close()
+		if broken {
+			sc.pool.discard(sc.poolKey(), conn)
+		} else {
+			sc.pool.release(sc.poolKey(), conn)
 		}
-		go func() {
-			wg.Wait()
-			close(errc)
-			close(ch)
-		}()
 	}()
-	return ch, errc
+	session.Stdout = stdout
+	session.Stderr = stderr
+	var stdin io.WriteCloser
+	if sc.pty {
+		if stdin, err = session.StdinPipe(); err != nil {
+			return err
+		}
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          0,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+		if err = session.RequestPty("xterm", 40, 80, modes); err != nil {
+			return err
+		}
+	}
+	if sc.sudo {
+		session.Stdout = newPromptAnswerer(stdout, stdin, sudoPrompt, sc.passwd)
+	}
+	if err = session.Start(ss.data.WrapCmdWithSudo(ss.data.HostInfoList[index].Cmd)); err != nil {
+		return err
+	}
+	waitc := make(chan error, 1)
+	go func() {
+		waitc <- session.Wait()
+	}()
+	select {
+	case err = <-waitc:
+		if exitErr, ok := err.(*ssh.ExitError); ok {
+			return &ExitError{ExitCode: exitErr.ExitStatus()}
+		}
+		// Connection seems broken, make it dialed again
+		broken = err != nil
+		return err
+	case <-ctx.Done():
+		sc.kill(stdin, waitc)
+		return ctx.Err()
+	}
+}
+
+// pooledConn gives client back to pool once it's closed
+type pooledConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (pc *pooledConn) Close() error {
+	err := pc.Conn.Close()
+	pc.once.Do(pc.release)
+	return err
+}
 
+// Dial is part of WorkerWithDial interface.
+// Connection to host is shared through pool, and dialed again once it's broken.
+func (ss *sshExecutor) Dial(ctx context.Context, index int, network, addr string) (net.Conn, error) {
+	sc := ss.clients[index]
+	client, err := sc.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.Dial(network, addr)
+	if err != nil {
+		sc.pool.release(sc.poolKey(), client)
+		return nil, err
+	}
+	return &pooledConn{Conn: conn, release: func() {
+		sc.pool.release(sc.poolKey(), client)
+	}}, nil
 }
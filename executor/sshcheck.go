@@ -0,0 +1,312 @@
+package executor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lidongpeng36/gsck/config"
+	"github.com/lidongpeng36/gsck/formatter"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// errAuthProbe aborts probing handshake once an auth method turns out to be offered
+var errAuthProbe = errors.New("Auth Probe.")
+
+// maxPreVersionLines is how many lines server may send before its identification string
+const maxPreVersionLines = 20
+
+// replayConn replays bytes consumed while reading server identification
+type replayConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (rc *replayConn) Read(p []byte) (int, error) {
+	return rc.r.Read(p)
+}
+
+// readServerVersion reads identification string of server, e.g. SSH-2.0-OpenSSH_7.4.
+// The returned conn gives out everything read, so that it could be used for handshake.
+func readServerVersion(conn net.Conn) (net.Conn, string, error) {
+	br := bufio.NewReader(conn)
+	var consumed bytes.Buffer
+	for i := 0; i < maxPreVersionLines; i++ {
+		line, err := br.ReadString('\n')
+		consumed.WriteString(line)
+		if err != nil {
+			return nil, "", fmt.Errorf("Reading SSH Version: %v", err)
+		}
+		if strings.HasPrefix(line, "SSH-") {
+			rc := &replayConn{Conn: conn, r: io.MultiReader(&consumed, br)}
+			return rc, strings.TrimRight(line, "\r\n"), nil
+		}
+	}
+	return nil, "", errors.New("Not an SSH Server.")
+}
+
+// closeOnDone closes @conn once ctx is done, until returned function is called
+func closeOnDone(ctx context.Context, conn io.Closer) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// KnownHostsFile is config `ssh.known_hosts`, or ~/.ssh/known_hosts
+func KnownHostsFile() string {
+	file := config.GetString("ssh.known_hosts")
+	if file == "" {
+		file = filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts")
+	}
+	return file
+}
+
+// hostKeyStatus compares @key with known_hosts
+func (ss *sshExecutor) hostKeyStatus(hostname string, remote net.Addr, key ssh.PublicKey) string {
+	ss.knownHostsOnce.Do(func() {
+		ss.knownHosts, _ = knownhosts.New(KnownHostsFile())
+	})
+	if ss.knownHosts == nil {
+		return formatter.HostKeyUnchecked
+	}
+	err := ss.knownHosts(hostname, remote, key)
+	switch e := err.(type) {
+	case nil:
+		return formatter.HostKeyKnown
+	case *knownhosts.RevokedError:
+		return formatter.HostKeyRevoked
+	case *knownhosts.KeyError:
+		if len(e.Want) == 0 {
+			return formatter.HostKeyUnknown
+		}
+		return formatter.HostKeyMismatch
+	}
+	return formatter.HostKeyUnchecked
+}
+
+// probeAuth finds out auth methods that server offers to user, without sending any credential.
+// Each probe handshake stops at the first offered method that needs a credential,
+// so it takes a handshake for each of them.
+func (ss *sshExecutor) probeAuth(ctx context.Context, sc *sshClient, addr string) (offered []string) {
+	candidates := []string{"password", "keyboard-interactive"}
+	mark := func(method string) {
+		offered = append(offered, method)
+	}
+	probed := false
+	for {
+		var hit string
+		methods := []ssh.AuthMethod{
+			ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+				if !probed {
+					mark("publickey")
+				}
+				return nil, nil
+			}),
+		}
+		for _, method := range candidates {
+			switch method {
+			case "password":
+				methods = append(methods, ssh.PasswordCallback(func() (string, error) {
+					hit = "password"
+					return "", errAuthProbe
+				}))
+			case "keyboard-interactive":
+				methods = append(methods, ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+					hit = "keyboard-interactive"
+					return nil, errAuthProbe
+				}))
+			}
+		}
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return
+		}
+		stop := closeOnDone(ctx, conn)
+		c, _, _, err := ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+			User:            sc.config.User,
+			Auth:            methods,
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		})
+		stop()
+		if err == nil {
+			// Server lets anyone in
+			_ = c.Close()
+			mark("none")
+			return
+		}
+		_ = conn.Close()
+		probed = true
+		if hit == "" {
+			return
+		}
+		mark(hit)
+		remains := candidates[:0]
+		for _, method := range candidates {
+			if method != hit {
+				remains = append(remains, method)
+			}
+		}
+		candidates = remains
+	}
+}
+
+// Check is part of WorkerWithCheck interface.
+// Phases: DNS, TCP connect, server identification, host key, authentication and a no-op command.
+// Nothing is sent to a server whose host key mismatches known_hosts.
+func (ss *sshExecutor) Check(ctx context.Context, index int) *formatter.CheckResult {
+	sc := ss.clients[index]
+	result := &formatter.CheckResult{
+		Alias: sc.alias,
+		Host:  sc.hostname,
+		Port:  sc.port,
+		User:  sc.config.User,
+		Class: formatter.CheckOK,
+	}
+	connectCtx, cancel := ctx, context.CancelFunc(func() {})
+	if sc.connectTimeout > 0 {
+		connectCtx, cancel = context.WithTimeout(ctx, time.Duration(sc.connectTimeout)*time.Second)
+	}
+	defer cancel()
+	fail := func(class string, err error) *formatter.CheckResult {
+		result.Class = class
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		} else if class != formatter.CheckExec && connectCtx.Err() != nil {
+			err = errConnectTimeout
+		}
+		result.Error = err.Error()
+		return result
+	}
+
+	// DNS
+	start := time.Now()
+	if net.ParseIP(sc.hostname) == nil {
+		addrs, err := net.DefaultResolver.LookupHost(connectCtx, sc.hostname)
+		result.DNS = time.Since(start)
+		if err != nil {
+			return fail(formatter.CheckDNS, err)
+		}
+		result.Addresses = addrs
+	} else {
+		result.Addresses = []string{sc.hostname}
+	}
+
+	// TCP connect
+	addr := net.JoinHostPort(sc.hostname, sc.port)
+	start = time.Now()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(connectCtx, "tcp", net.JoinHostPort(result.Addresses[0], sc.port))
+	result.Connect = time.Since(start)
+	if err != nil {
+		return fail(formatter.CheckNetwork, err)
+	}
+	defer func() { _ = conn.Close() }()
+	stop := closeOnDone(connectCtx, conn)
+
+	// Server identification, host key and authentication
+	start = time.Now()
+	sshConn, version, err := readServerVersion(conn)
+	if err != nil {
+		stop()
+		return fail(formatter.CheckSSH, err)
+	}
+	result.ServerVersion = version
+	var methods []ssh.AuthMethod
+	if len(ss.signers) > 0 {
+		methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			result.AuthTried = append(result.AuthTried, "publickey")
+			return ss.signers, nil
+		}))
+	}
+	if sc.passwd != "" {
+		methods = append(methods, ssh.PasswordCallback(func() (string, error) {
+			result.AuthTried = append(result.AuthTried, "password")
+			return sc.passwd, nil
+		}))
+	}
+	c, chans, reqs, err := ssh.NewClientConn(sshConn, addr, &ssh.ClientConfig{
+		User: sc.config.User,
+		Auth: methods,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			result.HostKey = formatter.HostKeyCheck{
+				Status:      ss.hostKeyStatus(hostname, remote, key),
+				Type:        key.Type(),
+				Fingerprint: ssh.FingerprintSHA256(key),
+			}
+			switch result.HostKey.Status {
+			case formatter.HostKeyMismatch, formatter.HostKeyRevoked:
+				return fmt.Errorf("Host Key %s: %s", result.HostKey.Status, result.HostKey.Fingerprint)
+			}
+			return nil
+		},
+		BannerCallback: func(message string) error {
+			result.Banner = strings.TrimSpace(message)
+			return nil
+		},
+	})
+	result.Handshake = time.Since(start)
+	stop()
+	if err != nil {
+		switch result.HostKey.Status {
+		case "":
+			// Key exchange did not finish
+			return fail(formatter.CheckSSH, err)
+		case formatter.HostKeyMismatch, formatter.HostKeyRevoked:
+			return fail(formatter.CheckHostKey, err)
+		}
+		result.AuthOffered = ss.probeAuth(connectCtx, sc, addr)
+		return fail(formatter.CheckAuth, err)
+	}
+	client := ssh.NewClient(c, chans, reqs)
+	defer func() { _ = client.Close() }()
+	if n := len(result.AuthTried); n > 0 {
+		result.AuthAccepted = result.AuthTried[n-1]
+	} else {
+		result.AuthAccepted = "none"
+	}
+	result.AuthOffered = ss.probeAuth(connectCtx, sc, addr)
+
+	// No-op command
+	execCtx, cancelExec := ctx, context.CancelFunc(func() {})
+	if sc.timeout > 0 {
+		execCtx, cancelExec = context.WithTimeout(ctx, time.Duration(sc.timeout)*time.Second)
+	}
+	defer cancelExec()
+	stop = closeOnDone(execCtx, client)
+	defer stop()
+	start = time.Now()
+	session, err := client.NewSession()
+	if err == nil {
+		var stderr bytes.Buffer
+		session.Stderr = &stderr
+		err = session.Run("true")
+		if _, ok := err.(*ssh.ExitError); ok && stderr.Len() > 0 {
+			err = errors.New(strings.TrimSpace(stderr.String()))
+		}
+		_ = session.Close()
+	}
+	result.Exec = time.Since(start)
+	if err != nil {
+		if execCtx.Err() != nil && ctx.Err() == nil {
+			err = errExecTimeout
+		}
+		return fail(formatter.CheckExec, err)
+	}
+	return result
+}
@@ -0,0 +1,86 @@
+package executor
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lidongpeng36/gsck/formatter"
+	"github.com/lidongpeng36/gsck/hostlist"
+)
+
+func TestReadServerVersion(t *testing.T) {
+	server, client := net.Pipe()
+	sent := "motd line\r\nSSH-2.0-OpenSSH_7.4\r\nKEXINIT..."
+	go func() {
+		_, _ = server.Write([]byte(sent))
+		_ = server.Close()
+	}()
+	conn, version, err := readServerVersion(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "SSH-2.0-OpenSSH_7.4" {
+		t.Fatalf("Unexpected version: %q", version)
+	}
+	// Everything is replayed for handshake
+	replayed, _ := ioutil.ReadAll(conn)
+	if string(replayed) != sent {
+		t.Fatalf("Unexpected replay: %q", replayed)
+	}
+}
+
+func TestReadServerVersionNotSSH(t *testing.T) {
+	server, client := net.Pipe()
+	go func() {
+		_, _ = server.Write([]byte("HTTP/1.1 400 Bad Request\r\n"))
+		_ = server.Close()
+	}()
+	if _, _, err := readServerVersion(client); err == nil {
+		t.Fatal("Should fail for non-SSH server")
+	}
+}
+
+func TestCheckCancel(t *testing.T) {
+	// Server that never says hello
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	exec, err := NewExecutor(Parameter{Method: "ssh", User: "root", Concurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	exec.SetHostInfoList(hostlist.MakeHostInfoListFromStringList([]string{addr, addr, addr}))
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		if !exec.Cancel() {
+			t.Error("Check is not cancelled")
+		}
+	}()
+	start := time.Now()
+	failed, err := exec.Check(context.Background(), formatter.NewCheckFormatter(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("Check took %s after cancel", elapsed)
+	}
+	// The one being checked, and those left
+	if failed != 3 {
+		t.Fatalf("%d hosts failed", failed)
+	}
+}
@@ -0,0 +1,148 @@
+package executor
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHPool shares connections to the same user@host:port, with the same credentials and host key policy, among sessions.
+// Steps of a host (hooks, transfer and command), hosts with the same address,
+// and consecutive runs given the same pool then need only one handshake.
+// Connections stay open after release, until closed by server or CloseIdle.
+type SSHPool struct {
+	mu    sync.Mutex
+	conns map[string]*sshConn
+}
+
+type sshConn struct {
+	// ready is closed once dialing is done, with client or err set
+	ready  chan struct{}
+	client *ssh.Client
+	err    error
+	// closed is closed once client is closed
+	closed chan struct{}
+	refs   int
+}
+
+// NewSSHPool returns an empty SSHPool, which could be shared by Executors through Parameter.SSHPool
+func NewSSHPool() *SSHPool {
+	return &SSHPool{conns: make(map[string]*sshConn)}
+}
+
+// sshPoolKey tells connections apart by @identity (credentials and host key policy) as well as address,
+// so a connection authenticated by one identity is never given to another
+func sshPoolKey(identity, user, host, port string) string {
+	return identity + "/" + user + "@" + net.JoinHostPort(host, port)
+}
+
+func (conn *sshConn) alive() bool {
+	select {
+	case <-conn.closed:
+		return false
+	default:
+		return true
+	}
+}
+
+// get returns client for @key, and dials with @dial if there is no alive one.
+// If another host is dialing the same key, get waits for it instead.
+// Client must be given back with release.
+func (p *SSHPool) get(ctx context.Context, key string, dial func(context.Context) (*ssh.Client, error)) (*ssh.Client, error) {
+	for {
+		p.mu.Lock()
+		conn, ok := p.conns[key]
+		if ok && conn.err == nil && conn.alive() {
+			conn.refs++
+			p.mu.Unlock()
+			select {
+			case <-conn.ready:
+			case <-ctx.Done():
+				p.unref(conn)
+				return nil, ctx.Err()
+			}
+			if conn.err == nil {
+				return conn.client, nil
+			}
+			p.unref(conn)
+			if conn.err != context.Canceled && conn.err != context.DeadlineExceeded {
+				return nil, conn.err
+			}
+			// Dialer gave up for its own ctx, try again
+			continue
+		}
+		conn = &sshConn{
+			ready:  make(chan struct{}),
+			closed: make(chan struct{}),
+			refs:   1,
+		}
+		p.conns[key] = conn
+		p.mu.Unlock()
+
+		client, err := dial(ctx)
+		// Others check err of conn in pool with mu held
+		p.mu.Lock()
+		conn.client, conn.err = client, err
+		p.mu.Unlock()
+		if conn.err != nil {
+			p.remove(key, conn)
+		} else {
+			go func() {
+				_ = conn.client.Wait()
+				close(conn.closed)
+				p.remove(key, conn)
+			}()
+		}
+		close(conn.ready)
+		return conn.client, conn.err
+	}
+}
+
+// release gives back @client got from get
+func (p *SSHPool) release(key string, client *ssh.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if conn, ok := p.conns[key]; ok && conn.client == client {
+		conn.refs--
+	}
+}
+
+// unref gives back @conn, whose client may not be ready
+func (p *SSHPool) unref(conn *sshConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conn.refs--
+}
+
+// discard closes @client, which seems broken, so that it's dialed again next time
+func (p *SSHPool) discard(key string, client *ssh.Client) {
+	p.release(key, client)
+	_ = client.Close()
+}
+
+func (p *SSHPool) remove(key string, conn *sshConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conns[key] == conn {
+		delete(p.conns, key)
+	}
+}
+
+// CloseIdle closes connections that are not used by anyone
+func (p *SSHPool) CloseIdle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, conn := range p.conns {
+		select {
+		case <-conn.ready:
+		default:
+			continue
+		}
+		if conn.refs <= 0 && conn.client != nil {
+			_ = conn.client.Close()
+			delete(p.conns, key)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package executor
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSHPoolKeyIdentity(t *testing.T) {
+	base := sshIdentity(nil, "secret", "", hostKeyPolicyAny)
+	if base != sshIdentity(nil, "secret", "", hostKeyPolicyAny) {
+		t.Fatal("Same credentials have different identities")
+	}
+	for _, other := range []string{
+		sshIdentity(nil, "other", "", hostKeyPolicyAny),
+		sshIdentity(nil, "secret", "admin", hostKeyPolicyAny),
+		sshIdentity(nil, "secret", "", "strict"),
+		// Fields never run into each other
+		sshIdentity(nil, "secre", "t", hostKeyPolicyAny),
+	} {
+		if other == base {
+			t.Fatal("Different credentials share an identity")
+		}
+	}
+	if sshPoolKey(base, "root", "web01", "22") == sshPoolKey(sshIdentity(nil, "other", "", hostKeyPolicyAny), "root", "web01", "22") {
+		t.Fatal("Connections of different credentials share a key")
+	}
+}
+
+func TestSSHPoolOwned(t *testing.T) {
+	exec, err := NewExecutor(Parameter{Method: "local"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exec.Parameter.SSHPool == nil || !exec.ownPool {
+		t.Fatal("Executor has no pool of its own")
+	}
+	pool := NewSSHPool()
+	exec, err = NewExecutor(Parameter{Method: "local", SSHPool: pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exec.Parameter.SSHPool != pool || exec.ownPool {
+		t.Fatal("Given pool is not shared")
+	}
+}
+
+func TestSSHConnectTimeout(t *testing.T) {
+	// Server that never says hello
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	sc := &sshClient{
+		hostname:       host,
+		port:           port,
+		config:         &ssh.ClientConfig{User: "root", HostKeyCallback: ssh.InsecureIgnoreHostKey()},
+		pool:           NewSSHPool(),
+		connectTimeout: 1,
+	}
+	if _, err = sc.getClient(context.Background()); err != errConnectTimeout {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
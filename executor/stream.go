@@ -0,0 +1,39 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// WorkerWithStream could pass output of command along while it is running,
+// for commands that run long or never end, e.g. `tail -f`.
+type WorkerWithStream interface {
+	// Stream runs command of host @index once, and copies its output into @stdout and @stderr as it comes.
+	// It returns when command exits, and kills command once ctx is done. Retry is up to caller.
+	Stream(ctx context.Context, index int, stdout, stderr io.Writer) error
+	Worker
+}
+
+// ExitError is returned by Stream if command ran, but exited with non-zero code
+type ExitError struct {
+	ExitCode int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("Exited with %d", e.ExitCode)
+}
+
+// Stream runs command of host @index, and streams its output, see WorkerWithStream.
+// Worker is initialized at the first call.
+func (exec *Executor) Stream(ctx context.Context, index int, stdout, stderr io.Writer) error {
+	w, ok := exec.worker.(WorkerWithStream)
+	if !ok {
+		return errors.New("Method " + exec.worker.Name() + " does not support streaming")
+	}
+	if err := exec.prepare(); err != nil {
+		return err
+	}
+	return w.Stream(ctx, index, stdout, stderr)
+}
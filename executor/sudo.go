@@ -0,0 +1,103 @@
+package executor
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/lidongpeng36/gsck/util"
+)
+
+// sudoPrompt is passed to `sudo -p`, so that it could be told apart from command output
+const sudoPrompt = "[gsck-sudo-password]:"
+
+// WrapCmdWithSudo returns @cmd which runs as SudoUser, or @cmd itself if sudo is not needed
+func (data *Parameter) WrapCmdWithSudo(cmd string) string {
+	if data.SudoUser == "" || cmd == "" {
+		return cmd
+	}
+	return "sudo -p " + util.ShellQuote(sudoPrompt) + " -u " + util.ShellQuote(data.SudoUser) +
+		" -- /bin/sh -c " + util.ShellQuote(cmd)
+}
+
+// SudoLoginShell returns command which starts a login shell of SudoUser, or empty if sudo is not needed
+func (data *Parameter) SudoLoginShell() string {
+	if data.SudoUser == "" {
+		return ""
+	}
+	return "sudo -p " + util.ShellQuote(sudoPrompt) + " -i -u " + util.ShellQuote(data.SudoUser)
+}
+
+// promptAnswerer watches output for prompt, answers it through stdin, and strips the prompt from output.
+// Prompt is answered only once. If it shows again (e.g. wrong password), stdin is closed to make sudo fail.
+// Answer is empty means nothing to answer with, so stdin is closed on the first prompt.
+type promptAnswerer struct {
+	out      io.Writer
+	stdin    io.WriteCloser
+	prompt   []byte
+	answer   []byte
+	pending  []byte
+	answered bool
+	mu       sync.Mutex
+}
+
+func newPromptAnswerer(out io.Writer, stdin io.WriteCloser, prompt, answer string) *promptAnswerer {
+	return &promptAnswerer{
+		out:    out,
+		stdin:  stdin,
+		prompt: []byte(prompt),
+		answer: []byte(answer),
+	}
+}
+
+func (pa *promptAnswerer) respond() {
+	if pa.answered || len(pa.answer) == 0 {
+		_ = pa.stdin.Close()
+		return
+	}
+	pa.answered = true
+	_, _ = pa.stdin.Write(append(pa.answer, '\n'))
+}
+
+// Write is part of io.Writer interface
+func (pa *promptAnswerer) Write(p []byte) (n int, err error) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	buf := append(pa.pending, p...)
+	pa.pending = nil
+	for {
+		index := bytes.Index(buf, pa.prompt)
+		if index < 0 {
+			break
+		}
+		if _, err = pa.out.Write(buf[:index]); err != nil {
+			return
+		}
+		pa.respond()
+		buf = buf[index+len(pa.prompt):]
+	}
+	// Hold the tail which may be the beginning of prompt
+	keep := len(pa.prompt) - 1
+	if keep > len(buf) {
+		keep = len(buf)
+	}
+	for ; keep > 0; keep-- {
+		if bytes.HasPrefix(pa.prompt, buf[len(buf)-keep:]) {
+			break
+		}
+	}
+	if _, err = pa.out.Write(buf[:len(buf)-keep]); err != nil {
+		return
+	}
+	pa.pending = append([]byte(nil), buf[len(buf)-keep:]...)
+	return len(p), nil
+}
+
+// Flush writes out what is held as possible prompt
+func (pa *promptAnswerer) Flush() error {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	_, err := pa.out.Write(pa.pending)
+	pa.pending = nil
+	return err
+}
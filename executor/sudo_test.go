@@ -0,0 +1,47 @@
+package executor
+
+import (
+	"bytes"
+	"testing"
+)
+
+type nopWriteCloser struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (nwc *nopWriteCloser) Close() error {
+	nwc.closed = true
+	return nil
+}
+
+func TestPromptAnswerer(t *testing.T) {
+	var out bytes.Buffer
+	stdin := new(nopWriteCloser)
+	pa := newPromptAnswerer(&out, stdin, sudoPrompt, "secret")
+	// prompt is split across writes
+	for _, chunk := range []string{"before [gsck-su", "do-password]:", "\r\nafter [gsck"} {
+		_, _ = pa.Write([]byte(chunk))
+	}
+	_ = pa.Flush()
+	if out.String() != "before \r\nafter [gsck" {
+		t.Fatalf("Unexpected output: %q", out.String())
+	}
+	if stdin.String() != "secret\n" || stdin.closed {
+		t.Fatalf("Prompt should be answered once. Stdin: %q, Closed: %v", stdin.String(), stdin.closed)
+	}
+	// Asked again, give up
+	_, _ = pa.Write([]byte(sudoPrompt))
+	if stdin.String() != "secret\n" || !stdin.closed {
+		t.Fatalf("Stdin should be closed on second prompt")
+	}
+}
+
+func TestSudoLoginShell(t *testing.T) {
+	if shell := (&Parameter{}).SudoLoginShell(); shell != "" {
+		t.Fatalf("Login shell without sudo: %q", shell)
+	}
+	if shell := (&Parameter{SudoUser: "app"}).SudoLoginShell(); shell != "sudo -p '"+sudoPrompt+"' -i -u 'app'" {
+		t.Fatalf("Unexpected login shell: %q", shell)
+	}
+}
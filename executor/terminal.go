@@ -0,0 +1,55 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Terminal is an interactive PTY session on a host
+type Terminal interface {
+	// Write sends keystrokes
+	io.Writer
+	Resize(width, height int) error
+	// Wait blocks until session ends
+	Wait() error
+	Close() error
+}
+
+// WorkerWithTerminal could open interactive terminals on hosts
+type WorkerWithTerminal interface {
+	// OpenTerminal opens a PTY session on host @index, which runs command of the host,
+	// or login shell if there is no command. Output of session is copied into @out.
+	OpenTerminal(ctx context.Context, index, width, height int, out io.Writer) (Terminal, error)
+	Worker
+}
+
+// OpenTerminal opens an interactive terminal on host @index, see WorkerWithTerminal.
+// Worker is initialized at the first call.
+func (exec *Executor) OpenTerminal(ctx context.Context, index, width, height int, out io.Writer) (Terminal, error) {
+	w, ok := exec.worker.(WorkerWithTerminal)
+	if !ok {
+		return nil, errors.New("Method " + exec.worker.Name() + " does not support interactive terminals")
+	}
+	if err := exec.prepare(); err != nil {
+		return nil, err
+	}
+	return w.OpenTerminal(ctx, index, width, height, out)
+}
+
+// prepare initializes worker once, for methods that work on a single host, e.g. OpenTerminal
+func (exec *Executor) prepare() error {
+	exec.mu.Lock()
+	defer exec.mu.Unlock()
+	if exec.ready {
+		return nil
+	}
+	if err := exec.integration(); err != nil {
+		return err
+	}
+	if err := exec.worker.Init(exec.Parameter); err != nil {
+		return err
+	}
+	exec.ready = true
+	return nil
+}
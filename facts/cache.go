@@ -0,0 +1,97 @@
+package facts
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lidongpeng36/gsck/config"
+)
+
+// DefaultTTL is how long cached facts are fresh, unless `facts.ttl` (Unit: s) is set in config
+const DefaultTTL = time.Hour
+
+// TTL returns how long cached facts are fresh
+func TTL() time.Duration {
+	if ttl := config.GetInt("facts.ttl"); ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return DefaultTTL
+}
+
+// CacheFile returns path of cache, `facts.cache` in config or ~/.gsck_facts.json
+func CacheFile() string {
+	if file := config.GetString("facts.cache"); file != "" {
+		return file
+	}
+	return filepath.Join(os.Getenv("HOME"), ".gsck_facts.json")
+}
+
+// Cache holds facts of hosts, in order they're first gathered
+type Cache struct {
+	file  string
+	list  []*Facts
+	index map[string]int
+}
+
+// LoadCache reads cache from @file. Missing file gives an empty cache.
+func LoadCache(file string) (*Cache, error) {
+	cache := &Cache{file: file, index: make(map[string]int)}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return cache, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var list []*Facts
+	if err = json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	for _, f := range list {
+		cache.Put(f)
+	}
+	return cache, nil
+}
+
+// Get returns facts of @alias, if they're gathered within @ttl
+func (c *Cache) Get(alias string, ttl time.Duration) (*Facts, bool) {
+	i, ok := c.index[alias]
+	if !ok || time.Since(c.list[i].Time) > ttl {
+		return nil, false
+	}
+	return c.list[i], true
+}
+
+// Put adds (or replaces) facts of a host. Facts with Error are ignored.
+func (c *Cache) Put(f *Facts) {
+	if f.Error != "" {
+		return
+	}
+	if i, ok := c.index[f.Alias]; ok {
+		c.list[i] = f
+		return
+	}
+	c.index[f.Alias] = len(c.list)
+	c.list = append(c.list, f)
+}
+
+// Fresh returns facts gathered within @ttl
+func (c *Cache) Fresh(ttl time.Duration) (list []*Facts) {
+	for _, f := range c.list {
+		if time.Since(f.Time) <= ttl {
+			list = append(list, f)
+		}
+	}
+	return
+}
+
+// Save writes cache back into its file
+func (c *Cache) Save() error {
+	data, err := json.MarshalIndent(c.list, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.file, data, 0600)
+}
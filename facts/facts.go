@@ -0,0 +1,245 @@
+// Package facts gathers facts of hosts (OS, kernel, CPU, memory, disks, IPs, uptime and
+// custom facts from config), and caches them locally.
+//
+// Custom facts are commands in section `custom_facts` of config, e.g.
+//   gsck config custom_facts.nginx 'nginx -v 2>&1'
+// Cached facts are also a hostlist, e.g. `-f 'facts:kernel~^5.4,cpus>=8'`, see Query.
+package facts
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lidongpeng36/gsck/executor"
+	"github.com/lidongpeng36/gsck/formatter"
+	"github.com/lidongpeng36/gsck/hostlist"
+)
+
+// Disk is a mounted filesystem
+type Disk struct {
+	Device string `json:"device"`
+	Mount  string `json:"mount"`
+	SizeMB int64  `json:"size_mb"`
+	UsedMB int64  `json:"used_mb"`
+}
+
+// Facts of a host
+type Facts struct {
+	Alias    string            `json:"alias"`
+	Host     string            `json:"host"`
+	Port     string            `json:"port"`
+	Time     time.Time         `json:"time"`
+	OS       string            `json:"os"`
+	Kernel   string            `json:"kernel"`
+	Arch     string            `json:"arch"`
+	Hostname string            `json:"hostname"`
+	CPUs     int               `json:"cpus"`
+	MemoryMB int64             `json:"memory_mb"`
+	Disks    []Disk            `json:"disks"`
+	IPs      []string          `json:"ips"`
+	Uptime   int64             `json:"uptime"` // Unit: s
+	Custom   map[string]string `json:"custom,omitempty"`
+	// Error is why facts could not be gathered. Such facts are not cached.
+	Error string `json:"error,omitempty"`
+}
+
+// Keys are names of standard facts, for Get
+var Keys = []string{"os", "kernel", "arch", "hostname", "cpus", "memory_mb", "disks", "ips", "uptime"}
+
+// Get returns values of fact @key, or custom fact of that name.
+// Disks are given by mount points. It returns nil if there is no such fact.
+func (f *Facts) Get(key string) []string {
+	switch key {
+	case "alias":
+		return []string{f.Alias}
+	case "os":
+		return []string{f.OS}
+	case "kernel":
+		return []string{f.Kernel}
+	case "arch":
+		return []string{f.Arch}
+	case "hostname":
+		return []string{f.Hostname}
+	case "cpus":
+		return []string{strconv.Itoa(f.CPUs)}
+	case "memory_mb":
+		return []string{strconv.FormatInt(f.MemoryMB, 10)}
+	case "uptime":
+		return []string{strconv.FormatInt(f.Uptime, 10)}
+	case "ips":
+		return f.IPs
+	case "disks":
+		mounts := make([]string, len(f.Disks))
+		for i, disk := range f.Disks {
+			mounts[i] = disk.Mount
+		}
+		return mounts
+	}
+	if value, ok := f.Custom[key]; ok {
+		return []string{value}
+	}
+	return nil
+}
+
+// factMarker starts output of each fact
+const factMarker = "@@gsck-fact "
+
+var standardCmds = []struct{ key, cmd string }{
+	{"os", "(. /etc/os-release && echo \"$PRETTY_NAME\") 2>/dev/null || uname -s"},
+	{"kernel", "uname -r"},
+	{"arch", "uname -m"},
+	{"hostname", "hostname"},
+	{"cpus", "nproc 2>/dev/null || getconf _NPROCESSORS_ONLN"},
+	{"memory", "grep MemTotal /proc/meminfo"},
+	{"disks", "df -P -k -x tmpfs -x devtmpfs -x overlay -x squashfs 2>/dev/null || df -P -k"},
+	{"ips", "hostname -I 2>/dev/null || ip -o addr show scope global | awk '{print $4}' | cut -d/ -f1"},
+	{"uptime", "cat /proc/uptime"},
+}
+
+// Script returns command that prints all facts, with @custom facts (name: command)
+func Script(custom map[string]string) string {
+	var lines []string
+	add := func(key, cmd string) {
+		lines = append(lines, "echo '"+factMarker+key+"'", "("+cmd+") 2>/dev/null")
+	}
+	for _, fact := range standardCmds {
+		add(fact.key, fact.cmd)
+	}
+	names := make([]string, 0, len(custom))
+	for name, cmd := range custom {
+		if cmd != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add("custom."+name, custom[name])
+	}
+	// A missing fact does not fail the host
+	lines = append(lines, "true")
+	return strings.Join(lines, "\n")
+}
+
+// Parse reads output of Script
+func Parse(stdout string) *Facts {
+	sections := make(map[string][]string)
+	var key string
+	for _, line := range strings.Split(stdout, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, factMarker) {
+			key = strings.TrimPrefix(line, factMarker)
+			sections[key] = []string{}
+		} else if key != "" {
+			sections[key] = append(sections[key], line)
+		}
+	}
+	text := func(key string) string {
+		return strings.TrimSpace(strings.Join(sections[key], "\n"))
+	}
+	f := &Facts{
+		OS:       strings.Split(text("os"), "\n")[0],
+		Kernel:   text("kernel"),
+		Arch:     text("arch"),
+		Hostname: text("hostname"),
+	}
+	f.CPUs, _ = strconv.Atoi(text("cpus"))
+	// MemTotal:       16315460 kB
+	if fields := strings.Fields(text("memory")); len(fields) >= 2 {
+		kb, _ := strconv.ParseInt(fields[1], 10, 64)
+		f.MemoryMB = kb / 1024
+	}
+	if fields := strings.Fields(text("uptime")); len(fields) > 0 {
+		seconds, _ := strconv.ParseFloat(fields[0], 64)
+		f.Uptime = int64(seconds)
+	}
+	for _, ip := range strings.Fields(text("ips")) {
+		if !strings.HasPrefix(ip, "127.") && ip != "::1" {
+			f.IPs = append(f.IPs, ip)
+		}
+	}
+	// Filesystem 1024-blocks Used Available Capacity Mounted on
+	for _, line := range sections["disks"] {
+		fields := strings.Fields(line)
+		if len(fields) < 6 || fields[0] == "Filesystem" {
+			continue
+		}
+		size, _ := strconv.ParseInt(fields[1], 10, 64)
+		used, _ := strconv.ParseInt(fields[2], 10, 64)
+		f.Disks = append(f.Disks, Disk{
+			Device: fields[0],
+			Mount:  strings.Join(fields[5:], " "),
+			SizeMB: size / 1024,
+			UsedMB: used / 1024,
+		})
+	}
+	for key := range sections {
+		if strings.HasPrefix(key, "custom.") {
+			if f.Custom == nil {
+				f.Custom = make(map[string]string)
+			}
+			f.Custom[strings.TrimPrefix(key, "custom.")] = text(key)
+		}
+	}
+	return f
+}
+
+// collector keeps outputs by alias
+type collector struct {
+	mu      sync.Mutex
+	outputs map[string]formatter.Output
+}
+
+func (c *collector) Add(output formatter.Output) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.outputs[output.Alias] = output
+}
+
+func (c *collector) Print() {}
+
+// Gather gathers facts of @hosts, with @custom facts (name: command), in order of hosts.
+// Hosts that fail have Error set.
+func Gather(ctx context.Context, parameter executor.Parameter, hosts hostlist.HostInfoList, custom map[string]string) ([]*Facts, error) {
+	parameter.Cmd = Script(custom)
+	parameter.Template = false
+	exec, err := executor.NewExecutor(parameter)
+	if err != nil {
+		return nil, err
+	}
+	list := make(hostlist.HostInfoList, len(hosts))
+	for i, info := range hosts {
+		host := *info
+		host.Cmd = ""
+		list[i] = &host
+	}
+	exec.SetHostInfoList(list)
+	c := &collector{outputs: make(map[string]formatter.Output)}
+	exec.AddFormatter("facts", c)
+	if _, err = exec.RunContext(ctx); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	result := make([]*Facts, len(list))
+	for i, info := range list {
+		output, ok := c.outputs[info.Alias]
+		f := &Facts{}
+		if !ok {
+			f.Error = "No Output"
+		} else if output.Error != "" || output.ExitCode != 0 {
+			f.Error = strings.TrimSpace(output.Error + "\n" + output.Stderr)
+			if f.Error == "" {
+				f.Error = fmt.Sprintf("Exit Code %d", output.ExitCode)
+			}
+		} else {
+			f = Parse(output.Stdout)
+		}
+		f.Alias, f.Host, f.Port, f.Time = info.Alias, info.Host, info.Port, now
+		result[i] = f
+	}
+	return result, nil
+}
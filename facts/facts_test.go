@@ -0,0 +1,74 @@
+package facts
+
+import (
+	"testing"
+)
+
+const sample = `@@gsck-fact os
+Ubuntu 20.04.6 LTS
+@@gsck-fact kernel
+5.4.0-150-generic
+@@gsck-fact arch
+x86_64
+@@gsck-fact hostname
+web01
+@@gsck-fact cpus
+8
+@@gsck-fact memory
+MemTotal:       16315460 kB
+@@gsck-fact disks
+Filesystem     1024-blocks     Used Available Capacity Mounted on
+/dev/sda1        101445540 20971520  75238996      22% /
+/dev/sdb1       1048576000  1048576 1047527424       1% /data dir
+@@gsck-fact ips
+10.0.0.1 172.17.0.1 fe80::1
+@@gsck-fact uptime
+90061.52 170000.00
+@@gsck-fact custom.nginx
+nginx version: nginx/1.18.0
+`
+
+func TestParse(t *testing.T) {
+	f := Parse(sample)
+	if f.OS != "Ubuntu 20.04.6 LTS" || f.Kernel != "5.4.0-150-generic" || f.Hostname != "web01" || f.CPUs != 8 {
+		t.Errorf("Unexpected facts: %+v", f)
+	}
+	if f.MemoryMB != 15933 || f.Uptime != 90061 || len(f.IPs) != 3 {
+		t.Errorf("Unexpected facts: %+v", f)
+	}
+	if len(f.Disks) != 2 || f.Disks[1].Mount != "/data dir" || f.Disks[1].SizeMB != 1024000 {
+		t.Errorf("Unexpected disks: %+v", f.Disks)
+	}
+	if f.Custom["nginx"] != "nginx version: nginx/1.18.0" {
+		t.Errorf("Unexpected custom facts: %+v", f.Custom)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	f := Parse(sample)
+	cases := map[string]bool{
+		"facts:kernel~^5.4":       true,
+		"kernel~^5.4,cpus>=16":    false,
+		"cpus>4,memory_mb<=16384": true,
+		"ips=172.17.0.1":          true,
+		"ips!=172.17.0.1":         false,
+		"disks!~^/data":           false,
+		"os!~CentOS,nginx~1\\.18": true,
+		"nothing=x":               false,
+	}
+	for str, expected := range cases {
+		query, err := ParseQuery(str)
+		if err != nil {
+			t.Errorf("%s: %v", str, err)
+			continue
+		}
+		if query.Match(f) != expected {
+			t.Errorf("%s should give %v", str, expected)
+		}
+	}
+	for _, str := range []string{"facts:", "kernel", "cpus>x", "os~("} {
+		if _, err := ParseQuery(str); err == nil {
+			t.Errorf("%s should be invalid", str)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package facts
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lidongpeng36/gsck/hostlist"
+)
+
+func init() {
+	hostlist.RegisterHostlist(func(str string) hostlist.Hostlist {
+		return &fromFacts{str}
+	})
+}
+
+// QueryPrefix starts a hostlist given by facts
+const QueryPrefix = "facts:"
+
+// Operators of conditions. Longer ones go first, since they're matched in order.
+var operators = []string{"!~", "!=", ">=", "<=", "~", "=", ">", "<"}
+
+var keyRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+`)
+
+// condition is `key OP value`
+type condition struct {
+	key   string
+	op    string
+	value string
+	re    *regexp.Regexp
+	num   float64
+}
+
+// Query selects hosts by facts. It's conditions joined by `,`, which all should hold, e.g.
+//   kernel~^5.4,cpus>=8,os!~CentOS
+// Operators: `=` `!=`, `~` `!~` (regular expression), `>` `>=` `<` `<=` (number).
+// Fact with many values (ips, disks) holds a condition if any value does, or all for `!=` and `!~`.
+type Query []*condition
+
+// ParseQuery parses @str, with or without QueryPrefix
+func ParseQuery(str string) (Query, error) {
+	str = strings.TrimPrefix(strings.TrimSpace(str), QueryPrefix)
+	if str == "" {
+		return nil, errors.New("Empty Facts Query")
+	}
+	var query Query
+	for _, part := range strings.Split(str, ",") {
+		key := keyRegexp.FindString(part)
+		rest := part[len(key):]
+		cond := &condition{key: key}
+		for _, op := range operators {
+			if strings.HasPrefix(rest, op) {
+				cond.op = op
+				cond.value = rest[len(op):]
+				break
+			}
+		}
+		if key == "" || cond.op == "" {
+			return nil, fmt.Errorf("Invalid Condition: %s. Should be KEY(=|!=|~|!~|>|>=|<|<=)VALUE", part)
+		}
+		var err error
+		switch cond.op {
+		case "~", "!~":
+			cond.re, err = regexp.Compile(cond.value)
+		case ">", ">=", "<", "<=":
+			cond.num, err = strconv.ParseFloat(cond.value, 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Condition: %s: %v", part, err)
+		}
+		query = append(query, cond)
+	}
+	return query, nil
+}
+
+// test tells whether a single value holds
+func (cond *condition) test(value string) bool {
+	switch cond.op {
+	case "=", "!=":
+		return value == cond.value
+	case "~", "!~":
+		return cond.re.MatchString(value)
+	}
+	num, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return false
+	}
+	switch cond.op {
+	case ">":
+		return num > cond.num
+	case ">=":
+		return num >= cond.num
+	case "<":
+		return num < cond.num
+	}
+	return num <= cond.num
+}
+
+// Match tells whether all conditions hold for @f
+func (q Query) Match(f *Facts) bool {
+	for _, cond := range q {
+		held := false
+		for _, value := range f.Get(cond.key) {
+			if cond.test(value) {
+				held = true
+				break
+			}
+		}
+		negative := cond.op == "!=" || cond.op == "!~"
+		if held == negative {
+			return false
+		}
+	}
+	return true
+}
+
+// fromFacts is hostlist of cached facts, given by `facts:QUERY`
+type fromFacts struct {
+	str string
+}
+
+// pragma mark - Hostlist Interface
+
+func (hf *fromFacts) Name() string {
+	return "facts"
+}
+
+func (hf *fromFacts) Priority() int {
+	return 1
+}
+
+// Get returns hosts whose fresh facts match query. Hosts without fresh facts are left out.
+func (hf *fromFacts) Get() (list hostlist.HostInfoList, err error) {
+	if !strings.HasPrefix(hf.str, QueryPrefix) {
+		err = errors.New("Not a facts query: " + hf.str)
+		return
+	}
+	query, err := ParseQuery(hf.str)
+	if err != nil {
+		return
+	}
+	cache, err := LoadCache(CacheFile())
+	if err != nil {
+		return
+	}
+	for _, f := range cache.Fresh(TTL()) {
+		if query.Match(f) {
+			list = append(list, &hostlist.HostInfo{Index: len(list), Host: f.Host, Port: f.Port, Alias: f.Alias})
+		}
+	}
+	if len(list) == 0 {
+		err = errors.New("No cached facts match " + hf.str + ". Run `gsck facts` to refresh them.")
+	}
+	return
+}
+
+// ShouldBreak is true for `facts:...`
+func (hf *fromFacts) ShouldBreak() bool {
+	return strings.HasPrefix(hf.str, QueryPrefix)
+}
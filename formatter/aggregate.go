@@ -0,0 +1,102 @@
+package formatter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mgutz/ansi"
+)
+
+// aggregateAliasLimit is how many aliases are shown in header of a group
+const aggregateAliasLimit = 8
+
+// outputGroup is hosts with the same output
+type outputGroup struct {
+	aliases []string
+	output  Output
+}
+
+// AggregateFormatter groups hosts with identical output, and prints each group once.
+type AggregateFormatter struct {
+	mu     sync.Mutex
+	groups map[string]*outputGroup
+	order  []string
+}
+
+// NewAggregateFormatter is AggregateFormatter's constructor
+func NewAggregateFormatter() *AggregateFormatter {
+	return &AggregateFormatter{
+		groups: make(map[string]*outputGroup),
+	}
+}
+
+func aggregateKey(output *Output) string {
+	return fmt.Sprintf("%d\x00%s\x00%s\x00%s", output.ExitCode, output.Stdout, output.Stderr, output.Error)
+}
+
+func aggregateHeader(aliases []string) string {
+	text := strings.Join(aliases, ", ")
+	if len(aliases) > aggregateAliasLimit {
+		text = strings.Join(aliases[:aggregateAliasLimit], ", ") +
+			fmt.Sprintf(", ... (+%d)", len(aliases)-aggregateAliasLimit)
+	}
+	text = fmt.Sprintf("%d host(s): %s", len(aliases), text)
+	if side := (fill - len(text) - 2) / 2; side > 3 {
+		text = strings.Repeat("=", side) + " " + text + " " + strings.Repeat("=", side)
+	} else {
+		text = "=== " + text + " ==="
+	}
+	return text
+}
+
+// pragma mark - Formatter Interface
+
+// Add puts output into its group
+func (af *AggregateFormatter) Add(output Output) {
+	af.mu.Lock()
+	defer af.mu.Unlock()
+	key := aggregateKey(&output)
+	group, ok := af.groups[key]
+	if !ok {
+		group = &outputGroup{output: output}
+		af.groups[key] = group
+		af.order = append(af.order, key)
+	}
+	group.aliases = append(group.aliases, output.Alias)
+}
+
+// Print shows groups, the largest first. Failed groups have red headers.
+func (af *AggregateFormatter) Print() {
+	af.mu.Lock()
+	defer af.mu.Unlock()
+	groups := make([]*outputGroup, len(af.order))
+	for i, key := range af.order {
+		groups[i] = af.groups[key]
+		sort.Strings(groups[i].aliases)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].aliases) > len(groups[j].aliases)
+	})
+	reset := ansi.ColorCode("reset")
+	for _, group := range groups {
+		output := group.output
+		headerColor := ansi.ColorCode("green+b")
+		if output.ExitCode != 0 || output.Error != "" {
+			headerColor = ansi.ColorCode("red+b")
+		}
+		fmt.Println(headerColor, aggregateHeader(group.aliases), reset)
+		if "" != output.Stdout {
+			fmt.Println(output.Stdout)
+		}
+		if "" != output.Stderr {
+			fmt.Printf("%s%s%s\n", ansi.ColorCode("red"), output.Stderr, reset)
+		}
+		if "" != output.Error {
+			fmt.Printf("%s%s%s\n", ansi.ColorCode("red+b:white"), output.Error, reset)
+		}
+	}
+	af.groups = make(map[string]*outputGroup)
+	af.order = nil
+}
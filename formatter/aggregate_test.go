@@ -0,0 +1,29 @@
+package formatter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAggregateFormatter(t *testing.T) {
+	af := NewAggregateFormatter()
+	af.Add(Output{Alias: "web02", Stdout: "ok"})
+	af.Add(Output{Alias: "web01", Stdout: "ok"})
+	af.Add(Output{Alias: "web03", Stdout: "ok", ExitCode: 1})
+	if len(af.order) != 2 {
+		t.Fatalf("Expected 2 groups. Actual: %d", len(af.order))
+	}
+	if aliases := af.groups[af.order[0]].aliases; strings.Join(aliases, ",") != "web02,web01" {
+		t.Fatalf("Unexpected group: %v", aliases)
+	}
+}
+
+func TestAggregateHeader(t *testing.T) {
+	aliases := make([]string, aggregateAliasLimit+2)
+	for i := range aliases {
+		aliases[i] = "h"
+	}
+	if header := aggregateHeader(aliases); !strings.Contains(header, "10 host(s)") || !strings.Contains(header, "(+2)") {
+		t.Fatalf("Unexpected header: %s", header)
+	}
+}
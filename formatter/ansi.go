@@ -3,6 +3,8 @@ package formatter
 import (
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/mgutz/ansi"
 )
@@ -16,6 +18,7 @@ func MuteAnsi() {
 
 // AnsiFormatter prints colored Outputs to stdout
 type AnsiFormatter struct {
+	user         string
 	reset        string
 	rootHeader   string
 	normalHeader string
@@ -27,17 +30,19 @@ type AnsiFormatter struct {
 	digits       int
 	digitFormat  string
 	headerSpace  int
+	latency      latencyRecorder
 }
 
 var fill = 72
 
-// NewAnsiFormatter sets default colors.
-func NewAnsiFormatter() *AnsiFormatter {
+// NewAnsiFormatter sets default colors. Header counts hosts of @info.
+func NewAnsiFormatter(info Info) *AnsiFormatter {
 	reset := ansi.ColorCode("reset")
-	count := int64(len(*HostList))
+	count := int64(len(info.Hosts))
 	digits := len(strconv.FormatInt(count, 10))
 	formatStr := fmt.Sprintf("%%%dd / %%%dd : ", digits, digits)
 	ansiFormatter := &AnsiFormatter{
+		user:         info.User,
 		reset:        reset,
 		rootHeader:   ansi.ColorCode("red+b"),
 		normalHeader: ansi.ColorCode("yellow+b"),
@@ -52,11 +57,14 @@ func NewAnsiFormatter() *AnsiFormatter {
 	return ansiFormatter
 }
 
-func (af *AnsiFormatter) generateHeader(hostname string) (header string) {
+func (af *AnsiFormatter) generateHeader(hostname string, duration time.Duration) (header string) {
 	header += fmt.Sprintf(af.digitFormat, af.index, af.count)
 	headerText := hostname
-	if "" != info.User {
-		headerText = info.User + "@" + headerText
+	if "" != af.user {
+		headerText = af.user + "@" + headerText
+	}
+	if duration > 0 {
+		headerText += " (" + formatDuration(duration) + ")"
 	}
 	symCount := (af.headerSpace - len(headerText) - 2) / 2
 	if 3 >= symCount {
@@ -79,12 +87,21 @@ func (af *AnsiFormatter) generateHeader(hostname string) (header string) {
 // Add will print output to screen as AnsiFormatter is a real-time Formatter.
 func (af *AnsiFormatter) Add(output Output) {
 	af.index = af.index + 1
-	header := af.generateHeader(output.Alias)
+	af.latency.add(&output)
+	header := af.generateHeader(output.Alias, output.Duration())
 	headerFmt := af.normalHeader
-	if "root" == info.User {
+	if "root" == af.user {
 		headerFmt = af.rootHeader
 	}
 	fmt.Println(headerFmt, header, af.reset)
+	for i, attempt := range output.Attempts {
+		reason := attempt.Error
+		if "" == reason {
+			reason = fmt.Sprintf("exit code %d", attempt.ExitCode)
+		}
+		fmt.Printf("%sAttempt %d failed at %s (%s): %s%s\n", af.stderr, i+1, attempt.Phase,
+			formatDuration(attempt.Duration), reason, af.reset)
+	}
 	if "" != output.Stdout {
 		fmt.Printf("%s%s%s\n", af.stdout, output.Stdout, af.reset)
 	}
@@ -96,5 +113,25 @@ func (af *AnsiFormatter) Add(output Output) {
 	}
 }
 
-// Print do nothing
-func (af *AnsiFormatter) Print() {}
+// Print shows latency summary, if more than one host has been timed.
+func (af *AnsiFormatter) Print() {
+	if af.latency.count() < 2 {
+		return
+	}
+	latency := af.latency.summary(SlowestCount)
+	title := " SUMMARY "
+	side := strings.Repeat("=", (fill-len(title))/2)
+	header := side + title + side
+	header += strings.Repeat("=", fill-len(header))
+	fmt.Println(af.normalHeader, header, af.reset)
+	fmt.Printf("Total: %s  p50: %s  p90: %s  p99: %s\n",
+		formatDuration(latency.Wall),
+		formatDuration(latency.P50),
+		formatDuration(latency.P90),
+		formatDuration(latency.P99))
+	slowest := make([]string, len(latency.Slowest))
+	for i, hd := range latency.Slowest {
+		slowest[i] = fmt.Sprintf("%s(%s)", hd.Alias, formatDuration(hd.Duration))
+	}
+	fmt.Printf("Slowest: %s\n", strings.Join(slowest, ", "))
+}
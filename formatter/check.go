@@ -0,0 +1,158 @@
+package formatter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Classes of CheckResult, ordered by the phase that fails
+const (
+	CheckOK      = "ok"
+	CheckDNS     = "dns"
+	CheckNetwork = "network"
+	CheckSSH     = "ssh"
+	CheckHostKey = "hostkey"
+	CheckAuth    = "auth"
+	CheckExec    = "exec"
+)
+
+// Status of host key, compared with known_hosts
+const (
+	HostKeyKnown     = "known"
+	HostKeyUnknown   = "unknown"
+	HostKeyMismatch  = "mismatch"
+	HostKeyRevoked   = "revoked"
+	HostKeyUnchecked = "unchecked"
+)
+
+// CheckResult holds diagnostics of a host, phase by phase.
+// Phases after the failed one are left empty.
+type CheckResult struct {
+	Index int    `json:"index"`
+	Alias string `json:"alias"`
+	Host  string `json:"host"`
+	Port  string `json:"port"`
+	User  string `json:"user"`
+	// Class is the first phase that fails, or CheckOK
+	Class string `json:"class"`
+	Error string `json:"error"`
+	// Addresses are resolved from Host
+	Addresses []string      `json:"addresses,omitempty"`
+	DNS       time.Duration `json:"dns"`
+	Connect   time.Duration `json:"connect"`
+	Handshake time.Duration `json:"handshake"`
+	Exec      time.Duration `json:"exec"`
+	// ServerVersion is identification string of server, e.g. SSH-2.0-OpenSSH_7.4
+	ServerVersion string `json:"server_version,omitempty"`
+	// Banner is the message shown by server before authentication
+	Banner  string       `json:"banner,omitempty"`
+	HostKey HostKeyCheck `json:"hostkey"`
+	// AuthOffered are methods that server accepts for this user
+	AuthOffered []string `json:"auth_offered,omitempty"`
+	// AuthTried are methods client tried, in order
+	AuthTried    []string `json:"auth_tried,omitempty"`
+	AuthAccepted string   `json:"auth_accepted,omitempty"`
+}
+
+// HostKeyCheck describes host key of server
+type HostKeyCheck struct {
+	Status      string `json:"status,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// Failed returns whether any phase fails
+func (cr *CheckResult) Failed() bool {
+	return cr.Class != CheckOK
+}
+
+// CheckFormatter prints CheckResults in table, or in JSON
+type CheckFormatter struct {
+	results []*CheckResult
+	json    bool
+}
+
+// NewCheckFormatter is CheckFormatter's constructor
+func NewCheckFormatter(inJSON bool) *CheckFormatter {
+	return &CheckFormatter{json: inJSON}
+}
+
+// Add collects result of a host
+func (cf *CheckFormatter) Add(result *CheckResult) {
+	cf.results = append(cf.results, result)
+}
+
+// Print prints all results that collected by Add, in order of hostlist
+func (cf *CheckFormatter) Print() {
+	sort.SliceStable(cf.results, func(i, j int) bool {
+		return cf.results[i].Index < cf.results[j].Index
+	})
+	if cf.json {
+		cf.printJSON()
+	} else {
+		cf.printTable()
+	}
+}
+
+func (cf *CheckFormatter) summary() map[string]int {
+	summary := make(map[string]int)
+	for _, result := range cf.results {
+		summary[result.Class]++
+	}
+	return summary
+}
+
+func (cf *CheckFormatter) printJSON() {
+	data := struct {
+		List    []*CheckResult `json:"list"`
+		Summary map[string]int `json:"summary"`
+	}{cf.results, cf.summary()}
+	enc, err := json.MarshalIndent(data, "", "    ")
+	if nil != err {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(string(enc))
+}
+
+func (cf *CheckFormatter) printTable() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tCLASS\tDNS\tCONNECT\tVERSION\tHOSTKEY\tAUTH\tERROR")
+	phase := func(d time.Duration) string {
+		if d == 0 {
+			return "-"
+		}
+		return formatDuration(d)
+	}
+	orDash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	for _, r := range cf.results {
+		auth := r.AuthAccepted
+		if auth == "" && len(r.AuthOffered) > 0 {
+			auth = "offered:" + strings.Join(r.AuthOffered, ",")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.Alias, r.Class, phase(r.DNS), phase(r.Connect),
+			orDash(strings.TrimPrefix(r.ServerVersion, "SSH-2.0-")),
+			orDash(r.HostKey.Status), orDash(auth), orDash(r.Error))
+	}
+	_ = w.Flush()
+	summary := cf.summary()
+	classes := []string{CheckOK, CheckDNS, CheckNetwork, CheckSSH, CheckHostKey, CheckAuth, CheckExec}
+	counts := make([]string, 0, len(classes))
+	for _, class := range classes {
+		if n := summary[class]; n > 0 {
+			counts = append(counts, fmt.Sprintf("%s: %d", class, n))
+		}
+	}
+	fmt.Printf("\nTotal: %d, %s\n", len(cf.results), strings.Join(counts, ", "))
+}
@@ -1,17 +1,11 @@
 package formatter
 
 import (
+	"time"
+
 	"github.com/lidongpeng36/gsck/hostlist"
 )
 
-var info *Info
-
-var HostList *hostlist.HostInfoList
-
-func init() {
-	info = new(Info)
-}
-
 // Output holds executor's output. And Formatter uses it for show.
 type Output struct {
 	Index  int    `json:"index"`
@@ -23,24 +17,105 @@ type Output struct {
 	// Alias is the hostname that shown to user
 	Alias    string `json:"alias"`
 	ExitCode int    `json:"exitcode"`
+	// Cancelled is true if execution was stopped (or never started) due to cancellation
+	Cancelled bool `json:"cancelled"`
+	// TimedOut is true if host ran out of connect/command timeout, or the whole run hit its deadline
+	TimedOut bool `json:"timedout"`
+	// Start and End mark when the worker began and finished this host
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Phases Phases    `json:"phases"`
+	// Attempts are failed tries before the final one
+	Attempts []Attempt `json:"attempts,omitempty"`
+	// Plan is what would be run on this host. Only set in dry-run.
+	Plan *Plan `json:"plan,omitempty"`
 }
 
-// Info is the shared infomation for all Formatters
-// Formatters may want to change print style by Info
-type Info struct {
-	User        string
-	Concurrency int64
+// Plan describes what a worker would do for a host, without doing it
+type Plan struct {
+	User string `json:"user"`
+	Host string `json:"host"`
+	Port string `json:"port"`
+	Cmd  string `json:"cmd"`
+	// Transfer describes file copying, empty if there is none
+	Transfer string `json:"transfer,omitempty"`
+}
+
+// String shows Plan in lines, e.g.
+//
+//	root@10.0.0.1:22
+//	$ uptime
+func (p *Plan) String() string {
+	text := p.Host
+	if p.Port != "" {
+		text += ":" + p.Port
+	}
+	if p.User != "" {
+		text = p.User + "@" + text
+	}
+	if p.Transfer != "" {
+		text += "\ntransfer: " + p.Transfer
+	}
+	return text + "\n$ " + p.Cmd
+}
+
+// Attempt records a failed try that has been retried
+type Attempt struct {
+	Phase    string        `json:"phase"`
+	Error    string        `json:"error"`
+	ExitCode int           `json:"exitcode"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Phases holds how long each step of an execution took.
+// Worker leaves a phase zero if it does not have such step.
+type Phases struct {
+	Connect  time.Duration `json:"connect"`
+	Transfer time.Duration `json:"transfer"`
+	Exec     time.Duration `json:"exec"`
+}
+
+// Duration returns time elapsed between Start and End
+func (o *Output) Duration() time.Duration {
+	if o.Start.IsZero() || o.End.Before(o.Start) {
+		return 0
+	}
+	return o.End.Sub(o.Start)
+}
+
+// Outcomes of Output
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailed  = "failed"
+	OutcomeError   = "error"
+)
+
+// Outcome tells how host ended: error if command did not run through (e.g. connection refused,
+// cancelled or timed out), failed if it exited non-zero, or success.
+// Workers put stderr in Error once command exits non-zero, so exit code is looked at before Error.
+func (o *Output) Outcome() string {
+	switch {
+	case o.Cancelled || o.TimedOut || o.ExitCode < 0:
+		return OutcomeError
+	case o.ExitCode > 0:
+		return OutcomeFailed
+	case o.Error != "":
+		return OutcomeError
+	}
+	return OutcomeSuccess
 }
 
-// SetInfo sets package var: info
-func SetInfo(user string, concurrency int64) {
-	info.User = user
-	info.Concurrency = concurrency
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
 }
 
-// SetHostInfoList sets global hostlist
-func SetHostInfoList(list *hostlist.HostInfoList) {
-	HostList = list
+// Info describes the run for Formatters, which may change print style by it.
+// It's given to constructors, so Formatters of different runs never share it.
+type Info struct {
+	User        string
+	Concurrency int64
+	Hosts       hostlist.HostInfoList
 }
 
 // Formatter formats Output for each host.
@@ -54,30 +129,26 @@ type Formatter interface {
 type abstractFormatter struct {
 	aliasList []string
 	hostList  []string
-	hiList    *hostlist.HostInfoList
+	hiList    hostlist.HostInfoList
 	count     int64
 }
 
-func newAbstractFormatter() *abstractFormatter {
-	// hiList := _hostinfoList
-	// if hiList == nil {
-	// 	hiList, _ = hostlist.GetHostList("", "")
-	// }
-	count := int64(len(*HostList))
+func newAbstractFormatter(list hostlist.HostInfoList) *abstractFormatter {
+	count := int64(len(list))
 	abf := &abstractFormatter{
-		hiList:    HostList,
+		hiList:    list,
 		count:     count,
 		aliasList: make([]string, count),
 		hostList:  make([]string, count),
 	}
-	for i, hi := range *HostList {
+	for i, hi := range list {
 		abf.aliasList[i] = hi.Alias
 		abf.hostList[i] = hi.Host
 	}
 	return abf
 }
 
-func (abf *abstractFormatter) hosts() *hostlist.HostInfoList {
+func (abf *abstractFormatter) hosts() hostlist.HostInfoList {
 	return abf.hiList
 }
 
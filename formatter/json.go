@@ -9,15 +9,17 @@ import (
 type jsonData struct {
 	List    []Output `json:"list"`
 	Summary struct {
-		Success int64 `json:"success"`
-		Failed  int64 `json:"failed"`
-		Error   int64 `json:"error"`
+		Success int64    `json:"success"`
+		Failed  int64    `json:"failed"`
+		Error   int64    `json:"error"`
+		Latency *Latency `json:"latency,omitempty"`
 	} `json:"summary"`
 }
 
 // JSONFormatter prints Outputs in JSON format.
 type JSONFormatter struct {
-	data *jsonData
+	data    *jsonData
+	latency latencyRecorder
 }
 
 // NewJSONFormatter is JSONFormatter's constructor
@@ -35,6 +37,7 @@ func NewJSONFormatter() *JSONFormatter {
 // Add just collects all outputs, no prints.
 func (jf *JSONFormatter) Add(output Output) {
 	jf.data.List = append(jf.data.List, output)
+	jf.latency.add(&output)
 	if "" != output.Error {
 		jf.data.Summary.Error++
 	} else if 0 != output.ExitCode {
@@ -48,6 +51,7 @@ func (jf *JSONFormatter) Add(output Output) {
 func (jf *JSONFormatter) Print() {
 	var enc []byte
 	var err error
+	jf.data.Summary.Latency = jf.latency.summary(SlowestCount)
 	// if config.GetBool("json.pretty") {
 	// 	enc, err = json.MarshalIndent(jf.data, "", "    ")
 	// } else {
@@ -0,0 +1,97 @@
+package formatter
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// SlowestCount is how many hosts the run summary lists as slowest
+var SlowestCount = 5
+
+// HostDuration pairs a host with the time its execution took
+type HostDuration struct {
+	Alias    string        `json:"alias"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Latency summarizes durations of all hosts in a run.
+// Wall is the time between the earliest Start and the latest End.
+type Latency struct {
+	Wall    time.Duration  `json:"wall"`
+	P50     time.Duration  `json:"p50"`
+	P90     time.Duration  `json:"p90"`
+	P99     time.Duration  `json:"p99"`
+	Slowest []HostDuration `json:"slowest"`
+}
+
+// latencyRecorder collects timing of Outputs, and summarizes them at last
+type latencyRecorder struct {
+	hosts []HostDuration
+	start time.Time
+	end   time.Time
+}
+
+func (lr *latencyRecorder) add(output *Output) {
+	if output.Start.IsZero() {
+		return
+	}
+	lr.hosts = append(lr.hosts, HostDuration{
+		Alias:    output.Alias,
+		Duration: output.Duration(),
+	})
+	if lr.start.IsZero() || output.Start.Before(lr.start) {
+		lr.start = output.Start
+	}
+	if output.End.After(lr.end) {
+		lr.end = output.End
+	}
+}
+
+func (lr *latencyRecorder) count() int {
+	return len(lr.hosts)
+}
+
+// summary returns nil if no Output carries timing
+func (lr *latencyRecorder) summary(slowest int) *Latency {
+	if len(lr.hosts) == 0 {
+		return nil
+	}
+	sorted := make([]HostDuration, len(lr.hosts))
+	copy(sorted, lr.hosts)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Duration > sorted[j].Duration
+	})
+	durations := make([]time.Duration, len(sorted))
+	for i, hd := range sorted {
+		durations[len(sorted)-1-i] = hd.Duration
+	}
+	if slowest > len(sorted) {
+		slowest = len(sorted)
+	}
+	if slowest < 0 {
+		slowest = 0
+	}
+	return &Latency{
+		Wall:    lr.end.Sub(lr.start),
+		P50:     percentile(durations, 50),
+		P90:     percentile(durations, 90),
+		P99:     percentile(durations, 99),
+		Slowest: sorted[:slowest],
+	}
+}
+
+// percentile uses nearest-rank method. @sorted must be in ascending order.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,30 @@
+package formatter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencySummary(t *testing.T) {
+	var lr latencyRecorder
+	base := time.Now()
+	for i := 1; i <= 10; i++ {
+		lr.add(&Output{
+			Alias: string(rune('a' + i - 1)),
+			Start: base,
+			End:   base.Add(time.Duration(i) * time.Second),
+		})
+	}
+	// Output without timing is ignored
+	lr.add(&Output{Alias: "untimed"})
+	latency := lr.summary(3)
+	if latency.Wall != 10*time.Second {
+		t.Fatalf("Wall Expected: 10s. Actual: %s", latency.Wall)
+	}
+	if latency.P50 != 5*time.Second || latency.P90 != 9*time.Second || latency.P99 != 10*time.Second {
+		t.Fatalf("Percentiles Expected: 5s/9s/10s. Actual: %s/%s/%s", latency.P50, latency.P90, latency.P99)
+	}
+	if len(latency.Slowest) != 3 || latency.Slowest[0].Alias != "j" || latency.Slowest[2].Alias != "h" {
+		t.Fatalf("Slowest Expected: j, i, h. Actual: %v", latency.Slowest)
+	}
+}
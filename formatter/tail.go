@@ -0,0 +1,291 @@
+package formatter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/mgutz/ansi"
+	tm "github.com/nsf/termbox-go"
+	ui "gopkg.in/gizak/termui.v2"
+)
+
+// TailView shows lines streamed from hosts
+type TailView interface {
+	// Output returns where output of host @index is written to
+	Output(index int) io.Writer
+	// Notice shows state of host @index, e.g. reconnecting
+	Notice(index int, msg string)
+}
+
+// lineWriter splits what is written into lines, and emits those matching grep.
+// Incomplete line is kept until the rest comes.
+type lineWriter struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	grep *regexp.Regexp
+	emit func(line string)
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	lw.buf.Write(p)
+	for {
+		i := bytes.IndexByte(lw.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimRight(string(lw.buf.Next(i+1)), "\r\n")
+		if lw.grep == nil || lw.grep.MatchString(line) {
+			lw.emit(line)
+		}
+	}
+	return len(p), nil
+}
+
+// tailColors are picked for aliases in turn
+var tailColors = []string{"green", "yellow", "blue", "magenta", "cyan", "red", "green+h", "yellow+h", "blue+h", "magenta+h", "cyan+h"}
+
+// TailPrinter prints lines of all hosts into stdout, each prefixed with a colored alias.
+type TailPrinter struct {
+	mu       sync.Mutex
+	out      io.Writer
+	prefixes []string
+	writers  []*lineWriter
+}
+
+// NewTailPrinter is TailPrinter's constructor. Only lines matching @grep are printed, if it's not nil.
+func NewTailPrinter(aliases []string, grep *regexp.Regexp) *TailPrinter {
+	tp := &TailPrinter{
+		out:      os.Stdout,
+		prefixes: make([]string, len(aliases)),
+		writers:  make([]*lineWriter, len(aliases)),
+	}
+	width := 0
+	for _, alias := range aliases {
+		if len(alias) > width {
+			width = len(alias)
+		}
+	}
+	reset := ansi.ColorCode("reset")
+	for i, alias := range aliases {
+		color := ansi.ColorCode(tailColors[i%len(tailColors)])
+		tp.prefixes[i] = fmt.Sprintf("%s%-*s%s | ", color, width, alias, reset)
+		prefix := tp.prefixes[i]
+		tp.writers[i] = &lineWriter{grep: grep, emit: func(line string) {
+			tp.print(prefix + line)
+		}}
+	}
+	return tp
+}
+
+func (tp *TailPrinter) print(line string) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	fmt.Fprintln(tp.out, line)
+}
+
+// Output is part of TailView interface
+func (tp *TailPrinter) Output(index int) io.Writer {
+	return tp.writers[index]
+}
+
+// Notice is part of TailView interface. Empty @msg, which clears state in window, is not printed.
+func (tp *TailPrinter) Notice(index int, msg string) {
+	if msg == "" {
+		return
+	}
+	tp.print(tp.prefixes[index] + ansi.Color("-- "+msg, "black+h"))
+}
+
+const tailUsage = "q: quit    n/p: next/previous page"
+
+// tailLines is how many lines are kept for each host in window
+const tailLines = 500
+
+type tailPane struct {
+	alias  string
+	lines  []string
+	notice string
+	view   *ui.List
+}
+
+// TailWindow shows lines of each host in its own pane, page by page.
+type TailWindow struct {
+	mu       sync.Mutex
+	panes    []*tailPane
+	writers  []*lineWriter
+	page     int
+	perPage  int
+	help     *ui.Par
+	refreshc chan bool
+}
+
+// NewTailWindow initializes termui for hosts of @aliases. Only lines matching @grep are shown, if it's not nil.
+func NewTailWindow(aliases []string, grep *regexp.Regexp) (*TailWindow, error) {
+	if err := ui.Init(); err != nil {
+		return nil, err
+	}
+	tw := &TailWindow{
+		panes:    make([]*tailPane, len(aliases)),
+		writers:  make([]*lineWriter, len(aliases)),
+		help:     ui.NewPar(tailUsage),
+		refreshc: make(chan bool, 1),
+	}
+	for i, alias := range aliases {
+		pane := &tailPane{alias: alias, view: ui.NewList()}
+		tw.panes[i] = pane
+		tw.writers[i] = &lineWriter{grep: grep, emit: func(line string) {
+			tw.mu.Lock()
+			pane.lines = append(pane.lines, line)
+			if len(pane.lines) > tailLines {
+				pane.lines = pane.lines[len(pane.lines)-tailLines:]
+			}
+			tw.mu.Unlock()
+			tw.setNeedRefresh()
+		}}
+	}
+	tw.help.Height = 3
+	tw.help.BorderLabel = "HELP"
+	tw.help.BorderFg = ui.ColorCyan
+	tw.layout()
+	return tw, nil
+}
+
+// layout arranges panes of current page into a grid: 1, 2 or 3 columns,
+// and as many rows as fit with at least 5 lines each.
+func (tw *TailWindow) layout() {
+	count := len(tw.panes)
+	cols := 3
+	if count <= 1 {
+		cols = 1
+	} else if count <= 4 {
+		cols = 2
+	}
+	height := ui.TermHeight() - tw.help.Height
+	rows := height / 5
+	if rows < 1 {
+		rows = 1
+	}
+	if need := (count + cols - 1) / cols; need < rows {
+		rows = need
+	}
+	tw.perPage = rows * cols
+	if tw.page*tw.perPage >= count {
+		tw.page = 0
+	}
+	ui.Body.Rows = nil
+	start := tw.page * tw.perPage
+	for r := 0; r < rows; r++ {
+		row := ui.NewRow()
+		for c := 0; c < cols; c++ {
+			i := start + r*cols + c
+			if i >= count {
+				break
+			}
+			pane := tw.panes[i]
+			pane.view.Height = height / rows
+			row.Cols = append(row.Cols, ui.NewCol(12/cols, 0, pane.view))
+		}
+		if len(row.Cols) > 0 {
+			ui.Body.AddRows(row)
+		}
+	}
+	ui.Body.AddRows(ui.NewRow(ui.NewCol(12, 0, tw.help)))
+	ui.Body.Width = ui.TermWidth()
+	ui.Body.Align()
+}
+
+// Output is part of TailView interface
+func (tw *TailWindow) Output(index int) io.Writer {
+	return tw.writers[index]
+}
+
+// Notice is part of TailView interface
+func (tw *TailWindow) Notice(index int, msg string) {
+	tw.mu.Lock()
+	tw.panes[index].notice = msg
+	tw.mu.Unlock()
+	tw.setNeedRefresh()
+}
+
+func (tw *TailWindow) setNeedRefresh() {
+	select {
+	case tw.refreshc <- true:
+	default:
+	}
+}
+
+func (tw *TailWindow) refresh() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	start := tw.page * tw.perPage
+	for i := start; i < start+tw.perPage && i < len(tw.panes); i++ {
+		pane := tw.panes[i]
+		pane.view.BorderLabel = pane.alias
+		pane.view.BorderFg = ui.ColorDefault
+		if pane.notice != "" {
+			pane.view.BorderLabel += " (" + pane.notice + ")"
+			pane.view.BorderFg = ui.ColorRed
+		}
+		lines := pane.lines
+		if n := pane.view.Height - 2; n >= 0 && len(lines) > n {
+			lines = lines[len(lines)-n:]
+		}
+		pane.view.Items = lines
+	}
+	pages := (len(tw.panes) + tw.perPage - 1) / tw.perPage
+	tw.help.Text = fmt.Sprintf("%s    page %d/%d", tailUsage, tw.page+1, pages)
+	ui.Render(ui.Body)
+}
+
+// turn goes @delta pages forward (or backward)
+func (tw *TailWindow) turn(delta int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	pages := (len(tw.panes) + tw.perPage - 1) / tw.perPage
+	tw.page = ((tw.page+delta)%pages + pages) % pages
+	tw.layout()
+}
+
+// Run shows window until user quits, or @done is closed
+func (tw *TailWindow) Run(done <-chan struct{}) {
+	defer ui.Close()
+	events := make(chan tm.Event)
+	go func() {
+		for {
+			events <- tm.PollEvent()
+		}
+	}()
+	tw.setNeedRefresh()
+	for {
+		select {
+		case <-done:
+			return
+		case <-tw.refreshc:
+			tw.refresh()
+		case e := <-events:
+			switch e.Type {
+			case tm.EventResize:
+				tw.mu.Lock()
+				tw.layout()
+				tw.mu.Unlock()
+			case tm.EventKey:
+				switch {
+				case e.Key == tm.KeyCtrlC || e.Ch == 'q':
+					return
+				case e.Ch == 'n' || e.Key == tm.KeyPgdn:
+					tw.turn(1)
+				case e.Ch == 'p' || e.Key == tm.KeyPgup:
+					tw.turn(-1)
+				}
+			}
+			tw.refresh()
+		}
+	}
+}
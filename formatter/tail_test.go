@@ -0,0 +1,20 @@
+package formatter
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	lw := &lineWriter{grep: regexp.MustCompile("ERROR"), emit: func(line string) {
+		lines = append(lines, line)
+	}}
+	for _, chunk := range []string{"ok 1\nERR", "OR 2\r\n", "ERROR 3"} {
+		_, _ = lw.Write([]byte(chunk))
+	}
+	// Incomplete line is not emitted
+	if len(lines) != 1 || lines[0] != "ERROR 2" {
+		t.Fatalf("Unexpected lines: %q", lines)
+	}
+}
@@ -0,0 +1,441 @@
+package formatter
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	tm "github.com/nsf/termbox-go"
+	ui "gopkg.in/gizak/termui.v2"
+)
+
+const terminalUsage = "j/k:HOST; SPACE:TOGGLE BROADCAST; a:TOGGLE ALL; i:TYPE INTO BROADCAST HOSTS; q/C-c:QUIT"
+const terminalInsertUsage = "-- TYPING INTO BROADCAST HOSTS -- C-]:BACK"
+
+// termScreenLines is how many lines a termScreen keeps
+const termScreenLines = 1000
+
+// Terminal is what TerminalWindow sends keystrokes to
+type Terminal interface {
+	io.Writer
+	Resize(width, height int) error
+}
+
+// termScreen turns output of a terminal into lines of plain text.
+// It's not a terminal emulator: escape sequences are dropped, and only \r, \n and \b are handled.
+type termScreen struct {
+	mu    sync.Mutex
+	lines []string
+	line  []rune
+	// col is where next rune is written in line, moved back by \r and \b
+	col int
+	// escape is the pending escape sequence
+	escape []byte
+	// partial is a incomplete UTF-8 rune
+	partial []byte
+}
+
+func (ts *termScreen) newLine() {
+	ts.lines = append(ts.lines, string(ts.line))
+	if len(ts.lines) > termScreenLines {
+		ts.lines = ts.lines[len(ts.lines)-termScreenLines:]
+	}
+	ts.line = ts.line[:0]
+	ts.col = 0
+}
+
+func (ts *termScreen) put(r rune) {
+	if ts.col < len(ts.line) {
+		ts.line[ts.col] = r
+	} else {
+		ts.line = append(ts.line, r)
+	}
+	ts.col++
+}
+
+// inEscape feeds @b to pending escape sequence, and returns whether it's still pending
+func (ts *termScreen) inEscape(b byte) bool {
+	ts.escape = append(ts.escape, b)
+	if len(ts.escape) == 1 {
+		return true
+	}
+	switch ts.escape[1] {
+	case '[':
+		// CSI ends with a byte in 0x40-0x7E
+		return len(ts.escape) == 2 || b < 0x40 || b > 0x7e
+	case ']':
+		// OSC ends with BEL or ST
+		return b != 0x07 && !(b == '\\' && ts.escape[len(ts.escape)-2] == 0x1b)
+	case '(', ')':
+		return len(ts.escape) < 3
+	}
+	return false
+}
+
+func (ts *termScreen) Write(p []byte) (int, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	data := append(ts.partial, p...)
+	ts.partial = nil
+	for len(data) > 0 {
+		b := data[0]
+		if len(ts.escape) > 0 {
+			if !ts.inEscape(b) {
+				ts.escape = ts.escape[:0]
+			}
+			data = data[1:]
+			continue
+		}
+		if b < utf8.RuneSelf {
+			switch b {
+			case 0x1b:
+				ts.inEscape(b)
+			case '\n':
+				ts.newLine()
+			case '\r':
+				ts.col = 0
+			case '\b':
+				if ts.col > 0 {
+					ts.col--
+				}
+			case '\t':
+				ts.put(' ')
+			default:
+				if b >= 0x20 && b != 0x7f {
+					ts.put(rune(b))
+				}
+			}
+			data = data[1:]
+			continue
+		}
+		if !utf8.FullRune(data) {
+			ts.partial = append([]byte(nil), data...)
+			break
+		}
+		r, size := utf8.DecodeRune(data)
+		ts.put(r)
+		data = data[size:]
+	}
+	return len(p), nil
+}
+
+// tail returns the last @n lines, including the one being written
+func (ts *termScreen) tail(n int) []string {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	lines := append(append([]string(nil), ts.lines...), string(ts.line))
+	if n >= 0 && len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// terminalHost is state of a host in TerminalWindow
+type terminalHost struct {
+	alias     string
+	screen    *termScreen
+	term      Terminal
+	broadcast bool
+	closed    bool
+	reason    string
+}
+
+// TerminalWindow shows live terminals of hosts, and broadcasts keystrokes to the selected ones.
+type TerminalWindow struct {
+	mu       sync.Mutex
+	hosts    []*terminalHost
+	selected int
+	insert   bool
+	hostView *ui.List
+	termView *ui.List
+	help     *ui.Par
+	refreshc chan bool
+	width    int
+	height   int
+}
+
+// NewTerminalWindow initializes termui for hosts of @aliases. All hosts are in broadcast at first.
+func NewTerminalWindow(aliases []string) (*TerminalWindow, error) {
+	if err := ui.Init(); err != nil {
+		return nil, err
+	}
+	tw := &TerminalWindow{
+		hosts:    make([]*terminalHost, len(aliases)),
+		hostView: ui.NewList(),
+		termView: ui.NewList(),
+		help:     ui.NewPar(terminalUsage),
+		refreshc: make(chan bool, 1),
+	}
+	for i, alias := range aliases {
+		tw.hosts[i] = &terminalHost{alias: alias, screen: new(termScreen), broadcast: true}
+	}
+	tw.hostView.BorderLabel = "HOSTS"
+	tw.termView.BorderLabel = "TERMINAL"
+	tw.help.Height = 3
+	tw.help.BorderLabel = "HELP"
+	tw.help.BorderFg = ui.ColorCyan
+	ui.Body.AddRows(
+		ui.NewRow(
+			ui.NewCol(3, 0, tw.hostView),
+			ui.NewCol(9, 0, tw.termView),
+		),
+		ui.NewRow(
+			ui.NewCol(12, 0, tw.help),
+		),
+	)
+	tw.layout()
+	return tw, nil
+}
+
+// layout fits widgets into screen, and returns whether size of terminal pane changed
+func (tw *TerminalWindow) layout() bool {
+	height := ui.TermHeight() - tw.help.Height
+	if height < 3 {
+		height = 3
+	}
+	tw.hostView.Height = height
+	tw.termView.Height = height
+	ui.Body.Width = ui.TermWidth()
+	ui.Body.Align()
+	width, height := tw.termView.Width-2, tw.termView.Height-2
+	changed := width != tw.width || height != tw.height
+	tw.width, tw.height = width, height
+	return changed
+}
+
+// Size returns width and height of terminal pane
+func (tw *TerminalWindow) Size() (width, height int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.width, tw.height
+}
+
+type terminalOutput struct {
+	tw    *TerminalWindow
+	index int
+}
+
+func (to *terminalOutput) Write(p []byte) (int, error) {
+	n, err := to.tw.hosts[to.index].screen.Write(p)
+	to.tw.setNeedRefresh()
+	return n, err
+}
+
+// Output returns where terminal of host @index writes to
+func (tw *TerminalWindow) Output(index int) io.Writer {
+	return &terminalOutput{tw: tw, index: index}
+}
+
+// Attach binds @term to host @index
+func (tw *TerminalWindow) Attach(index int, term Terminal) {
+	tw.mu.Lock()
+	tw.hosts[index].term = term
+	tw.mu.Unlock()
+	tw.setNeedRefresh()
+}
+
+// Detach marks terminal of host @index as closed, for @err
+func (tw *TerminalWindow) Detach(index int, err error) {
+	tw.mu.Lock()
+	host := tw.hosts[index]
+	host.closed = true
+	host.reason = "closed"
+	if err != nil {
+		host.reason = err.Error()
+	}
+	tw.mu.Unlock()
+	tw.setNeedRefresh()
+}
+
+func (tw *TerminalWindow) setNeedRefresh() {
+	select {
+	case tw.refreshc <- true:
+	default:
+	}
+}
+
+func (tw *TerminalWindow) refresh() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	digits := len(strconv.Itoa(len(tw.hosts)))
+	lines := make([]string, len(tw.hosts))
+	for i, host := range tw.hosts {
+		mark := " "
+		if host.broadcast {
+			mark = "x"
+		}
+		state := ""
+		if host.closed {
+			state = " (" + host.reason + ")"
+		} else if host.term == nil {
+			state = " (connecting)"
+		}
+		cursor := "  "
+		if i == tw.selected {
+			cursor = "->"
+		}
+		lines[i] = fmt.Sprintf("%s[%*d] [%s] %s%s", cursor, digits, i+1, mark, host.alias, state)
+	}
+	// Keep selected host visible
+	if pageSize := tw.hostView.Height - 2; pageSize > 0 && tw.selected >= pageSize {
+		lines = lines[tw.selected-pageSize+1:]
+	}
+	tw.hostView.Items = lines
+	host := tw.hosts[tw.selected]
+	tw.termView.BorderLabel = "TERMINAL: " + host.alias
+	tw.termView.Items = host.screen.tail(tw.height)
+	if tw.insert {
+		tw.help.Text = terminalInsertUsage
+		tw.help.BorderFg = ui.ColorRed
+	} else {
+		tw.help.Text = terminalUsage
+		tw.help.BorderFg = ui.ColorCyan
+	}
+	ui.Render(ui.Body)
+}
+
+// broadcast sends @data to terminals of hosts in broadcast
+func (tw *TerminalWindow) broadcast(data []byte) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	for _, host := range tw.hosts {
+		if host.broadcast && host.term != nil && !host.closed {
+			_, _ = host.term.Write(data)
+		}
+	}
+}
+
+// keyBytes translates key event into what a terminal expects
+func keyBytes(e tm.Event) []byte {
+	var data []byte
+	if e.Ch != 0 {
+		data = []byte(string(e.Ch))
+	} else {
+		switch e.Key {
+		case tm.KeyArrowUp:
+			data = []byte("\x1b[A")
+		case tm.KeyArrowDown:
+			data = []byte("\x1b[B")
+		case tm.KeyArrowRight:
+			data = []byte("\x1b[C")
+		case tm.KeyArrowLeft:
+			data = []byte("\x1b[D")
+		case tm.KeyHome:
+			data = []byte("\x1b[H")
+		case tm.KeyEnd:
+			data = []byte("\x1b[F")
+		case tm.KeyDelete:
+			data = []byte("\x1b[3~")
+		case tm.KeyPgup:
+			data = []byte("\x1b[5~")
+		case tm.KeyPgdn:
+			data = []byte("\x1b[6~")
+		case tm.KeySpace:
+			data = []byte(" ")
+		default:
+			// Control keys are their ASCII codes, e.g. KeyEnter is \r
+			if e.Key <= 0x7f {
+				data = []byte{byte(e.Key)}
+			}
+		}
+	}
+	if len(data) > 0 && e.Mod&tm.ModAlt != 0 {
+		data = append([]byte{0x1b}, data...)
+	}
+	return data
+}
+
+// handleKey returns false to quit
+func (tw *TerminalWindow) handleKey(e tm.Event) bool {
+	if tw.insert {
+		if e.Key == tm.KeyCtrlRsqBracket {
+			tw.insert = false
+		} else {
+			tw.broadcast(keyBytes(e))
+		}
+		return true
+	}
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	count := len(tw.hosts)
+	switch {
+	case e.Key == tm.KeyCtrlC || e.Ch == 'q':
+		return false
+	case e.Ch == 'j' || e.Key == tm.KeyArrowDown:
+		tw.selected = (tw.selected + 1) % count
+	case e.Ch == 'k' || e.Key == tm.KeyArrowUp:
+		tw.selected = (tw.selected + count - 1) % count
+	case e.Ch == ' ' || e.Key == tm.KeySpace:
+		host := tw.hosts[tw.selected]
+		host.broadcast = !host.broadcast
+	case e.Ch == 'a':
+		all := true
+		for _, host := range tw.hosts {
+			all = all && host.broadcast
+		}
+		for _, host := range tw.hosts {
+			host.broadcast = !all
+		}
+	case e.Ch == 'i':
+		tw.insert = true
+	}
+	return true
+}
+
+// resize tells all terminals the new size of terminal pane
+func (tw *TerminalWindow) resize() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if !tw.layout() {
+		return
+	}
+	for _, host := range tw.hosts {
+		if host.term != nil && !host.closed {
+			_ = host.term.Resize(tw.width, tw.height)
+		}
+	}
+}
+
+// Run shows window until user quits
+func (tw *TerminalWindow) Run() {
+	defer ui.Close()
+	events := make(chan tm.Event)
+	go func() {
+		for {
+			events <- tm.PollEvent()
+		}
+	}()
+	tw.setNeedRefresh()
+	for {
+		select {
+		case <-tw.refreshc:
+			tw.refresh()
+		case e := <-events:
+			switch e.Type {
+			case tm.EventResize:
+				tw.resize()
+			case tm.EventKey:
+				if !tw.handleKey(e) {
+					return
+				}
+			}
+			tw.refresh()
+		}
+	}
+}
+
+// Summary returns hosts whose terminal failed, with reasons
+func (tw *TerminalWindow) Summary() string {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	var lines []string
+	for _, host := range tw.hosts {
+		if host.closed && host.reason != "closed" {
+			lines = append(lines, host.alias+": "+host.reason)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
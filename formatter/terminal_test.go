@@ -0,0 +1,40 @@
+package formatter
+
+import (
+	"strings"
+	"testing"
+
+	tm "github.com/nsf/termbox-go"
+)
+
+func TestTermScreen(t *testing.T) {
+	ts := new(termScreen)
+	ts.Write([]byte("\x1b]0;title\x07\x1b[1;32mroot@web01\x1b[0m:~# ls\r\n"))
+	ts.Write([]byte("progress 10%\rprogress 99%\r\nab\bc\xe4\xbd"))
+	ts.Write([]byte("\xa0\n"))
+	expected := []string{"root@web01:~# ls", "progress 99%", "ac你", ""}
+	if lines := ts.tail(-1); strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Fatalf("Expected: %q. Actual: %q", expected, lines)
+	}
+	if lines := ts.tail(2); len(lines) != 2 || lines[0] != "ac你" {
+		t.Fatalf("Unexpected tail: %q", lines)
+	}
+}
+
+func TestKeyBytes(t *testing.T) {
+	cases := []struct {
+		event    tm.Event
+		expected string
+	}{
+		{tm.Event{Ch: 'x'}, "x"},
+		{tm.Event{Key: tm.KeyEnter}, "\r"},
+		{tm.Event{Key: tm.KeyCtrlC}, "\x03"},
+		{tm.Event{Key: tm.KeyArrowUp}, "\x1b[A"},
+		{tm.Event{Ch: 'b', Mod: tm.ModAlt}, "\x1bb"},
+	}
+	for _, c := range cases {
+		if actual := string(keyBytes(c.event)); actual != c.expected {
+			t.Fatalf("Expected: %q. Actual: %q", c.expected, actual)
+		}
+	}
+}
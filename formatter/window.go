@@ -7,10 +7,10 @@ import (
 	"strconv"
 	"strings"
 
-	ui "gopkg.in/gizak/termui.v2"
 	"github.com/lidongpeng36/gsck/command"
 	"github.com/lidongpeng36/gsck/util"
 	tm "github.com/nsf/termbox-go"
+	ui "gopkg.in/gizak/termui.v2"
 )
 
 // log to file
@@ -392,6 +392,9 @@ func (hui *hostlistUI) add(index int, data interface{}) {
 	for _, slave := range hui.slaves {
 		slave.add(index, output)
 	}
+	if duration := output.Duration(); duration > 0 {
+		hui.lines[index] += " (" + formatDuration(duration) + ")"
+	}
 	if output.ExitCode == 0 {
 		hui.status[index] = success
 	} else {
@@ -432,9 +435,9 @@ type WindowFormatter struct {
 	*abstractFormatter
 }
 
-// NewWindowFormatter initializes a WindowFormatter, and starts it.
-func NewWindowFormatter() *WindowFormatter {
-	bf := newAbstractFormatter()
+// NewWindowFormatter initializes a WindowFormatter for hosts of @info, and starts it.
+func NewWindowFormatter(info Info) *WindowFormatter {
+	bf := newAbstractFormatter(info.Hosts)
 	count := int(bf.length())
 
 	wf := &WindowFormatter{
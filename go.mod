@@ -15,4 +15,5 @@ require (
 	github.com/urfave/cli v1.22.2
 	golang.org/x/crypto v0.0.0-20200221231518-2aa609cf4a9d
 	gopkg.in/gizak/termui.v2 v2.3.0
+	gopkg.in/yaml.v2 v2.2.8
 )
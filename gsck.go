@@ -17,14 +17,15 @@ func setupConfig() {
 		FileName:  ".gsckconfig",
 		EnvPrefix: envPrefix,
 		Defaults: map[string]string{
-			"user":          os.Getenv("USER"),
-			"retry":         "2",
-			"method":        "ssh",
-			"concurrency":   "1",
-			"formatter":     "ansi",
-			"local.tmpdir":  "/tmp",
-			"remote.tmpdir": "/tmp",
-			"json.pretty":   "true",
+			"user":            os.Getenv("USER"),
+			"retry":           "2",
+			"method":          "ssh",
+			"concurrency":     "1",
+			"connect_timeout": "10",
+			"formatter":       "ansi",
+			"local.tmpdir":    "/tmp",
+			"remote.tmpdir":   "/tmp",
+			"json.pretty":     "true",
 		},
 	}
 	command.SetupConfig(setting)
@@ -65,10 +66,24 @@ func setupMainCommand() {
 		commander.HostsFlag,
 		commander.PreferFlag,
 		commander.PasswdFlag,
+		commander.PTYFlag,
+		commander.SudoFlag,
 		commander.WindowFlag,
+		commander.StdinFileFlag,
 		commander.MethodFlag,
+		commander.WorkerOptFlag,
+		commander.DryRunFlag,
+		commander.TemplateFlag,
 		commander.AccountFlag,
+		commander.RetryFlag,
 		commander.TimeoutFlag,
+		commander.DeadlineFlag,
+		commander.KeepAliveFlag,
+		commander.ConnectTimeoutFlag,
+		commander.RetryOnFlag,
+		commander.RetryCodesFlag,
+		commander.RetryBackoffFlag,
+		commander.SudoUserFlag,
 		commander.PasswordFlag,
 		commander.ConcurrencyFlag,
 	}
@@ -76,7 +91,7 @@ func setupMainCommand() {
 }
 
 func main() {
-	command.UseCommand("hostlist", "copy", "config")
+	command.UseCommand("hostlist", "copy", "shell", "terminal", "check", "push-key", "keyscan", "tail", "forward", "play", "ensure", "facts", "drift", "rolling-restart", "serve", "config")
 	commander.Init()
 	setupMainCommand()
 	commander.Run()
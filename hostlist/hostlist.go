@@ -6,7 +6,6 @@ import (
 	"strings"
 )
 
-var _list HostInfoList
 var allAvail = make(listOfHostlist, 0, 20)
 
 // RegisterHostlist used in each realization's init function
@@ -135,7 +134,6 @@ func (finder *hostlistFinder) find() (list HostInfoList, err error) {
 				err = fmt.Errorf("List is empty.")
 			}
 			if nil == err {
-				_list = list
 				finder.realFinder = hl.Name()
 				return
 			}
@@ -175,26 +173,23 @@ func filter(in HostInfoList) HostInfoList {
 // Available returns all Hostlist's Name
 func Available() []string {
 	ret := make([]string, len(allAvail))
-	sort.Sort(allAvail)
-	for i, hl := range allAvail {
+	// Sorted aside, since it may be called concurrently
+	sorted := append(listOfHostlist(nil), allAvail...)
+	sort.Sort(sorted)
+	for i, hl := range sorted {
 		ret[i] = fmt.Sprintf("%s(%d)", hl.Name(), hl.Priority())
 	}
 	return ret
 }
 
-// GetHostList returns the final host list.
-// It'll use cache if possible.
-func GetHostList(str, prefer string) (list HostInfoList, err error) {
-	if nil != _list && 0 < len(_list) {
-		list = _list
-		return
-	}
-	list, err = GetHostListNoCache(str, prefer)
-	return
+// GetHostListNoCache is GetHostList, since host list is no longer cached.
+// DEPRECATED
+func GetHostListNoCache(str, prefer string) (list HostInfoList, err error) {
+	return GetHostList(str, prefer)
 }
 
-// GetHostListNoCache returns the final host list.
-func GetHostListNoCache(str, prefer string) (list HostInfoList, err error) {
+// GetHostList returns the final host list. It's resolved in each call, so it's safe to be called concurrently.
+func GetHostList(str, prefer string) (list HostInfoList, err error) {
 	if "" != prefer {
 		if _, ok := constructorMap[prefer]; !ok {
 			avail := strings.Join(Available(), ", ")
@@ -204,6 +199,5 @@ func GetHostListNoCache(str, prefer string) (list HostInfoList, err error) {
 	}
 	finder := newHostlistFinder(str, prefer)
 	list, err = finder.find()
-	_list = list
 	return
 }
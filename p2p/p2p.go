@@ -1,11 +1,5 @@
 package p2p
 
-var _p2pmgr *Mgr
-
-func init() {
-	_p2pmgr = new(Mgr)
-}
-
 // Constructor is constructor for all P2P implementations.
 type Constructor func() P2P
 
@@ -37,24 +31,16 @@ type Mgr struct {
 	P2P
 }
 
-// GetMgr returns singleton instance of Mgr
-func GetMgr() *Mgr {
-	return _p2pmgr
-}
-
-// Available returns if we can find any available P2P implementation
-func Available() bool {
-	if _p2pmgr.P2P != nil {
-		return true
-	}
+// FindMgr returns a new Mgr with an available P2P implementation, or nil if there is none.
+// Each copy should have its own Mgr, since it holds source and destination.
+func FindMgr() *Mgr {
 	for _, builder := range constructorMap {
 		p := builder()
 		if p.Available() {
-			_p2pmgr.P2P = p
-			return true
+			return &Mgr{P2P: p}
 		}
 	}
-	return false
+	return nil
 }
 
 // SetTransfer sets source and destination for Copy.
@@ -0,0 +1,163 @@
+// Package playbook runs task files: ordered steps on hosts, such as
+// stop the service, copy the config, verify, and start.
+//
+// A task file is YAML:
+//
+//   name: deploy app
+//   vars:
+//     service: app
+//   concurrency: 10          # default of steps
+//   timeout: 60              # default of steps. Unit: s
+//   steps:
+//     - name: stop
+//       run: systemctl stop {{.Vars.service}}
+//     - copy: {src: app.conf, dst: /etc/app, after: "chown app app.conf"}
+//     - name: verify
+//       script: ./verify.sh  # local file, run on hosts
+//       register: verify
+//       ignore_errors: true
+//     - run: systemctl start {{.Vars.service}}
+//       when: .Reg.verify.OK
+//     - fetch: {src: /var/log/app.log, dst: ./logs}
+//       concurrency: 5
+//
+// `run`, `fetch.src` and `when` are text/template, with fields of HostInfo (e.g. `.Alias`),
+// `.Vars`, `.Reg` (registered results) and `.Last` (result of the previous step).
+// `when` may leave out the braces, and it must give true or false.
+// Hosts that fail a step are left out of the following steps, unless the step ignores errors.
+package playbook
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Playbook is a task file
+type Playbook struct {
+	Name string            `yaml:"name"`
+	Vars map[string]string `yaml:"vars"`
+	// Concurrency and Timeout are defaults of steps
+	Concurrency int64  `yaml:"concurrency"`
+	Timeout     int64  `yaml:"timeout"`
+	Steps       []Step `yaml:"steps"`
+}
+
+// Step is one of run, script, copy or fetch, on each host
+type Step struct {
+	Name string `yaml:"name"`
+	// Run is a command
+	Run string `yaml:"run"`
+	// Script is a local file, which is sent along with command and run by its shebang
+	Script string     `yaml:"script"`
+	Copy   *CopyStep  `yaml:"copy"`
+	Fetch  *FetchStep `yaml:"fetch"`
+	// When is a condition for each host. Step is skipped for hosts where it's false.
+	When string `yaml:"when"`
+	// Register saves result of each host by this name, as `.Reg.NAME`
+	Register     string `yaml:"register"`
+	Concurrency  int64  `yaml:"concurrency"`
+	Timeout      int64  `yaml:"timeout"`
+	IgnoreErrors bool   `yaml:"ignore_errors"`
+}
+
+// CopyStep copies a local file into a directory of hosts, like `gsck cp`
+type CopyStep struct {
+	Src    string `yaml:"src"`
+	Dst    string `yaml:"dst"`
+	Before string `yaml:"before"`
+	After  string `yaml:"after"`
+}
+
+// FetchStep fetches a file of each host into Dst/ALIAS/BASENAME
+type FetchStep struct {
+	Src string `yaml:"src"`
+	Dst string `yaml:"dst"`
+}
+
+// Kind returns which action the step takes
+func (s *Step) Kind() string {
+	switch {
+	case s.Run != "":
+		return "run"
+	case s.Script != "":
+		return "script"
+	case s.Copy != nil:
+		return "copy"
+	case s.Fetch != nil:
+		return "fetch"
+	}
+	return ""
+}
+
+// Title is Name, or what the step does
+func (s *Step) Title() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	switch s.Kind() {
+	case "run":
+		return s.Run
+	case "script":
+		return "script " + s.Script
+	case "copy":
+		return "copy " + s.Copy.Src + " to " + s.Copy.Dst
+	case "fetch":
+		return "fetch " + s.Fetch.Src + " to " + s.Fetch.Dst
+	}
+	return ""
+}
+
+func (s *Step) validate() error {
+	actions := 0
+	for _, set := range []bool{s.Run != "", s.Script != "", s.Copy != nil, s.Fetch != nil} {
+		if set {
+			actions++
+		}
+	}
+	if actions != 1 {
+		return errors.New("Step should have exactly one of run, script, copy and fetch")
+	}
+	if s.Copy != nil && (s.Copy.Src == "" || s.Copy.Dst == "") {
+		return errors.New("Copy needs both src and dst")
+	}
+	if s.Fetch != nil && (s.Fetch.Src == "" || s.Fetch.Dst == "") {
+		return errors.New("Fetch needs both src and dst")
+	}
+	return nil
+}
+
+// Parse parses task file content
+func Parse(data []byte) (*Playbook, error) {
+	pb := new(Playbook)
+	if err := yaml.UnmarshalStrict(data, pb); err != nil {
+		return nil, err
+	}
+	if len(pb.Steps) == 0 {
+		return nil, errors.New("No Steps")
+	}
+	for i := range pb.Steps {
+		if err := pb.Steps[i].validate(); err != nil {
+			return nil, fmt.Errorf("Step %d: %v", i+1, err)
+		}
+	}
+	if pb.Vars == nil {
+		pb.Vars = make(map[string]string)
+	}
+	return pb, nil
+}
+
+// Load reads and parses task file
+func Load(file string) (*Playbook, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pb, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return pb, nil
+}
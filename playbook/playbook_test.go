@@ -0,0 +1,117 @@
+package playbook
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lidongpeng36/gsck/executor"
+	"github.com/lidongpeng36/gsck/hostlist"
+)
+
+func TestParse(t *testing.T) {
+	if _, err := Parse([]byte("steps:\n  - run: uptime\n    script: a.sh\n")); err == nil {
+		t.Error("Step with both run and script should be rejected")
+	}
+	if _, err := Parse([]byte("steps:\n  - rum: uptime\n")); err == nil {
+		t.Error("Unknown field should be rejected")
+	}
+	pb, err := Parse([]byte("steps:\n  - copy: {src: a, dst: /tmp}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pb.Steps[0].Kind() != "copy" || pb.Steps[0].Title() != "copy a to /tmp" {
+		t.Errorf("Unexpected step: %+v", pb.Steps[0])
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gsck-playbook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	script := "#!/bin/sh\necho script on $GSCK_HOST\n"
+	if err = ioutil.WriteFile(filepath.Join(dir, "hello.sh"), []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pb, err := Parse([]byte(`
+vars:
+  greeting: hi
+steps:
+  - run: echo {{.Vars.greeting}} {{.Alias}}; [ {{.Alias}} = web01 ]
+    register: greet
+    ignore_errors: true
+  - script: hello.sh
+    when: .Reg.greet.OK
+  - run: "false"
+    when: not .Reg.greet.OK
+  - fetch: {src: "` + filepath.Join(dir, "hello.sh") + `", dst: "` + filepath.Join(dir, "fetched") + `"}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := &Runner{
+		Parameter: executor.Parameter{Method: "local", Concurrency: -1},
+		Hosts:     hostlist.MakeHostInfoListFromStringList([]string{"web01", "web02"}),
+		Vars:      map[string]string{"greeting": "hello"},
+		Dir:       dir,
+	}
+	report, err := runner.Run(context.Background(), pb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := report.Steps[0].Results["web01"]; !r.OK || r.Stdout != "hello web01" {
+		t.Errorf("Unexpected result of web01: %+v", r)
+	}
+	if r := report.Steps[1].Results["web01"]; r.Stdout != "script on web01" {
+		t.Errorf("Unexpected script result of web01: %+v", r)
+	}
+	if r := report.Steps[1].Results["web02"]; !r.Skipped {
+		t.Errorf("Script should be skipped on web02: %+v", r)
+	}
+	if _, ok := report.Steps[3].Results["web02"]; ok {
+		t.Error("web02 failed, and should be left out of later steps")
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "fetched", "web01", "hello.sh"))
+	if err != nil || string(data) != script {
+		t.Errorf("Fetched %q, %v", data, err)
+	}
+	recap := report.Recap[1]
+	if recap.OK != 0 || recap.Ignored != 1 || recap.Skipped != 1 || recap.Failed != 1 || recap.FailedStep != "false" {
+		t.Errorf("Unexpected recap of web02: %+v", recap)
+	}
+	if report.Failed() != 1 {
+		t.Errorf("Failed hosts: %d, expected 1", report.Failed())
+	}
+}
+
+func TestRunStop(t *testing.T) {
+	pb, err := Parse([]byte(`
+steps:
+  - run: sleep 0.5
+  - run: "true"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := &Runner{
+		Parameter: executor.Parameter{Method: "local", Concurrency: -1},
+		Hosts:     hostlist.MakeHostInfoListFromStringList([]string{"web01", "web02"}),
+	}
+	// Stopped during the first step, which still finishes
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		runner.Stop()
+	}()
+	report, err := runner.Run(context.Background(), pb)
+	if err == nil {
+		t.Fatal("Stopped run should return error")
+	}
+	if len(report.Steps) != 1 || !report.Steps[0].Results["web01"].OK {
+		t.Fatalf("First step should finish, and the second one not start: %+v", report.Steps)
+	}
+}
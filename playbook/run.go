@@ -0,0 +1,387 @@
+package playbook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+
+	"github.com/lidongpeng36/gsck/executor"
+	"github.com/lidongpeng36/gsck/formatter"
+	"github.com/lidongpeng36/gsck/hostlist"
+	"github.com/lidongpeng36/gsck/util"
+	"github.com/mgutz/ansi"
+)
+
+// Result is what a step gave on a host
+type Result struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exitcode"`
+	Error    string `json:"error"`
+	// OK is true if step ran and succeeded
+	OK      bool `json:"ok"`
+	Failed  bool `json:"failed"`
+	Skipped bool `json:"skipped"`
+}
+
+// StepReport holds results of a step, by alias. Hosts left out (failed before) have no result.
+type StepReport struct {
+	Name    string             `json:"name"`
+	Kind    string             `json:"kind"`
+	Results map[string]*Result `json:"results"`
+}
+
+// Recap counts results of a host in all steps
+type Recap struct {
+	Alias   string `json:"alias"`
+	OK      int    `json:"ok"`
+	Failed  int    `json:"failed"`
+	Ignored int    `json:"ignored"`
+	Skipped int    `json:"skipped"`
+	// FailedStep is the step where host failed and stopped, empty if it didn't
+	FailedStep string `json:"failed_step,omitempty"`
+}
+
+// Report is what Runner gives
+type Report struct {
+	Steps []*StepReport `json:"steps"`
+	Recap []*Recap      `json:"recap"`
+}
+
+// Failed returns how many hosts stopped by failure
+func (r *Report) Failed() (failed int) {
+	for _, recap := range r.Recap {
+		if recap.FailedStep != "" {
+			failed++
+		}
+	}
+	return
+}
+
+// hostState is what a host has been through
+type hostState struct {
+	info  *hostlist.HostInfo
+	recap *Recap
+	reg   map[string]*Result
+	last  *Result
+}
+
+// templateData is given to templates of a host, see package doc
+type templateData struct {
+	*hostlist.HostInfo
+	Vars map[string]string
+	Reg  map[string]*Result
+	Last *Result
+}
+
+func (hs *hostState) render(text string, vars map[string]string) (string, error) {
+	tmpl, err := template.New(hs.info.Alias).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	data := &templateData{HostInfo: hs.info, Vars: vars, Reg: hs.reg, Last: hs.last}
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// when evaluates condition @cond, which may leave out the braces
+func (hs *hostState) when(cond string, vars map[string]string) (bool, error) {
+	if !strings.Contains(cond, "{{") {
+		cond = "{{" + cond + "}}"
+	}
+	value, err := hs.render(cond, vars)
+	if err != nil {
+		return false, err
+	}
+	ok, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return false, fmt.Errorf("Condition gives %q, not true or false", value)
+	}
+	return ok, nil
+}
+
+// stepCollector keeps outputs of a step, by alias
+type stepCollector struct {
+	mu      sync.Mutex
+	outputs map[string]formatter.Output
+}
+
+func (sc *stepCollector) Add(output formatter.Output) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.outputs[output.Alias] = output
+}
+
+func (sc *stepCollector) Print() {}
+
+// Runner runs Playbook on Hosts
+type Runner struct {
+	// Parameter is the base of each step. Its Cmd, Template and Transfer are not used.
+	Parameter executor.Parameter
+	Hosts     hostlist.HostInfoList
+	// Vars override those of Playbook
+	Vars map[string]string
+	// Dir is where relative local paths of script and copy start from, usually directory of task file
+	Dir string
+	// NewFormatter returns a Formatter showing outputs of a step on @hosts, or nil to show nothing
+	NewFormatter func(hosts hostlist.HostInfoList) formatter.Formatter
+	// Out is where step headers and fetched files are shown, or nil to show nothing
+	Out io.Writer
+
+	stopped int32
+}
+
+// Stop makes Run return before the next step. The running step goes on.
+// It's safe to be called from another goroutine, e.g. a signal handler.
+func (r *Runner) Stop() {
+	atomic.StoreInt32(&r.stopped, 1)
+}
+
+func (r *Runner) printf(format string, v ...interface{}) {
+	if r.Out != nil {
+		fmt.Fprintf(r.Out, format, v...)
+	}
+}
+
+func (r *Runner) localPath(file string) string {
+	if filepath.IsAbs(file) || r.Dir == "" {
+		return file
+	}
+	return filepath.Join(r.Dir, file)
+}
+
+// scriptCmd returns command that writes @script into a temporary file on host, runs and removes it
+func scriptCmd(script []byte) (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	marker := "GSCK_SCRIPT_" + hex.EncodeToString(random)
+	if bytes.Contains(script, []byte(marker)) {
+		return "", errors.New("Script contains heredoc marker " + marker)
+	}
+	return fmt.Sprintf("f=$(mktemp) && cat > \"$f\" <<'%s' && chmod +x \"$f\"\n%s\n%s\n\"$f\"; rc=$?; rm -f \"$f\"; exit $rc",
+		marker, strings.TrimRight(string(script), "\n"), marker), nil
+}
+
+// fetched decodes base64 in @output of host @alias, and saves it as Dst/ALIAS/BASENAME.
+// It returns path of the file.
+func fetched(step *FetchStep, alias, src, stdout string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(stdout), ""))
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(step.Dst, alias)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, path.Base(src))
+	return file, ioutil.WriteFile(file, data, 0644)
+}
+
+// Run runs steps of @pb in order. Each step runs on hosts, which have not failed, and whose `when` is true.
+// It returns before the next step once Stop is called. Once ctx is done, the running step is killed as well.
+func (r *Runner) Run(ctx context.Context, pb *Playbook) (*Report, error) {
+	vars := make(map[string]string, len(pb.Vars)+len(r.Vars))
+	for k, v := range pb.Vars {
+		vars[k] = v
+	}
+	for k, v := range r.Vars {
+		vars[k] = v
+	}
+	// Steps share connections, unless caller gives a pool
+	pool := r.Parameter.SSHPool
+	if pool == nil {
+		pool = executor.NewSSHPool()
+		defer pool.CloseIdle()
+	}
+	report := &Report{}
+	states := make([]*hostState, len(r.Hosts))
+	for i, info := range r.Hosts {
+		host := *info
+		states[i] = &hostState{info: &host, recap: &Recap{Alias: info.Alias}, reg: make(map[string]*Result)}
+		report.Recap = append(report.Recap, states[i].recap)
+	}
+	for i := range pb.Steps {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if atomic.LoadInt32(&r.stopped) == 1 {
+			return report, fmt.Errorf("Stopped before step %d", i+1)
+		}
+		step := &pb.Steps[i]
+		r.printf("%s\n", ansi.Color(fmt.Sprintf("STEP [%d/%d] %s", i+1, len(pb.Steps), step.Title()), "cyan+b"))
+		sr, err := r.runStep(ctx, pb, step, states, vars, pool)
+		if err != nil {
+			return report, fmt.Errorf("Step %d: %v", i+1, err)
+		}
+		report.Steps = append(report.Steps, sr)
+		for _, hs := range states {
+			result, ok := sr.Results[hs.info.Alias]
+			if !ok {
+				continue
+			}
+			hs.last = result
+			if step.Register != "" {
+				hs.reg[step.Register] = result
+			}
+			switch {
+			case result.Skipped:
+				hs.recap.Skipped++
+			case result.Failed && step.IgnoreErrors:
+				hs.recap.Ignored++
+			case result.Failed:
+				hs.recap.Failed++
+				hs.recap.FailedStep = step.Title()
+			default:
+				hs.recap.OK++
+			}
+		}
+	}
+	return report, nil
+}
+
+// runStep runs @step on hosts left with connections of @pool, and returns their results
+func (r *Runner) runStep(ctx context.Context, pb *Playbook, step *Step, states []*hostState, vars map[string]string, pool *executor.SSHPool) (*StepReport, error) {
+	sr := &StepReport{Name: step.Title(), Kind: step.Kind(), Results: make(map[string]*Result)}
+	var script string
+	if step.Script != "" {
+		data, err := ioutil.ReadFile(r.localPath(step.Script))
+		if err != nil {
+			return nil, err
+		}
+		if script, err = scriptCmd(data); err != nil {
+			return nil, err
+		}
+	}
+
+	var list hostlist.HostInfoList
+	sources := make(map[string]string)
+	for _, hs := range states {
+		if hs.recap.FailedStep != "" {
+			continue
+		}
+		alias := hs.info.Alias
+		if step.When != "" {
+			ok, err := hs.when(step.When, vars)
+			if err != nil {
+				sr.Results[alias] = &Result{Error: "when: " + err.Error(), Failed: true}
+				continue
+			} else if !ok {
+				sr.Results[alias] = &Result{Skipped: true}
+				continue
+			}
+		}
+		host := *hs.info
+		var err error
+		switch step.Kind() {
+		case "run":
+			host.Cmd, err = hs.render(step.Run, vars)
+		case "script":
+			host.Cmd = script
+		case "fetch":
+			sources[alias], err = hs.render(step.Fetch.Src, vars)
+			host.Cmd = "base64 < " + util.ShellQuote(sources[alias])
+		}
+		if err != nil {
+			sr.Results[alias] = &Result{Error: err.Error(), Failed: true}
+			continue
+		}
+		list = append(list, &host)
+	}
+	if len(list) == 0 {
+		return sr, nil
+	}
+
+	parameter := r.Parameter
+	parameter.Cmd = ""
+	parameter.Template = false
+	parameter.Transfer = nil
+	parameter.SSHPool = pool
+	if step.Concurrency != 0 {
+		parameter.Concurrency = step.Concurrency
+	} else if pb.Concurrency != 0 {
+		parameter.Concurrency = pb.Concurrency
+	}
+	if step.Timeout != 0 {
+		parameter.Timeout = step.Timeout
+	} else if pb.Timeout != 0 {
+		parameter.Timeout = pb.Timeout
+	}
+	exec, err := executor.NewExecutor(parameter)
+	if err != nil {
+		return nil, err
+	}
+	exec.SetHostInfoList(list)
+	if step.Copy != nil {
+		src := r.localPath(step.Copy.Src)
+		if util.IsDir(src) {
+			return nil, errors.New("Copy supports files only: " + src)
+		} else if _, err = os.Stat(src); err != nil {
+			return nil, err
+		}
+		exec.SetTransfer(src, step.Copy.Dst)
+		exec.SetTransferHook(step.Copy.Before, step.Copy.After)
+	}
+	collector := &stepCollector{outputs: make(map[string]formatter.Output)}
+	exec.AddFormatter("playbook", collector)
+	// Fetched content is not worth showing, but plan is
+	if r.NewFormatter != nil && (step.Fetch == nil || parameter.DryRun) {
+		if f := r.NewFormatter(list); f != nil {
+			exec.AddFormatter("rt", f)
+		}
+	}
+	if _, err = exec.RunContext(ctx); err != nil {
+		return nil, err
+	}
+
+	for _, info := range list {
+		output, ok := collector.outputs[info.Alias]
+		if !ok {
+			continue
+		}
+		result := &Result{
+			Stdout:   output.Stdout,
+			Stderr:   output.Stderr,
+			ExitCode: output.ExitCode,
+			Error:    output.Error,
+		}
+		result.Failed = output.ExitCode != 0 || output.Error != ""
+		if step.Fetch != nil && !result.Failed && !parameter.DryRun {
+			file, err := fetched(step.Fetch, info.Alias, sources[info.Alias], output.Stdout)
+			if err != nil {
+				result.Error = err.Error()
+				result.Failed = true
+			} else {
+				result.Stdout = file
+			}
+		}
+		result.OK = !result.Failed
+		if step.Fetch != nil && !parameter.DryRun {
+			if result.Failed {
+				r.printf("%s: %s\n", info.Alias, ansi.Color(strings.TrimSpace(result.Error+" "+result.Stderr), "red"))
+			} else {
+				r.printf("%s: %s\n", info.Alias, result.Stdout)
+			}
+		}
+		sr.Results[info.Alias] = result
+	}
+	return sr, nil
+}
@@ -0,0 +1,104 @@
+// Package plugin defines the protocol between gsck and external workers.
+//
+// A plugin is an executable named `gsck-worker-<name>`, found in PATH or in config `plugin.dir`
+// (default: $HOME/.gsck/plugins). It's then available as `gsck -m <name>`.
+//
+// gsck starts the plugin once per run, and talks to it with JSON lines (one Message per line)
+// over its stdin (requests) and stdout (events). Stderr of plugin is passed through.
+//
+//   -> {"type":"init","init":{"version":1,"user":"root","timeout":0,...}}
+//   <- {"type":"ready"}                       (or {"type":"error","error":"..."})
+//   -> {"type":"execute","id":1,"host":{"index":0,"host":"10.0.0.1","port":"22","alias":"web01","user":"root","cmd":"uptime"}}
+//   -> {"type":"execute","id":2,"host":{...}}
+//   <- {"type":"output","id":2,"output":{"stdout":"...","exitcode":0}}
+//   -> {"type":"cancel","id":1}
+//   <- {"type":"output","id":1,"output":{"error":"killed","exitcode":-1}}
+//   -> {"type":"shutdown"}
+//
+// Execute requests could arrive before previous ones are answered, up to the concurrency.
+// Every execute request must be answered with exactly one output event of the same id,
+// even if it's cancelled. After shutdown, or once stdin is closed, plugin should exit.
+//
+// Plugins written in Go may just implement Handler and call Serve.
+package plugin
+
+// Version of protocol
+const Version = 1
+
+// Message types sent by gsck
+const (
+	TypeInit     = "init"
+	TypeExecute  = "execute"
+	TypeCancel   = "cancel"
+	TypeShutdown = "shutdown"
+)
+
+// Message types sent by plugin
+const (
+	TypeReady  = "ready"
+	TypeOutput = "output"
+	TypeError  = "error"
+)
+
+// Phases that Output could stop at. Those failed at PhaseConnect are retried by gsck.
+const (
+	PhaseConnect = "connect"
+	PhaseExec    = "exec"
+)
+
+// Message is a single line in the protocol
+type Message struct {
+	Type string `json:"type"`
+	// ID pairs execute, cancel and output of the same try. Retries of a host get new ids.
+	ID     int     `json:"id,omitempty"`
+	Init   *Init   `json:"init,omitempty"`
+	Host   *Host   `json:"host,omitempty"`
+	Output *Output `json:"output,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// Init carries settings of the run
+type Init struct {
+	Version     int    `json:"version"`
+	User        string `json:"user"`
+	Passwd      string `json:"passwd,omitempty"`
+	Concurrency int64  `json:"concurrency"`
+	// Timeouts in seconds, 0 for no timeout. gsck enforces them as well.
+	ConnectTimeout int64 `json:"connect_timeout"`
+	Timeout        int64 `json:"timeout"`
+	// Options are given by `--worker-opt key=value`
+	Options  map[string]string `json:"options,omitempty"`
+	Transfer *Transfer         `json:"transfer,omitempty"`
+}
+
+// Transfer is the file that should be copied to Destination of each host before command,
+// with Before and After hooks run around the copying.
+type Transfer struct {
+	Data        []byte `json:"data"`
+	Perm        string `json:"perm"`
+	Basename    string `json:"basename"`
+	Destination string `json:"destination"`
+	Dst         string `json:"dst"`
+	Before      string `json:"before,omitempty"`
+	After       string `json:"after,omitempty"`
+}
+
+// Host is what to run, and where
+type Host struct {
+	Index int    `json:"index"`
+	Host  string `json:"host"`
+	Port  string `json:"port"`
+	Alias string `json:"alias"`
+	User  string `json:"user"`
+	Cmd   string `json:"cmd"`
+}
+
+// Output is result of an execute request
+type Output struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exitcode"`
+	// Error is set if host fails. Phase tells where, default PhaseExec.
+	Error string `json:"error,omitempty"`
+	Phase string `json:"phase,omitempty"`
+}
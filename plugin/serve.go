@@ -0,0 +1,103 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Handler is what a plugin written in Go needs to implement
+type Handler interface {
+	// Init is called once, before any Execute
+	Init(*Init) error
+	// Execute runs command of host. It should return soon after ctx is done.
+	Execute(ctx context.Context, host *Host) *Output
+}
+
+// maxLineSize limits a single message, which may carry the transferred file
+const maxLineSize = 1 << 30
+
+// Serve runs Handler over stdin/stdout, until shutdown or stdin is closed
+func Serve(h Handler) error {
+	return ServeIO(h, os.Stdin, os.Stdout)
+}
+
+// ServeIO runs Handler with requests from @r, and events to @w
+func ServeIO(h Handler, r io.Reader, w io.Writer) error {
+	var wmu sync.Mutex
+	encoder := json.NewEncoder(w)
+	send := func(msg *Message) error {
+		wmu.Lock()
+		defer wmu.Unlock()
+		return encoder.Encode(msg)
+	}
+	var mu sync.Mutex
+	cancels := make(map[int]context.CancelFunc)
+	var wg sync.WaitGroup
+	defer func() {
+		mu.Lock()
+		for _, cancel := range cancels {
+			cancel()
+		}
+		mu.Unlock()
+		wg.Wait()
+	}()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		var msg Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			return err
+		}
+		switch msg.Type {
+		case TypeInit:
+			if msg.Init == nil {
+				msg.Init = new(Init)
+			}
+			reply := &Message{Type: TypeReady}
+			if msg.Init.Version > Version {
+				reply = &Message{Type: TypeError, Error: fmt.Sprintf("Unsupported protocol version: %d", msg.Init.Version)}
+			} else if err := h.Init(msg.Init); err != nil {
+				reply = &Message{Type: TypeError, Error: err.Error()}
+			}
+			if err := send(reply); err != nil {
+				return err
+			}
+		case TypeExecute:
+			if msg.Host == nil {
+				return fmt.Errorf("Execute request %d without host", msg.ID)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			mu.Lock()
+			cancels[msg.ID] = cancel
+			mu.Unlock()
+			wg.Add(1)
+			go func(id int, host *Host) {
+				defer wg.Done()
+				output := h.Execute(ctx, host)
+				if output == nil {
+					output = new(Output)
+				}
+				mu.Lock()
+				delete(cancels, id)
+				mu.Unlock()
+				cancel()
+				_ = send(&Message{Type: TypeOutput, ID: id, Output: output})
+			}(msg.ID, msg.Host)
+		case TypeCancel:
+			mu.Lock()
+			if cancel, ok := cancels[msg.ID]; ok {
+				cancel()
+			}
+			mu.Unlock()
+		case TypeShutdown:
+			return nil
+		}
+	}
+	return scanner.Err()
+}
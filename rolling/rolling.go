@@ -0,0 +1,272 @@
+// Package rolling runs an action on hosts batch by batch, such as restarting a service,
+// and waits until hosts of a batch are healthy before the next one.
+//
+// Rollout halts once a host fails its action or health check, and hosts left are untouched.
+// Report tells what happened to each host: done, failed (and where), or untouched.
+package rolling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lidongpeng36/gsck/executor"
+	"github.com/lidongpeng36/gsck/formatter"
+	"github.com/lidongpeng36/gsck/hostlist"
+	"github.com/mgutz/ansi"
+)
+
+// Status of Host
+const (
+	Done      = "done"
+	Failed    = "failed"
+	Untouched = "untouched"
+)
+
+// Host is what happened to a host
+type Host struct {
+	Alias  string `json:"alias"`
+	Batch  int    `json:"batch"`
+	Status string `json:"status"`
+	// Phase is where host failed: action or health
+	Phase string `json:"phase,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Healthy is seconds host took to become healthy after the action
+	Healthy float64 `json:"healthy,omitempty"`
+}
+
+// collector keeps outputs by alias
+type collector struct {
+	mu      sync.Mutex
+	outputs map[string]formatter.Output
+}
+
+func (col *collector) Add(output formatter.Output) {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	col.outputs[output.Alias] = output
+}
+
+func (col *collector) Print() {}
+
+// Rollout runs Action on Hosts, Batch hosts at a time
+type Rollout struct {
+	// Parameter is the base of action and health checks. Its Cmd is not used, and the whole batch runs at once.
+	Parameter executor.Parameter
+	Hosts     hostlist.HostInfoList
+	Action    string
+	// Health is polled on each host of a batch after the action, until it succeeds or HealthTimeout is hit.
+	// Hosts are done once the action succeeds, if it's empty.
+	Health         string
+	HealthTimeout  time.Duration
+	HealthInterval time.Duration
+	// Pause is wait between batches
+	Pause time.Duration
+	// Batch is hosts in a batch, at least 1
+	Batch int
+	// Out is where progress is shown, or nil to show nothing
+	Out io.Writer
+	// Report is status of each host, in order of Hosts. It's filled by Start.
+	Report []*Host
+
+	stopped int32
+}
+
+func (r *Rollout) printf(format string, v ...interface{}) {
+	if r.Out != nil {
+		fmt.Fprintf(r.Out, format, v...)
+	}
+}
+
+// Stop makes Start halt before the next batch. The running batch, and its health checks, go on.
+// It's safe to be called from another goroutine, e.g. a signal handler.
+func (r *Rollout) Stop() {
+	atomic.StoreInt32(&r.stopped, 1)
+}
+
+func (r *Rollout) isStopped() bool {
+	return atomic.LoadInt32(&r.stopped) == 1
+}
+
+// run runs @cmd on @hosts, and returns outputs by alias
+func (r *Rollout) run(ctx context.Context, parameter executor.Parameter, hosts hostlist.HostInfoList, cmd string) (map[string]formatter.Output, error) {
+	list := make(hostlist.HostInfoList, len(hosts))
+	for i, info := range hosts {
+		host := *info
+		host.Cmd = cmd
+		list[i] = &host
+	}
+	exec, err := executor.NewExecutor(parameter)
+	if err != nil {
+		return nil, err
+	}
+	exec.SetHostInfoList(list)
+	col := &collector{outputs: make(map[string]formatter.Output)}
+	exec.AddFormatter("rolling", col)
+	_, err = exec.RunContext(ctx)
+	return col.outputs, err
+}
+
+// outputError describes why @output failed, or returns empty if it didn't
+func outputError(output formatter.Output, ok bool) string {
+	if !ok {
+		return "no result"
+	}
+	if output.ExitCode == 0 && output.Error == "" {
+		return ""
+	}
+	lines := strings.Split(strings.TrimSpace(output.Error+"\n"+output.Stderr+"\n"+output.Stdout), "\n")
+	if msg := strings.TrimSpace(lines[0]); msg != "" {
+		return msg
+	}
+	return fmt.Sprintf("exit code %d", output.ExitCode)
+}
+
+// waitHealthy polls health of @hosts until all succeed, or HealthTimeout after @start.
+// Each poll is bounded by the deadline as well, so a hanging check is not waited for.
+// Hosts still unhealthy are returned with last errors.
+func (r *Rollout) waitHealthy(ctx context.Context, parameter executor.Parameter, hosts hostlist.HostInfoList, start time.Time) (map[string]string, error) {
+	pending := hosts
+	errs := make(map[string]string)
+	deadline := start.Add(r.HealthTimeout)
+	for {
+		pollCtx, cancel := context.WithDeadline(ctx, deadline)
+		outputs, err := r.run(pollCtx, parameter, pending, r.Health)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		var left hostlist.HostInfoList
+		for _, info := range pending {
+			output, ok := outputs[info.Alias]
+			if msg := outputError(output, ok); msg != "" {
+				if output.TimedOut && !time.Now().Before(deadline) {
+					msg = "health check did not return within health timeout"
+				}
+				errs[info.Alias] = msg
+				left = append(left, info)
+				continue
+			}
+			delete(errs, info.Alias)
+			r.find(info.Alias).Healthy = time.Since(start).Seconds()
+			r.printf("  %s healthy after %s\n", info.Alias, time.Since(start).Round(time.Second))
+		}
+		pending = left
+		// Hosts killed by ctx are in errs as well
+		if err = ctx.Err(); err != nil {
+			return errs, err
+		}
+		if len(pending) == 0 || !time.Now().Add(r.HealthInterval).Before(deadline) {
+			return errs, nil
+		}
+		select {
+		case <-ctx.Done():
+			return errs, ctx.Err()
+		case <-time.After(r.HealthInterval):
+		}
+	}
+}
+
+func (r *Rollout) find(alias string) *Host {
+	for _, host := range r.Report {
+		if host.Alias == alias {
+			return host
+		}
+	}
+	return nil
+}
+
+// Start rolls batches out, until all are done, one fails, or Stop is called. Hosts not reached are left untouched.
+// Once ctx is done, the running batch is killed, and its hosts failed.
+func (r *Rollout) Start(ctx context.Context) error {
+	if r.Batch < 1 {
+		return errors.New("Batch should be at least 1")
+	}
+	parameter := r.Parameter
+	parameter.Cmd = ""
+	parameter.Concurrency = -1
+	// Health checks reuse connections of the action, unless caller gives a pool
+	if parameter.SSHPool == nil {
+		parameter.SSHPool = executor.NewSSHPool()
+		defer parameter.SSHPool.CloseIdle()
+	}
+	r.Report = nil
+	for i, info := range r.Hosts {
+		r.Report = append(r.Report, &Host{Alias: info.Alias, Batch: i/r.Batch + 1, Status: Untouched})
+	}
+	batches := (len(r.Hosts) + r.Batch - 1) / r.Batch
+	for b := 0; b < batches; b++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if r.isStopped() {
+			return fmt.Errorf("Stopped before batch %d", b+1)
+		}
+		end := (b + 1) * r.Batch
+		if end > len(r.Hosts) {
+			end = len(r.Hosts)
+		}
+		hosts := r.Hosts[b*r.Batch : end]
+		aliases := make([]string, len(hosts))
+		for i, info := range hosts {
+			aliases[i] = info.Alias
+		}
+		r.printf("%s\n", ansi.Color(fmt.Sprintf("BATCH [%d/%d] %s", b+1, batches, strings.Join(aliases, ", ")), "cyan+b"))
+
+		outputs, err := r.run(ctx, parameter, hosts, r.Action)
+		if err != nil {
+			return err
+		}
+		// Hosts have time to become healthy since the action is over, however long it took
+		start := time.Now()
+		var acted hostlist.HostInfoList
+		failed := false
+		for _, info := range hosts {
+			host := r.find(info.Alias)
+			output, ok := outputs[info.Alias]
+			if msg := outputError(output, ok); msg != "" {
+				host.Status, host.Phase, host.Error = Failed, "action", msg
+				r.printf("  %s action failed: %s\n", info.Alias, msg)
+				failed = true
+				continue
+			}
+			acted = append(acted, info)
+		}
+		if r.Health != "" && len(acted) > 0 {
+			errs, err := r.waitHealthy(ctx, parameter, acted, start)
+			for _, info := range acted {
+				host := r.find(info.Alias)
+				if msg, ok := errs[info.Alias]; ok {
+					host.Status, host.Phase, host.Error = Failed, "health", msg
+					r.printf("  %s unhealthy: %s\n", info.Alias, msg)
+					failed = true
+				} else if err == nil {
+					host.Status = Done
+				}
+			}
+			if err != nil {
+				return err
+			}
+		} else {
+			for _, info := range acted {
+				r.find(info.Alias).Status = Done
+			}
+		}
+		if failed {
+			return fmt.Errorf("Halted at batch %d", b+1)
+		}
+		if r.Pause > 0 && b+1 < batches {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(r.Pause):
+			}
+		}
+	}
+	return nil
+}
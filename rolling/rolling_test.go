@@ -0,0 +1,106 @@
+package rolling
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lidongpeng36/gsck/executor"
+	"github.com/lidongpeng36/gsck/hostlist"
+)
+
+func statuses(report []*Host) string {
+	list := make([]string, len(report))
+	for i, host := range report {
+		list[i] = host.Alias + ":" + host.Status + host.Phase
+	}
+	return strings.Join(list, " ")
+}
+
+func newRollout(hosts ...string) *Rollout {
+	return &Rollout{
+		Parameter:      executor.Parameter{Method: "local"},
+		Hosts:          hostlist.MakeHostInfoListFromStringList(hosts),
+		HealthTimeout:  5 * time.Second,
+		HealthInterval: 10 * time.Millisecond,
+		Batch:          2,
+	}
+}
+
+func TestStart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gsck-rolling")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	r := newRollout("a", "b", "c", "d", "e")
+	// Host is healthy once its action left a file
+	r.Action = "touch " + dir + "/$GSCK_HOST"
+	r.Health = "test -f " + dir + "/$GSCK_HOST"
+	if err = r.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := statuses(r.Report); got != "a:done b:done c:done d:done e:done" {
+		t.Fatalf("Report: %s", got)
+	}
+	if r.Report[4].Batch != 3 {
+		t.Fatalf("Batch of e: %d", r.Report[4].Batch)
+	}
+	files, _ := filepath.Glob(dir + "/*")
+	if len(files) != 5 {
+		t.Fatalf("Actions: %v", files)
+	}
+}
+
+func TestStartHalts(t *testing.T) {
+	r := newRollout("a", "b", "c", "d", "e")
+	r.Action = `[ "$GSCK_HOST" != d ]`
+	err := r.Start(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "batch 2") {
+		t.Fatalf("Error: %v", err)
+	}
+	if got := statuses(r.Report); got != "a:done b:done c:done d:failedaction e:untouched" {
+		t.Fatalf("Report: %s", got)
+	}
+
+	// Health check hanging past timeout makes host unhealthy
+	r = newRollout("a", "b", "c")
+	r.Action = "true"
+	r.Health = `[ "$GSCK_HOST" = a ] || sleep 30`
+	r.HealthTimeout = 300 * time.Millisecond
+	start := time.Now()
+	if err = r.Start(context.Background()); err == nil {
+		t.Fatal("Unhealthy host should halt")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("Health check was waited for %s", elapsed)
+	}
+	if got := statuses(r.Report); got != "a:done b:failedhealth c:untouched" {
+		t.Fatalf("Report: %s", got)
+	}
+	if !strings.Contains(r.Report[1].Error, "health timeout") {
+		t.Fatalf("Error of b: %s", r.Report[1].Error)
+	}
+}
+
+func TestStop(t *testing.T) {
+	r := newRollout("a", "b", "c", "d")
+	r.Action = "sleep 0.5"
+	r.Health = "true"
+	// Stopped during the first batch, which still finishes
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		r.Stop()
+	}()
+	err := r.Start(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "batch 2") {
+		t.Fatalf("Error: %v", err)
+	}
+	if got := statuses(r.Report); got != "a:done b:done c:untouched d:untouched" {
+		t.Fatalf("Report: %s", got)
+	}
+}
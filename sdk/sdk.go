@@ -0,0 +1,235 @@
+// Package sdk embeds gsck into Go programs.
+//
+// A Client holds options and SSH connections only, and each Run has its own Executor and Formatter,
+// so runs never share other state, and a Client can be used by many goroutines at once.
+// Nothing here prints, or exits the process: results come back by callback and return value.
+//
+//   client := sdk.New(sdk.Options{User: "deploy", Concurrency: 20, Timeout: time.Minute})
+//   defer client.Close()
+//   summary, err := client.Run(ctx, sdk.Job{
+//       Hosts: []string{"web01", "web02:2222"},
+//       Cmd:   "systemctl is-active app",
+//       OnResult: func(r sdk.Result) { log.Println(r.Alias, r.ExitCode) },
+//   })
+//
+// Runs of a Client share SSH connections of the same host and user, until Close.
+package sdk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lidongpeng36/gsck/executor"
+	"github.com/lidongpeng36/gsck/formatter"
+	"github.com/lidongpeng36/gsck/hostlist"
+	"github.com/lidongpeng36/gsck/util"
+)
+
+// Result is output of a host
+type Result = formatter.Output
+
+// Options are settings shared by runs of a Client. Zero values are defaults of gsck.
+type Options struct {
+	// Method is worker to run with, e.g. ssh (default), local, docker
+	Method string
+	// User to log in as. Default: current user
+	User string
+	// Passwd answers password prompts of login and sudo
+	Passwd  string
+	Account string
+	// Concurrency is how many hosts run at once. 0: recommended by worker, -1: all
+	Concurrency int64
+	// Timeout is for the command on each host, ConnectTimeout for connecting to each host,
+	// and Deadline for the whole run. They're rounded up to seconds. 0: no limit
+	Timeout        time.Duration
+	ConnectTimeout time.Duration
+	Deadline       time.Duration
+	KeepAlive      time.Duration
+	Retry          executor.RetryPolicy
+	PTY            bool
+	// SudoUser runs commands as this user with sudo
+	SudoUser string
+	// WorkerOptions are worker specific settings, like `--worker-opt key=value`
+	WorkerOptions map[string]string
+	// SSHPool shares connections with other Clients given the same one. Client has its own pool if it's nil.
+	SSHPool *executor.SSHPool
+}
+
+// Copy is a local file that is copied to hosts, before the command
+type Copy struct {
+	Src string
+	// Dst is directory on hosts
+	Dst string
+	// Before and After run on hosts around the copying. After runs in Dst.
+	Before string
+	After  string
+}
+
+// Job is what to run
+type Job struct {
+	// Hosts are `host` or `host:port`. HostList is used if it's empty.
+	Hosts []string
+	// HostList is a hostlist expression, e.g. a file, like `-f` of gsck
+	HostList string
+	Cmd      string
+	// Template enables text/template in Cmd, with fields of HostInfo, e.g. `{{.Alias}}`
+	Template bool
+	Copy     *Copy
+	// Stdin is streamed to the command of every host. All hosts run at once then.
+	Stdin  io.Reader
+	DryRun bool
+	// OnResult is called with result of each host, as soon as it's done.
+	// Calls of a run are never concurrent.
+	OnResult func(Result)
+}
+
+// Summary is results of a run, in order of hosts
+type Summary struct {
+	Results []Result
+	Success int
+	Failed  int
+	// Error counts hosts that did not run, e.g. connection refused, or cancelled
+	Error int
+}
+
+// Client runs Jobs. It's safe for concurrent use.
+type Client struct {
+	options Options
+	pool    *executor.SSHPool
+	// ownPool is set if Options.SSHPool is not given
+	ownPool bool
+}
+
+// New is Client's constructor
+func New(options Options) *Client {
+	c := &Client{options: options, pool: options.SSHPool}
+	if c.pool == nil {
+		c.pool = executor.NewSSHPool()
+		c.ownPool = true
+	}
+	return c
+}
+
+// Close closes connections of Client's own pool, which are not used by a running Job.
+// Client could still be used, and connects again then. A pool given by Options.SSHPool is left to its owner.
+func (c *Client) Close() {
+	if c.ownPool {
+		c.pool.CloseIdle()
+	}
+}
+
+// seconds rounds @d up to seconds
+func seconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+// parameter returns executor.Parameter of @job
+func (c *Client) parameter(job *Job) executor.Parameter {
+	o := &c.options
+	p := executor.Parameter{
+		Cmd:            job.Cmd,
+		User:           o.User,
+		Passwd:         o.Passwd,
+		Account:        o.Account,
+		Method:         o.Method,
+		Retry:          o.Retry,
+		Concurrency:    o.Concurrency,
+		Timeout:        seconds(o.Timeout),
+		ConnectTimeout: seconds(o.ConnectTimeout),
+		Deadline:       seconds(o.Deadline),
+		KeepAlive:      seconds(o.KeepAlive),
+		PTY:            o.PTY,
+		SudoUser:       o.SudoUser,
+		Stdin:          job.Stdin,
+		DryRun:         job.DryRun,
+		Template:       job.Template,
+		SSHPool:        c.pool,
+	}
+	// Workers may keep Options, so each run has its own copy
+	if o.WorkerOptions != nil {
+		p.Options = make(map[string]string, len(o.WorkerOptions))
+		for k, v := range o.WorkerOptions {
+			p.Options[k] = v
+		}
+	}
+	if job.Stdin != nil {
+		p.Concurrency = -1
+	}
+	return p
+}
+
+// collector is Formatter of a run, which keeps results and calls OnResult
+type collector struct {
+	mu       sync.Mutex
+	summary  *Summary
+	onResult func(Result)
+}
+
+func (col *collector) Add(output formatter.Output) {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	if output.Index >= 0 && output.Index < len(col.summary.Results) {
+		col.summary.Results[output.Index] = output
+	}
+	switch output.Outcome() {
+	case formatter.OutcomeSuccess:
+		col.summary.Success++
+	case formatter.OutcomeFailed:
+		col.summary.Failed++
+	default:
+		col.summary.Error++
+	}
+	if col.onResult != nil {
+		col.onResult(output)
+	}
+}
+
+func (col *collector) Print() {}
+
+// Hosts resolves @job into hosts
+func Hosts(job Job) (hostlist.HostInfoList, error) {
+	if len(job.Hosts) > 0 {
+		return hostlist.MakeHostInfoListFromStringList(job.Hosts), nil
+	}
+	if job.HostList == "" {
+		return nil, errors.New("Show me the host list.")
+	}
+	return hostlist.GetHostList(job.HostList, "")
+}
+
+// Run runs @job until it's done, or ctx is done.
+// Hosts that did not finish are in Summary as well, marked Cancelled or TimedOut.
+// Error is returned only if run could not go on, e.g. no hosts, or unknown method.
+func (c *Client) Run(ctx context.Context, job Job) (*Summary, error) {
+	if job.Cmd == "" && job.Copy == nil {
+		return nil, errors.New("Nothing to run: Cmd or Copy is required")
+	}
+	list, err := Hosts(job)
+	if err != nil {
+		return nil, err
+	}
+	exec, err := executor.NewExecutor(c.parameter(&job))
+	if err != nil {
+		return nil, err
+	}
+	exec.SetHostInfoList(list)
+	if job.Copy != nil {
+		if util.IsDir(job.Copy.Src) {
+			return nil, errors.New("Copy supports files only: " + job.Copy.Src)
+		} else if _, err = os.Stat(job.Copy.Src); err != nil {
+			return nil, err
+		}
+		exec.SetTransfer(job.Copy.Src, job.Copy.Dst)
+		exec.SetTransferHook(job.Copy.Before, job.Copy.After)
+	}
+	summary := &Summary{Results: make([]Result, len(list))}
+	exec.AddFormatter("sdk", &collector{summary: summary, onResult: job.OnResult})
+	if _, err = exec.RunContext(ctx); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
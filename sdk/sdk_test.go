@@ -0,0 +1,232 @@
+package sdk
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestRunConcurrently(t *testing.T) {
+	client := New(Options{Method: "local", Concurrency: 3})
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			hosts := make([]string, 5+g)
+			for i := range hosts {
+				hosts[i] = fmt.Sprintf("g%d-h%d", g, i)
+			}
+			job := Job{Hosts: hosts}
+			if g%4 == 3 {
+				// Resolved as hostlist expression instead
+				job = Job{HostList: strings.Join(hosts, ",")}
+			}
+			var called []string
+			job.Cmd = fmt.Sprintf("echo {{.Alias}}; exit %d", g%2)
+			job.Template = true
+			job.OnResult = func(r Result) {
+				called = append(called, r.Alias)
+			}
+			summary, err := client.Run(context.Background(), job)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if len(called) != len(hosts) || len(summary.Results) != len(hosts) {
+				t.Errorf("Run %d: %d callbacks, %d results, for %d hosts", g, len(called), len(summary.Results), len(hosts))
+				return
+			}
+			for i, r := range summary.Results {
+				// Stdout of a failed host is not kept by local worker
+				if r.Alias != hosts[i] || r.ExitCode != g%2 || g%2 == 0 && r.Stdout != hosts[i] {
+					t.Errorf("Run %d: result %d is %+v", g, i, r)
+				}
+			}
+			if g%2 == 0 && summary.Success != len(hosts) || g%2 == 1 && summary.Failed != len(hosts) {
+				t.Errorf("Run %d: %+v", g, summary)
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestRunFailedWithStderr(t *testing.T) {
+	client := New(Options{Method: "local", Concurrency: 3})
+	summary, err := client.Run(context.Background(), Job{Hosts: []string{"a", "b"}, Cmd: `[ "$GSCK_HOST" = a ] || { echo oops >&2; exit 3; }`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Stderr of b is in its Error, which doesn't make it an error
+	if summary.Success != 1 || summary.Failed != 1 || summary.Error != 0 {
+		t.Fatalf("%+v", summary)
+	}
+	if r := summary.Results[1]; r.ExitCode != 3 || !strings.Contains(r.Error, "oops") {
+		t.Fatalf("Result of b: %+v", r)
+	}
+}
+
+// sshServer accepts password "secret", and answers each exec request with its command.
+// It counts connections that are open, and all connections ever made.
+type sshServer struct {
+	addr  string
+	open  int32
+	total int32
+}
+
+func newSSHServer(t *testing.T) *sshServer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, passwd []byte) (*ssh.Permissions, error) {
+			if string(passwd) != "secret" {
+				return nil, fmt.Errorf("Wrong password of %s", conn.User())
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &sshServer{addr: ln.Addr().String()}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn, config)
+		}
+	}()
+	return srv
+}
+
+func (srv *sshServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	atomic.AddInt32(&srv.total, 1)
+	atomic.AddInt32(&srv.open, 1)
+	defer atomic.AddInt32(&srv.open, -1)
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "session only")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				if req.Type != "exec" {
+					_ = req.Reply(false, nil)
+					continue
+				}
+				var payload struct{ Command string }
+				_ = ssh.Unmarshal(req.Payload, &payload)
+				_ = req.Reply(true, nil)
+				fmt.Fprintf(channel, "%s@%s", sconn.User(), payload.Command)
+				_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				return
+			}
+		}()
+	}
+}
+
+func TestRunSSHConcurrently(t *testing.T) {
+	srv := newSSHServer(t)
+	client := New(Options{User: "deploy", Passwd: "secret", ConnectTimeout: 5 * time.Second, Timeout: 10 * time.Second})
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			cmd := fmt.Sprintf("echo %d", g)
+			summary, err := client.Run(context.Background(), Job{Hosts: []string{srv.addr}, Cmd: cmd})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if summary.Success != 1 || !strings.Contains(summary.Results[0].Stdout, "deploy@") ||
+				!strings.Contains(summary.Results[0].Stdout, cmd) {
+				t.Errorf("Run %d: %+v", g, summary.Results)
+			}
+		}(g)
+	}
+	wg.Wait()
+	// Runs of the Client share one connection
+	if total := atomic.LoadInt32(&srv.total); total != 1 {
+		t.Fatalf("%d connections for one host", total)
+	}
+
+	// Another password is not given the connection
+	other := New(Options{User: "deploy", Passwd: "wrong", ConnectTimeout: 5 * time.Second, SSHPool: client.pool})
+	summary, err := other.Run(context.Background(), Job{Hosts: []string{srv.addr}, Cmd: "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Error != 1 {
+		t.Fatalf("Wrong password: %+v", summary.Results)
+	}
+
+	client.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&srv.open) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Connection is not closed by Close")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	client := New(Options{Method: "local", Concurrency: -1})
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	summary, err := client.Run(ctx, Job{Hosts: []string{"a", "b"}, Cmd: "sleep 30"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("Run took %s after ctx is done", elapsed)
+	}
+	for _, r := range summary.Results {
+		if !r.Cancelled && !r.TimedOut {
+			t.Fatalf("Not stopped: %+v", r)
+		}
+	}
+}
+
+func TestRunInvalid(t *testing.T) {
+	client := New(Options{Method: "local"})
+	if _, err := client.Run(context.Background(), Job{Cmd: "true"}); err == nil {
+		t.Fatal("Run without hosts should fail")
+	}
+	if _, err := New(Options{Method: "nope"}).Run(context.Background(), Job{Hosts: []string{"a"}, Cmd: "true"}); err == nil {
+		t.Fatal("Run with unknown method should fail")
+	}
+}
@@ -0,0 +1,299 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lidongpeng36/gsck/executor"
+	"github.com/lidongpeng36/gsck/formatter"
+	"github.com/lidongpeng36/gsck/hostlist"
+)
+
+// Status of Run
+const (
+	StatusRunning   = "running"
+	StatusDone      = "done"
+	StatusCancelled = "cancelled"
+	// StatusError is a run that could not start or stopped early, see Run.Error
+	StatusError = "error"
+	// StatusInterrupted is a run that was still running when server stopped
+	StatusInterrupted = "interrupted"
+)
+
+// Types of Event
+const (
+	EventStart  = "start"
+	EventOutput = "output"
+	EventEnd    = "end"
+)
+
+// Request is what to run, given by client
+type Request struct {
+	// Hosts are `host` or `host:port`, joined by comma or space.
+	// They're never taken as a file, or any other hostlist, which would read files of the server.
+	Hosts  string `json:"hosts"`
+	Cmd    string `json:"cmd"`
+	Method string `json:"method,omitempty"`
+	User   string `json:"user,omitempty"`
+	// Concurrency is recommended one of method, if it's 0
+	Concurrency int64 `json:"concurrency,omitempty"`
+	// Timeouts. Unit: s
+	Timeout        int64             `json:"timeout,omitempty"`
+	ConnectTimeout int64             `json:"connect_timeout,omitempty"`
+	Deadline       int64             `json:"deadline,omitempty"`
+	Retry          int               `json:"retry,omitempty"`
+	SudoUser       string            `json:"sudo_user,omitempty"`
+	Template       bool              `json:"template,omitempty"`
+	Options        map[string]string `json:"options,omitempty"`
+}
+
+// Parameter returns executor.Parameter of @req
+func (req *Request) Parameter() executor.Parameter {
+	return executor.Parameter{
+		Cmd:            req.Cmd,
+		User:           req.User,
+		Method:         req.Method,
+		Concurrency:    req.Concurrency,
+		Timeout:        req.Timeout,
+		ConnectTimeout: req.ConnectTimeout,
+		Deadline:       req.Deadline,
+		Retry:          executor.NewRetryPolicy(req.Retry),
+		SudoUser:       req.SudoUser,
+		Template:       req.Template,
+		Options:        req.Options,
+	}
+}
+
+// resolveHosts splits Hosts of request. Paths are rejected, since they're likely files meant as host lists.
+func resolveHosts(hosts string) (hostlist.HostInfoList, error) {
+	list, err := hostlist.GetHostList(hosts, "string")
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range list {
+		if strings.ContainsAny(info.Alias, "/\\") {
+			return nil, errors.New("Hosts should be names joined by comma, not a file: " + info.Alias)
+		}
+	}
+	return list, nil
+}
+
+// Summary counts hosts by result
+type Summary struct {
+	Total   int `json:"total"`
+	Success int `json:"success"`
+	Failed  int `json:"failed"`
+	Error   int `json:"error"`
+}
+
+// Event is sent to clients for changes of Run
+type Event struct {
+	// Seq starts from 1 in each Run. Clients resume with it as Last-Event-ID.
+	Seq    int               `json:"seq"`
+	Type   string            `json:"type"`
+	Time   time.Time         `json:"time"`
+	Status string            `json:"status,omitempty"`
+	Output *formatter.Output `json:"output,omitempty"`
+}
+
+// Run is a submitted request, and its result
+type Run struct {
+	ID       string             `json:"id"`
+	Request  Request            `json:"request"`
+	Status   string             `json:"status"`
+	Error    string             `json:"error,omitempty"`
+	Created  time.Time          `json:"created"`
+	Finished time.Time          `json:"finished,omitempty"`
+	Hosts    []string           `json:"hosts"`
+	Summary  Summary            `json:"summary"`
+	Outputs  []formatter.Output `json:"outputs,omitempty"`
+	Events   []*Event           `json:"-"`
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	// cancelled is set if run is cancelled before it starts
+	cancelled bool
+	changed   chan struct{}
+}
+
+// newID returns a random hex ID, prefixed with time so IDs sort by creation
+func newID() string {
+	buf := make([]byte, 4)
+	_, _ = rand.Read(buf)
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(buf)
+}
+
+// NewRun creates a Run of @req, which is not started
+func NewRun(req Request) *Run {
+	return &Run{
+		ID:      newID(),
+		Request: req,
+		Status:  StatusRunning,
+		Created: time.Now(),
+		Hosts:   []string{},
+		Outputs: []formatter.Output{},
+		changed: make(chan struct{}),
+	}
+}
+
+// rebuildEvents makes events of a run loaded from history, which are not persisted
+func (run *Run) rebuildEvents() {
+	run.changed = make(chan struct{})
+	run.Events = []*Event{{Seq: 1, Type: EventStart, Time: run.Created, Status: StatusRunning}}
+	for i := range run.Outputs {
+		run.Events = append(run.Events, &Event{Seq: len(run.Events) + 1, Type: EventOutput, Time: run.Outputs[i].End, Output: &run.Outputs[i]})
+	}
+	run.Events = append(run.Events, &Event{Seq: len(run.Events) + 1, Type: EventEnd, Time: run.Finished, Status: run.Status})
+}
+
+// emit appends an event, and wakes up watchers. Caller holds mu.
+func (run *Run) emit(event *Event) {
+	event.Seq = len(run.Events) + 1
+	event.Time = time.Now()
+	run.Events = append(run.Events, event)
+	close(run.changed)
+	run.changed = make(chan struct{})
+}
+
+// EventsSince returns events after @seq, and a channel closed once there are more
+func (run *Run) EventsSince(seq int) ([]*Event, <-chan struct{}) {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	if seq < 0 {
+		seq = 0
+	}
+	if seq > len(run.Events) {
+		seq = len(run.Events)
+	}
+	return run.Events[seq:], run.changed
+}
+
+// Done tells whether run is over
+func (run *Run) Done() bool {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	return run.Status != StatusRunning
+}
+
+// Snapshot returns a copy of run, safe to be encoded while run goes on
+func (run *Run) Snapshot() *Run {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	return &Run{
+		ID:       run.ID,
+		Request:  run.Request,
+		Status:   run.Status,
+		Error:    run.Error,
+		Created:  run.Created,
+		Finished: run.Finished,
+		Hosts:    run.Hosts,
+		Summary:  run.Summary,
+		Outputs:  append([]formatter.Output{}, run.Outputs...),
+	}
+}
+
+// Cancel stops run. It returns false if run is not running.
+func (run *Run) Cancel() bool {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	if run.Status != StatusRunning {
+		return false
+	}
+	run.cancelled = true
+	if run.cancel != nil {
+		run.cancel()
+	}
+	return true
+}
+
+// finish marks run as over with @status
+func (run *Run) finish(status string, err error) {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	run.Status = status
+	if err != nil {
+		run.Error = err.Error()
+	}
+	run.Finished = time.Now()
+	run.emit(&Event{Type: EventEnd, Status: status})
+}
+
+// pragma mark - Formatter Interface
+
+// Add records output of a host, and sends it as an event
+func (run *Run) Add(output formatter.Output) {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	run.Outputs = append(run.Outputs, output)
+	switch output.Outcome() {
+	case formatter.OutcomeSuccess:
+		run.Summary.Success++
+	case formatter.OutcomeFailed:
+		run.Summary.Failed++
+	default:
+		run.Summary.Error++
+	}
+	run.emit(&Event{Type: EventOutput, Output: &output})
+}
+
+// Print does nothing, since run is finished by Start
+func (run *Run) Print() {}
+
+// Start resolves hosts, and runs request until it's done or cancelled. It blocks.
+func (run *Run) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	run.mu.Lock()
+	run.cancel = cancel
+	if run.cancelled {
+		cancel()
+	}
+	run.emit(&Event{Type: EventStart, Status: StatusRunning})
+	run.mu.Unlock()
+
+	req := &run.Request
+	if req.Hosts == "" || req.Cmd == "" {
+		run.finish(StatusError, errors.New("hosts and cmd are required"))
+		return
+	}
+	list, err := resolveHosts(req.Hosts)
+	if err == nil && len(list) == 0 {
+		err = errors.New("Empty Hostlist")
+	}
+	if err != nil {
+		run.finish(StatusError, err)
+		return
+	}
+	// Connections are not kept after run, since next one may be long after
+	parameter := req.Parameter()
+	parameter.SSHPool = executor.NewSSHPool()
+	defer parameter.SSHPool.CloseIdle()
+	exec, err := executor.NewExecutor(parameter)
+	if err != nil {
+		run.finish(StatusError, err)
+		return
+	}
+	exec.SetHostInfoList(list)
+	exec.AddFormatter("server", run)
+	run.mu.Lock()
+	for _, info := range list {
+		run.Hosts = append(run.Hosts, info.Alias)
+	}
+	run.Summary.Total = len(list)
+	run.mu.Unlock()
+
+	_, err = exec.RunContext(ctx)
+	switch {
+	case err != nil:
+		run.finish(StatusError, err)
+	case ctx.Err() != nil:
+		run.finish(StatusCancelled, nil)
+	default:
+		run.finish(StatusDone, nil)
+	}
+}
@@ -0,0 +1,266 @@
+// Package server serves gsck over HTTP, for tools that would rather not run it and parse its output.
+//
+// API, all in JSON, with `Authorization: Bearer TOKEN`:
+//
+//   POST /runs                submit a Request, e.g. {"hosts": "web01,web02:2222", "cmd": "uptime"}
+//   GET  /runs                runs, newest first, without outputs
+//   GET  /runs/ID             status, summary and outputs of a run
+//   GET  /runs/ID/events      Server-Sent Events of a run: start, output of each host, and end.
+//                             It resumes after Last-Event-ID (or `?since=SEQ`), and ends with the run.
+//                             Token could be given by `?token=TOKEN` here, for EventSource of browsers.
+//   POST /runs/ID/cancel      cancel a run (DELETE /runs/ID does the same)
+//
+// Runs are kept in Store, so history outlives the server. Methods of requests are limited by Server.Methods.
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// keepAliveInterval is how often an idle event stream is pinged, so proxies keep it open
+const keepAliveInterval = 15 * time.Second
+
+// Server is the HTTP API. It's an http.Handler.
+type Server struct {
+	// Token is required from clients. Empty Token disables auth.
+	Token string
+	Store *Store
+	// Methods are allowed in requests. Empty method of request is ssh.
+	Methods []string
+	// Logf logs each run, if it's not nil
+	Logf func(format string, v ...interface{})
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mux    *http.ServeMux
+}
+
+// New is Server's constructor
+func New(store *Store, token string) *Server {
+	s := &Server{Token: token, Store: store, Methods: []string{"ssh"}, mux: http.NewServeMux()}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.mux.HandleFunc("/runs", s.handleRuns)
+	s.mux.HandleFunc("/runs/", s.handleRun)
+	return s
+}
+
+func (s *Server) logf(format string, v ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, v...)
+	}
+}
+
+// Submit starts running @req in background
+func (s *Server) Submit(req Request) (*Run, error) {
+	if req.Hosts == "" || req.Cmd == "" {
+		return nil, errors.New("hosts and cmd are required")
+	}
+	if !s.allowed(req.Method) {
+		return nil, errors.New("Method is not allowed: " + req.Method)
+	}
+	if _, err := resolveHosts(req.Hosts); err != nil {
+		return nil, err
+	}
+	if err := s.ctx.Err(); err != nil {
+		return nil, errors.New("Server is closed")
+	}
+	run := NewRun(req)
+	if err := s.Store.Add(run); err != nil {
+		return nil, err
+	}
+	s.logf("run %s: %q on %s", run.ID, req.Cmd, req.Hosts)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		run.Start(s.ctx)
+		if err := s.Store.Save(run); err != nil {
+			s.logf("run %s: %v", run.ID, err)
+		}
+		snapshot := run.Snapshot()
+		if snapshot.Error != "" {
+			s.logf("run %s: %s: %s", run.ID, snapshot.Status, snapshot.Error)
+			return
+		}
+		s.logf("run %s: %s, success %d, failed %d, error %d", run.ID, snapshot.Status,
+			snapshot.Summary.Success, snapshot.Summary.Failed, snapshot.Summary.Error)
+	}()
+	return run, nil
+}
+
+// allowed tells whether @method is in Methods
+func (s *Server) allowed(method string) bool {
+	if method == "" {
+		method = "ssh"
+	}
+	for _, m := range s.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// Close cancels runs, and waits until they're saved
+func (s *Server) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// authorized tells whether request carries Token.
+// Token in query is taken by event streams only, since URLs end up in logs and history.
+func (s *Server) authorized(r *http.Request) bool {
+	if s.Token == "" {
+		return true
+	}
+	var token string
+	if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/events") {
+		token = r.URL.Query().Get("token")
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	_ = enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "Invalid Token")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// handleRuns serves /runs
+func (s *Server) handleRuns(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		list := s.Store.List()
+		runs := make([]*Run, len(list))
+		for i, run := range list {
+			runs[i] = run.Snapshot()
+			runs[i].Outputs = nil
+		}
+		writeJSON(w, http.StatusOK, runs)
+	case http.MethodPost:
+		var req Request
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid Request: "+err.Error())
+			return
+		}
+		run, err := s.Submit(req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.Header().Set("Location", "/runs/"+run.ID)
+		writeJSON(w, http.StatusAccepted, run.Snapshot())
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+// handleRun serves /runs/ID and below
+func (s *Server) handleRun(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/runs/"), "/")
+	id, action := parts[0], ""
+	if len(parts) > 1 {
+		action = strings.Join(parts[1:], "/")
+	}
+	var run *Run
+	if validID(id) {
+		run = s.Store.Get(id)
+	}
+	if run == nil {
+		writeError(w, http.StatusNotFound, "No Such Run: "+id)
+		return
+	}
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, run.Snapshot())
+	case action == "" && r.Method == http.MethodDelete,
+		action == "cancel" && r.Method == http.MethodPost:
+		if !run.Cancel() {
+			writeError(w, http.StatusConflict, "Run is not running")
+			return
+		}
+		s.logf("run %s: cancelled by client", run.ID)
+		writeJSON(w, http.StatusAccepted, map[string]string{"id": run.ID, "status": "cancelling"})
+	case action == "events" && r.Method == http.MethodGet:
+		s.streamEvents(w, r, run)
+	case action == "" || action == "cancel" || action == "events":
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// streamEvents sends events of @run as Server-Sent Events, until run ends or client leaves
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request, run *Run) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+	since := r.Header.Get("Last-Event-ID")
+	if since == "" {
+		since = r.URL.Query().Get("since")
+	}
+	seq, _ := strconv.Atoi(since)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		events, changed := run.EventsSince(seq)
+		for _, event := range events {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data)
+			seq = event.Seq
+			if event.Type == EventEnd {
+				flusher.Flush()
+				return
+			}
+		}
+		flusher.Flush()
+		select {
+		case <-changed:
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
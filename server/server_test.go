@@ -0,0 +1,186 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T, dir string) (*Server, *httptest.Server) {
+	store, err := OpenStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(store, "secret")
+	s.Methods = append(s.Methods, "local")
+	return s, httptest.NewServer(s)
+}
+
+func request(t *testing.T, method, url, body string) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gsck-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	secret := dir + "/id_rsa"
+	if err = ioutil.WriteFile(secret, []byte("PRIVATE KEY\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	hosts := "web01,web02"
+	s, ts := newTestServer(t, dir+"/runs")
+
+	resp, err := http.Post(ts.URL+"/runs", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Without token: %d", resp.StatusCode)
+	}
+
+	// Token in query is for event streams only
+	resp, err = http.Get(ts.URL + "/runs?token=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Token in query: %d", resp.StatusCode)
+	}
+	resp = request(t, "POST", ts.URL+"/runs", `{"hosts": "`+hosts+`", "cmd": "true", "method": "docker"}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Method not allowed: %d", resp.StatusCode)
+	}
+	// Files of server are not read as host lists
+	for _, body := range []string{
+		`{"hosts": "` + secret + `", "cmd": "true", "method": "local"}`,
+		`{"hosts": "` + secret + `", "prefer": "file", "cmd": "true", "method": "local"}`,
+	} {
+		resp = request(t, "POST", ts.URL+"/runs", body)
+		data, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest || strings.Contains(string(data), "PRIVATE") {
+			t.Fatalf("Hosts from file: %d %s", resp.StatusCode, data)
+		}
+	}
+	if runs := s.Store.List(); len(runs) != 0 {
+		t.Fatalf("Rejected runs are kept: %d", len(runs))
+	}
+
+	resp = request(t, "POST", ts.URL+"/runs", `{"hosts": "`+hosts+`", "cmd": "echo {{.Alias}}; exit 0", "method": "local", "template": true}`)
+	var run Run
+	if err = json.NewDecoder(resp.Body).Decode(&run); err != nil || resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Submit: %d %v", resp.StatusCode, err)
+	}
+
+	resp = request(t, "GET", ts.URL+"/runs/"+run.ID+"/events", "")
+	var types []string
+	var stdout bytes.Buffer
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "event: ") {
+			types = append(types, strings.TrimPrefix(line, "event: "))
+		}
+		if strings.HasPrefix(line, "data: ") {
+			var event Event
+			if err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+				t.Fatal(err)
+			}
+			if event.Output != nil {
+				stdout.WriteString(event.Output.Stdout + "\n")
+			}
+		}
+	}
+	resp.Body.Close()
+	if got := strings.Join(types, ","); got != "start,output,output,end" {
+		t.Fatalf("Events: %s", got)
+	}
+	if out := stdout.String(); !strings.Contains(out, "web01") || !strings.Contains(out, "web02") {
+		t.Fatalf("Outputs: %q", out)
+	}
+
+	// Resumed stream only has what's left
+	resp, err = http.Get(ts.URL + "/runs/" + run.ID + "/events?since=3&token=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.HasPrefix(string(body), "id: 4\nevent: end\n") {
+		t.Fatalf("Resumed: %q", body)
+	}
+
+	resp = request(t, "POST", ts.URL+"/runs/"+run.ID+"/cancel", "")
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("Cancel finished run: %d", resp.StatusCode)
+	}
+
+	wait := func(id string) *Run {
+		deadline := time.Now().Add(10 * time.Second)
+		for !s.Store.Get(id).Done() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Run %s is not done", id)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		return s.Store.Get(id)
+	}
+
+	// Stderr of a non-zero exit doesn't make it an error
+	resp = request(t, "POST", ts.URL+"/runs", `{"hosts": "`+hosts+`", "cmd": "echo oops >&2; exit 3", "method": "local"}`)
+	var failed Run
+	_ = json.NewDecoder(resp.Body).Decode(&failed)
+	if summary := wait(failed.ID).Summary; summary.Failed != 2 || summary.Error != 0 {
+		t.Fatalf("Failed: %+v", summary)
+	}
+
+	// A long run is cancelled
+	resp = request(t, "POST", ts.URL+"/runs", `{"hosts": "`+hosts+`", "cmd": "sleep 30", "method": "local", "concurrency": -1}`)
+	var long Run
+	_ = json.NewDecoder(resp.Body).Decode(&long)
+	resp = request(t, "DELETE", ts.URL+"/runs/"+long.ID, "")
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Cancel: %d", resp.StatusCode)
+	}
+	wait(long.ID)
+	s.Close()
+	ts.Close()
+
+	// History is loaded by a new server
+	s, ts = newTestServer(t, dir+"/runs")
+	defer ts.Close()
+	defer s.Close()
+	resp = request(t, "GET", ts.URL+"/runs", "")
+	var runs []*Run
+	if err = json.NewDecoder(resp.Body).Decode(&runs); err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 3 || runs[0].ID != long.ID || runs[0].Status != StatusCancelled || runs[2].ID != run.ID || runs[2].Status != StatusDone {
+		t.Fatalf("History: %+v", runs)
+	}
+	resp = request(t, "GET", ts.URL+"/runs/"+run.ID, "")
+	var loaded Run
+	_ = json.NewDecoder(resp.Body).Decode(&loaded)
+	if loaded.Summary.Success != 2 || len(loaded.Outputs) != 2 {
+		t.Fatalf("Loaded: %+v", loaded.Summary)
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store keeps runs in memory, and persists each of them as a JSON file in Dir
+type Store struct {
+	Dir string
+	// Limit is how many finished runs are kept. 0: unlimited
+	Limit int
+	mu    sync.Mutex
+	runs  map[string]*Run
+}
+
+// OpenStore loads runs in @dir, which is created if missing.
+// Runs that were still running are marked as interrupted.
+func OpenStore(dir string, limit int) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &Store{Dir: dir, Limit: limit, runs: make(map[string]*Run)}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		run := new(Run)
+		if err = json.Unmarshal(data, run); err != nil || run.ID == "" {
+			// Not a run, or broken one. Leave it there.
+			continue
+		}
+		if run.Status == StatusRunning {
+			run.Status = StatusInterrupted
+			run.Finished = time.Now()
+		}
+		run.rebuildEvents()
+		s.runs[run.ID] = run
+	}
+	return s, nil
+}
+
+func (s *Store) file(id string) string {
+	return filepath.Join(s.Dir, id+".json")
+}
+
+// Add puts @run into store, and persists it
+func (s *Store) Add(run *Run) error {
+	s.mu.Lock()
+	s.runs[run.ID] = run
+	s.mu.Unlock()
+	return s.Save(run)
+}
+
+// Get returns run of @id, or nil
+func (s *Store) Get(id string) *Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.runs[id]
+}
+
+// List returns all runs, newest first
+func (s *Store) List() []*Run {
+	s.mu.Lock()
+	list := make([]*Run, 0, len(s.runs))
+	for _, run := range s.runs {
+		list = append(list, run)
+	}
+	s.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Created.After(list[j].Created)
+	})
+	return list
+}
+
+// Save persists current state of @run, and drops the oldest finished runs beyond Limit
+func (s *Store) Save(run *Run) error {
+	data, err := json.MarshalIndent(run.Snapshot(), "", "    ")
+	if err != nil {
+		return err
+	}
+	// Written aside and renamed, so a crash never leaves half a file
+	tmp := s.file(run.ID) + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, s.file(run.ID)); err != nil {
+		return err
+	}
+	return s.prune()
+}
+
+func (s *Store) prune() error {
+	if s.Limit <= 0 {
+		return nil
+	}
+	kept := 0
+	for _, run := range s.List() {
+		if !run.Done() {
+			continue
+		}
+		if kept++; kept <= s.Limit {
+			continue
+		}
+		s.mu.Lock()
+		delete(s.runs, run.ID)
+		s.mu.Unlock()
+		if err := os.Remove(s.file(run.ID)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// validID tells whether @id may be a run ID, so it's safe as a file name
+func validID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, `/\.`)
+}
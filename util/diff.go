@@ -0,0 +1,192 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffOp is a line kept (' '), deleted ('-') or inserted ('+')
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// maxDiffEdits caps edits searched by diffLines. Memory of search grows with square of edits,
+// so files differing more than that are shown as replaced as a whole.
+const maxDiffEdits = 1000
+
+// diffLines finds the shortest edit script from @a to @b, by Myers' algorithm.
+// Common head and tail are kept out of search.
+func diffLines(a, b []string) []diffOp {
+	head := 0
+	for head < len(a) && head < len(b) && a[head] == b[head] {
+		head++
+	}
+	tail := 0
+	for tail < len(a)-head && tail < len(b)-head && a[len(a)-1-tail] == b[len(b)-1-tail] {
+		tail++
+	}
+	var ops []diffOp
+	for _, line := range a[:head] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	middle, ok := myersDiff(a[head:len(a)-tail], b[head:len(b)-tail], maxDiffEdits)
+	if !ok {
+		middle = middle[:0]
+		for _, line := range a[head : len(a)-tail] {
+			middle = append(middle, diffOp{'-', line})
+		}
+		for _, line := range b[head : len(b)-tail] {
+			middle = append(middle, diffOp{'+', line})
+		}
+	}
+	ops = append(ops, middle...)
+	for _, line := range a[len(a)-tail:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// myersDiff is diffLines without trimming. It gives up, if more than @maxEdits edits are needed.
+// Each step keeps only its own diagonals -d-1..d+1 for walking back, so memory is O(D^2) instead of O((N+M)*D).
+func myersDiff(a, b []string, maxEdits int) ([]diffOp, bool) {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d][k+d+1] is v[offset+k] before step d
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		if d > maxEdits {
+			return nil, false
+		}
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		done := false
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+		if done {
+			break
+		}
+	}
+
+	// Walk back from the end, and collect ops in reverse
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v, base := trace[d], d+1
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[base+k-1] < v[base+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[base+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffOp{' ', a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, diffOp{'+', b[prevY]})
+			} else {
+				ops = append(ops, diffOp{'-', a[prevX]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops, true
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// hunkRange formats start and count of a hunk side, like `diff -u`
+func hunkRange(start, count int) string {
+	if count == 0 {
+		// Empty side points at the line before
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// UnifiedDiff returns diff from @a to @b in unified format, with @context lines around changes,
+// and @fromName and @toName in header. It's empty if they're the same.
+func UnifiedDiff(a, b, fromName, toName string, context int) string {
+	ops := diffLines(splitLines(a), splitLines(b))
+	var changes []int
+	for i, op := range ops {
+		if op.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", fromName, toName)
+	// Line numbers before ops[i], on both sides
+	aLine, bLine := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	aLine[0], bLine[0] = 1, 1
+	for i, op := range ops {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if op.kind != '+' {
+			aLine[i+1]++
+		}
+		if op.kind != '-' {
+			bLine[i+1]++
+		}
+	}
+	for i := 0; i < len(changes); {
+		// Changes closer than 2*context share a hunk
+		j := i
+		for j+1 < len(changes) && changes[j+1]-changes[j] <= 2*context+1 {
+			j++
+		}
+		start, end := changes[i]-context, changes[j]+context+1
+		if start < 0 {
+			start = 0
+		}
+		if end > len(ops) {
+			end = len(ops)
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n",
+			hunkRange(aLine[start], aLine[end]-aLine[start]),
+			hunkRange(bLine[start], bLine[end]-bLine[start]))
+		for _, op := range ops[start:end] {
+			buf.WriteByte(op.kind)
+			buf.WriteString(op.line)
+			buf.WriteByte('\n')
+		}
+		i = j + 1
+	}
+	return buf.String()
+}
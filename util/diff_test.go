@@ -0,0 +1,114 @@
+package util
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+	b := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	expected := `--- old
++++ new
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -9,3 +9,4 @@
+ i
+ j
+ k
++l
+`
+	if diff := UnifiedDiff(a, b, "old", "new", 3); diff != expected {
+		t.Errorf("Unexpected diff:\n%s", diff)
+	}
+	if diff := UnifiedDiff(a, a, "old", "new", 3); diff != "" {
+		t.Errorf("Same text should give no diff, got:\n%s", diff)
+	}
+	expected = `--- old
++++ new
+@@ -0,0 +1,2 @@
++x
++y
+`
+	if diff := UnifiedDiff("", "x\ny", "old", "new", 3); diff != expected {
+		t.Errorf("Unexpected diff:\n%s", diff)
+	}
+}
+
+// sides rebuilds both texts from @ops
+func sides(ops []diffOp) (a, b []string, edits int) {
+	for _, op := range ops {
+		if op.kind != '+' {
+			a = append(a, op.line)
+		}
+		if op.kind != '-' {
+			b = append(b, op.line)
+		}
+		if op.kind != ' ' {
+			edits++
+		}
+	}
+	return
+}
+
+// lcs is length of the longest common subsequence
+func lcs(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else if dp[i+1][j] > dp[i][j+1] {
+				dp[i][j] = dp[i+1][j]
+			} else {
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+	return dp[0][0]
+}
+
+func TestDiffLines(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, r.Intn(30))
+		for i := range lines {
+			lines[i] = fmt.Sprint(r.Intn(4))
+		}
+		return lines
+	}
+	for i := 0; i < 200; i++ {
+		a, b := random(), random()
+		ops := diffLines(a, b)
+		gotA, gotB, edits := sides(ops)
+		if strings.Join(gotA, ",") != strings.Join(a, ",") || strings.Join(gotB, ",") != strings.Join(b, ",") {
+			t.Fatalf("Diff of %v and %v: %v", a, b, ops)
+		}
+		if shortest := len(a) + len(b) - 2*lcs(a, b); edits != shortest {
+			t.Fatalf("Diff of %v and %v has %d edits, instead of %d", a, b, edits, shortest)
+		}
+	}
+
+	// Too many edits are shown as replaced as a whole, between common head and tail
+	a, b := []string{"head"}, []string{"head"}
+	for i := 0; i < maxDiffEdits; i++ {
+		a = append(a, fmt.Sprint("a", i))
+		b = append(b, fmt.Sprint("b", i))
+	}
+	a, b = append(a, "tail"), append(b, "tail")
+	ops := diffLines(a, b)
+	_, _, edits := sides(ops)
+	if edits != 2*maxDiffEdits || ops[0].kind != ' ' || ops[1].kind != '-' || ops[len(ops)-1].kind != ' ' {
+		t.Fatalf("Unexpected fallback: %d edits, %v ... %v", edits, ops[:2], ops[len(ops)-1])
+	}
+}
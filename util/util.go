@@ -63,6 +63,11 @@ func WrapCmdAfter(cmd, after string) string {
 	return WrapCmd(cmd, "", after)
 }
 
+// ShellQuote quotes @str with single quotes, so that shell takes it as a single word
+func ShellQuote(str string) string {
+	return "'" + strings.Replace(str, "'", `'\''`, -1) + "'"
+}
+
 // IsDir gives whether @path is a directory
 func IsDir(path string) bool {
 	fi, err := os.Stat(path)
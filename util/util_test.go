@@ -43,3 +43,16 @@ func TestWrapCmd(t *testing.T) {
 		}
 	}
 }
+
+func TestShellQuote(t *testing.T) {
+	cases := map[string]string{
+		"":          "''",
+		"ls -l":     "'ls -l'",
+		"echo 'hi'": `'echo '\''hi'\'''`,
+	}
+	for str, expected := range cases {
+		if quoted := ShellQuote(str); quoted != expected {
+			t.Fatalf("str: %s, Expected: %s. Actual: %s", str, expected, quoted)
+		}
+	}
+}